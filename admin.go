@@ -0,0 +1,38 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/nickemp1996/chirpy/internal/apierror"
+	"github.com/nickemp1996/chirpy/internal/auth"
+	"github.com/nickemp1996/chirpy/internal/database"
+	"github.com/nickemp1996/chirpy/internal/logging"
+)
+
+// requireAdmin authenticates the bearer token and checks the account has the
+// admin role. The role is read from the database rather than the token, so
+// demoting someone takes effect immediately.
+func (cfg *apiConfig) requireAdmin(r *http.Request) (database.User, error) {
+	tokenString, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		return database.User{}, apierror.Unauthorized("token missing", err)
+	}
+
+	validUser, err := auth.ValidateJWT(tokenString, cfg.secret)
+	if err != nil {
+		return database.User{}, apierror.Unauthorized("invalid or expired token", err)
+	}
+
+	logging.SetUserID(r.Context(), validUser)
+
+	dbUser, err := cfg.queries.GetUser(r.Context(), validUser)
+	if err != nil {
+		return database.User{}, apierror.Unauthorized("invalid or expired token", err)
+	}
+
+	if dbUser.Role != roleAdmin {
+		return database.User{}, apierror.Forbidden("admin role required", nil)
+	}
+
+	return dbUser, nil
+}
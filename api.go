@@ -2,26 +2,20 @@ package main
 
 import (
 	"database/sql"
-	"encoding/json"
 	"fmt"
-	"log"
 	"net/http"
 	"sort"
 	"strings"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/nickemp1996/chirpy/internal/apierror"
 	"github.com/nickemp1996/chirpy/internal/auth"
 	"github.com/nickemp1996/chirpy/internal/database"
+	"github.com/nickemp1996/chirpy/internal/httpjson"
+	"github.com/nickemp1996/chirpy/internal/logging"
 )
 
-func (cfg *apiConfig) middlewareMetricsInc(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		cfg.fileserverHits.Add(1)
-		next.ServeHTTP(w, r)
-	})
-}
-
 func (cfg *apiConfig) getFileserverHits(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 	w.WriteHeader(http.StatusOK)
@@ -30,27 +24,27 @@ func (cfg *apiConfig) getFileserverHits(w http.ResponseWriter, r *http.Request)
 							    <h1>Welcome, Chirpy Admin</h1>
 							    <p>Chirpy has been visited %d times!</p>
 							  </body>
-							</html>`, cfg.fileserverHits.Load())
+							</html>`, cfg.metrics.fileserverHits.Value())
 	_, err := w.Write([]byte(message))
 	if err != nil {
-		log.Printf("Error writing response: %v", err)
+		logging.FromContext(r.Context()).Error("error writing response", "err", err)
 	}
 }
 
 func (cfg *apiConfig) reset(w http.ResponseWriter, r *http.Request) {
-	if cfg.platform != "dev" {
-		respondWithError(w, 403, "Access denied", nil)
+	if !cfg.dev {
+		respondWithError(w, r, apierror.Forbidden("reset is only available in development", nil))
 		return
 	}
-	cfg.fileserverHits.Store(0)
+	cfg.metrics.fileserverHits.Reset()
 	err := cfg.queries.DeleteUsers(r.Context())
 	if err != nil {
-		respondWithError(w, 500, "internal error", err)
+		respondWithError(w, r, err)
 		return
 	}
 	err = cfg.queries.DeleteChirps(r.Context())
 	if err != nil {
-		respondWithError(w, 500, "internal error", err)
+		respondWithError(w, r, err)
 		return
 	}
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
@@ -63,40 +57,48 @@ func (cfg *apiConfig) addUser(w http.ResponseWriter, r *http.Request) {
 		Password string `json:"password"`
 	}
 
-	decoder := json.NewDecoder(r.Body)
 	params := parameters{}
-	err := decoder.Decode(&params)
+	err := httpjson.Decode(w, r, &params, maxUserBodySize)
 	if err != nil {
 		// an error will be thrown if the JSON is invalid or has the wrong types
 		// any missing fields will simply have their values in the struct set to their zero value
-		respondWithError(w, 500, "internal error", err)
+		respondWithError(w, r, err)
+		return
+	}
+
+	email, err := normalizeEmail(params.Email)
+	if err != nil {
+		respondWithError(w, r, err)
 		return
 	}
 
 	hashedPassword, err := auth.HashPassword(params.Password)
 	if err != nil {
-		respondWithError(w, 500, "internal error", err)
+		respondWithError(w, r, err)
 		return
 	}
 
 	userParams := database.CreateUserParams{
-		Email:          params.Email,
-		HashedPassword: hashedPassword,
+		Email:          email,
+		HashedPassword: sql.NullString{String: hashedPassword, Valid: true},
 	}
 
 	dbUser, err := cfg.queries.CreateUser(r.Context(), userParams)
 	if err != nil {
-		respondWithError(w, 500, "internal error", err)
+		if _, ok := apierror.UniqueViolation(err); ok {
+			err = apierror.Conflict("an account with this email already exists", err)
+		}
+		respondWithError(w, r, err)
 		return
 	}
+	cfg.metrics.signups.Inc()
 
-	user := User{
-		ID:          dbUser.ID,
-		CreatedAt:   dbUser.CreatedAt,
-		UpdatedAt:   dbUser.UpdatedAt,
-		Email:       dbUser.Email,
-		IsChirpyRed: dbUser.IsChirpyRed,
-	}
+	cfg.publishEvent(r.Context(), eventUserCreated, struct {
+		ID        uuid.UUID `json:"id"`
+		CreatedAt time.Time `json:"created_at"`
+	}{dbUser.ID, dbUser.CreatedAt})
+
+	user := userFromDB(dbUser)
 
 	respondWithJSON(w, 201, user)
 }
@@ -104,60 +106,60 @@ func (cfg *apiConfig) addUser(w http.ResponseWriter, r *http.Request) {
 func (cfg *apiConfig) updateUserLogin(w http.ResponseWriter, r *http.Request) {
 	tokenString, err := auth.GetBearerToken(r.Header)
 	if err != nil {
-		respondWithError(w, 401, "token missing", err)
+		respondWithError(w, r, apierror.Unauthorized("token missing", err))
 		return
 	}
 
 	validUser, err := auth.ValidateJWT(tokenString, cfg.secret)
 	if err != nil {
-		if strings.Contains(err.Error(), "invalid token") {
-			respondWithError(w, 401, "Unauthorized", err)
-			return
-		}
-		respondWithError(w, 500, "internal error", err)
+		respondWithError(w, r, apierror.Unauthorized("invalid or expired token", err))
 		return
 	}
 
+	logging.SetUserID(r.Context(), validUser)
+
 	type parameters struct {
 		Email    string `json:"email"`
 		Password string `json:"password"`
 	}
 
-	decoder := json.NewDecoder(r.Body)
 	params := parameters{}
-	err = decoder.Decode(&params)
+	err = httpjson.Decode(w, r, &params, maxUserBodySize)
 	if err != nil {
 		// an error will be thrown if the JSON is invalid or has the wrong types
 		// any missing fields will simply have their values in the struct set to their zero value
-		respondWithError(w, 500, "internal error", err)
+		respondWithError(w, r, err)
+		return
+	}
+
+	email, err := normalizeEmail(params.Email)
+	if err != nil {
+		respondWithError(w, r, err)
 		return
 	}
 
 	hashedPassword, err := auth.HashPassword(params.Password)
 	if err != nil {
-		respondWithError(w, 500, "internal error", err)
+		respondWithError(w, r, err)
 		return
 	}
 
 	userParams := database.UpdateUserParams{
-		Email:          params.Email,
-		HashedPassword: hashedPassword,
+		Email:          email,
+		HashedPassword: sql.NullString{String: hashedPassword, Valid: true},
 		ID:             validUser,
 	}
 
 	dbUser, err := cfg.queries.UpdateUser(r.Context(), userParams)
 	if err != nil {
-		respondWithError(w, 500, "internal error", err)
+		if _, ok := apierror.UniqueViolation(err); ok {
+			err = apierror.Conflict("an account with this email already exists", err)
+		}
+		respondWithError(w, r, err)
 		return
 	}
 
-	user := User{
-		ID:          dbUser.ID,
-		CreatedAt:   dbUser.CreatedAt,
-		UpdatedAt:   dbUser.UpdatedAt,
-		Email:       dbUser.Email,
-		IsChirpyRed: dbUser.IsChirpyRed,
-	}
+	user := userFromDB(dbUser)
 
 	respondWithJSON(w, 200, user)
 }
@@ -168,39 +170,48 @@ func (cfg *apiConfig) userLogin(w http.ResponseWriter, r *http.Request) {
 		Password string `json:"password"`
 	}
 
-	decoder := json.NewDecoder(r.Body)
 	params := parameters{}
-	err := decoder.Decode(&params)
+	err := httpjson.Decode(w, r, &params, maxUserBodySize)
 	if err != nil {
-		respondWithError(w, 500, "internal error", err)
+		respondWithError(w, r, err)
 		return
 	}
 
-	dbUser, err := cfg.queries.GetPassword(r.Context(), params.Email)
+	dbUser, err := cfg.queries.GetPassword(r.Context(), strings.ToLower(strings.TrimSpace(params.Email)))
 	if err != nil {
 		if err == sql.ErrNoRows {
-			respondWithError(w, 401, "Incorrect email or password", err)
+			cfg.metrics.loginsFailed.Inc()
+			respondWithError(w, r, apierror.New(http.StatusUnauthorized, apierror.CodeInvalidCredentials, "incorrect email or password", err))
 			return
 		} else {
-			respondWithError(w, 500, "internal error", err)
+			respondWithError(w, r, err)
 			return
 		}
 	}
 
-	valid, err := auth.CheckPasswordHash(params.Password, dbUser.HashedPassword)
+	valid, err := checkPassword(dbUser, params.Password)
 	if err != nil {
-		respondWithError(w, 500, "internal error", err)
+		respondWithError(w, r, err)
 		return
 	}
 
 	if !valid {
-		respondWithError(w, 401, "Incorrect email or password", nil)
+		cfg.metrics.loginsFailed.Inc()
+		respondWithError(w, r, apierror.New(http.StatusUnauthorized, apierror.CodeInvalidCredentials, "incorrect email or password", nil))
 		return
 	}
 
-	tokenString, err := auth.MakeJWT(dbUser.ID, cfg.secret)
+	cfg.respondWithLogin(w, r, dbUser)
+}
+
+// respondWithLogin issues a new access and refresh token pair, however the
+// user proved who they are.
+func (cfg *apiConfig) respondWithLogin(w http.ResponseWriter, r *http.Request, dbUser database.User) {
+	logging.SetUserID(r.Context(), dbUser.ID)
+
+	tokenString, err := auth.MakeJWT(dbUser.ID, cfg.secret, cfg.accessTokenTTL)
 	if err != nil {
-		respondWithError(w, 500, "internal error", err)
+		respondWithError(w, r, err)
 		return
 	}
 
@@ -209,86 +220,141 @@ func (cfg *apiConfig) userLogin(w http.ResponseWriter, r *http.Request) {
 	addRefreshTokenParams := database.AddRefreshTokenParams{
 		Token:     refreshToken,
 		UserID:    dbUser.ID,
-		ExpiresAt: time.Now().Add(time.Hour * 24 * 60),
+		ExpiresAt: time.Now().Add(cfg.refreshTokenTTL),
 	}
 
 	dbRefreshToken, err := cfg.queries.AddRefreshToken(r.Context(), addRefreshTokenParams)
 	if err != nil {
-		respondWithError(w, 500, "internal error", err)
+		respondWithError(w, r, err)
 		return
 	}
 
-	fmt.Println("Token:", dbRefreshToken.Token)
-	fmt.Println("Expires at:", dbRefreshToken.ExpiresAt)
-
-	user := User{
-		ID:           dbUser.ID,
-		CreatedAt:    dbUser.CreatedAt,
-		UpdatedAt:    dbUser.UpdatedAt,
-		Email:        dbUser.Email,
-		Token:        tokenString,
-		RefreshToken: dbRefreshToken.Token,
-		IsChirpyRed:  dbUser.IsChirpyRed,
-	}
+	user := userFromDB(dbUser)
+	user.Token = tokenString
+	user.RefreshToken = dbRefreshToken.Token
 
 	respondWithJSON(w, 200, user)
 }
 
 func (cfg *apiConfig) createChirp(w http.ResponseWriter, r *http.Request) {
 	type parameters struct {
-		Body string `json:"body"`
+		Body        string      `json:"body"`
+		Attachments []uuid.UUID `json:"attachments"`
 	}
 
-	decoder := json.NewDecoder(r.Body)
 	params := parameters{}
-	err := decoder.Decode(&params)
+	err := httpjson.Decode(w, r, &params, maxChirpBodySize)
 	if err != nil {
 		// an error will be thrown if the JSON is invalid or has the wrong types
 		// any missing fields will simply have their values in the struct set to their zero value
-		respondWithError(w, 500, "internal error", err)
+		respondWithError(w, r, err)
 		return
 	}
 
-	tokenString, err := auth.GetBearerToken(r.Header)
+	caller, err := cfg.authenticate(r, scopeChirpsWrite)
 	if err != nil {
-		respondWithError(w, 401, "no token", err)
+		respondWithError(w, r, err)
 		return
 	}
+	validUser := caller.UserID
 
-	validUser, err := auth.ValidateJWT(tokenString, cfg.secret)
+	dbUser, err := cfg.queries.GetUser(r.Context(), validUser)
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	err = cfg.rateLimit(dbUser, caller)
 	if err != nil {
-		if strings.Contains(err.Error(), "invalid token") {
-			respondWithError(w, 401, "Unauthorized", err)
+		respondWithError(w, r, err)
+		return
+	}
+
+	err = checkChirpLength(params.Body, cfg.entitlements(dbUser))
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	if len(params.Attachments) > maxChirpAttachments {
+		respondWithError(w, r, apierror.Field("attachments", fmt.Sprintf("a chirp can have at most %d attachments", maxChirpAttachments)))
+		return
+	}
+
+	for _, mediaID := range params.Attachments {
+		dbMedia, err := cfg.queries.GetMediaFile(r.Context(), mediaID)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				respondWithError(w, r, apierror.Field("attachments", "attachment "+mediaID.String()+" not found"))
+				return
+			}
+			respondWithError(w, r, err)
 			return
 		}
-		respondWithError(w, 500, "internal error", err)
+
+		if dbMedia.UserID != validUser || dbMedia.Kind != mediaKindChirp {
+			respondWithError(w, r, apierror.Field("attachments", "attachment "+mediaID.String()+" not found"))
+			return
+		}
+	}
+
+	tx, err := cfg.db.BeginTx(r.Context(), nil)
+	if err != nil {
+		respondWithError(w, r, err)
 		return
 	}
+	defer tx.Rollback()
+	qtx := cfg.withTx(tx)
 
-	if len(params.Body) > 140 {
-		respondWithError(w, 400, "chirp too long", nil)
-	} else {
-		chirpParams := database.CreateChirpParams{
-			Body:   replaceBadWords(params.Body),
-			UserID: validUser,
+	chirpParams := database.CreateChirpParams{
+		Body:   replaceBadWords(params.Body),
+		UserID: validUser,
+	}
+
+	dbChirp, err := qtx.CreateChirp(r.Context(), chirpParams)
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	for i, mediaID := range params.Attachments {
+		attachmentParams := database.AddChirpAttachmentParams{
+			ChirpID:  dbChirp.ID,
+			MediaID:  mediaID,
+			Position: int32(i),
 		}
 
-		dbChirp, err1 := cfg.queries.CreateChirp(r.Context(), chirpParams)
-		if err1 != nil {
-			respondWithError(w, 500, "internal error", err)
+		err = qtx.AddChirpAttachment(r.Context(), attachmentParams)
+		if err != nil {
+			respondWithError(w, r, err)
 			return
 		}
+	}
 
-		chirp := Chirp{
-			ID:        dbChirp.ID,
-			CreatedAt: dbChirp.CreatedAt,
-			UpdatedAt: dbChirp.UpdatedAt,
-			Body:      dbChirp.Body,
-			UserID:    dbChirp.UserID,
-		}
+	err = tx.Commit()
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+	cfg.metrics.chirpsCreated.Inc()
+
+	chirps := []Chirp{{
+		ID:        dbChirp.ID,
+		CreatedAt: dbChirp.CreatedAt,
+		UpdatedAt: dbChirp.UpdatedAt,
+		Body:      dbChirp.Body,
+		UserID:    dbChirp.UserID,
+	}}
 
-		respondWithJSON(w, 201, chirp)
+	err = cfg.loadAttachments(r.Context(), chirps)
+	if err != nil {
+		respondWithError(w, r, err)
+		return
 	}
+
+	cfg.publishEvent(r.Context(), eventChirpCreated, chirps[0])
+
+	respondWithJSON(w, 201, chirps[0])
 }
 
 func (cfg *apiConfig) getChirps(w http.ResponseWriter, r *http.Request) {
@@ -301,20 +367,15 @@ func (cfg *apiConfig) getChirps(w http.ResponseWriter, r *http.Request) {
 	} else {
 		userID, err1 := uuid.Parse(s)
 		if err1 != nil {
-			respondWithError(w, 500, "internal error", err)
+			respondWithError(w, r, apierror.InvalidID("author_id must be a UUID", err1))
 			return
 		}
 		dbChirps, err = cfg.queries.GetUserChirps(r.Context(), userID)
 	}
 
 	if err != nil {
-		if err == sql.ErrNoRows {
-			respondWithError(w, 404, "no chirps found", err)
-			return
-		} else {
-			respondWithError(w, 500, "internal error", err)
-			return
-		}
+		respondWithError(w, r, err)
+		return
 	}
 
 	s = r.URL.Query().Get("sort")
@@ -331,68 +392,164 @@ func (cfg *apiConfig) getChirps(w http.ResponseWriter, r *http.Request) {
 		chirps[i].UserID = dbChirp.UserID
 	}
 
+	err = cfg.loadAttachments(r.Context(), chirps)
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
 	respondWithJSON(w, 200, chirps)
 }
 
 func (cfg *apiConfig) getChirp(w http.ResponseWriter, r *http.Request) {
 	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
 	if err != nil {
-		respondWithError(w, 404, "Invalid UUID format", err)
+		respondWithError(w, r, apierror.InvalidID("chirpID must be a UUID", err))
 		return
 	}
 
 	dbChirp, err := cfg.queries.GetChirp(r.Context(), chirpID)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			respondWithError(w, 404, "chirp not found", err)
+			respondWithError(w, r, apierror.NotFound("chirp not found", err))
 			return
 		} else {
-			respondWithError(w, 500, "internal error", err)
+			respondWithError(w, r, err)
 			return
 		}
 	}
 
-	chirp := Chirp{
+	chirps := []Chirp{{
 		ID:        dbChirp.ID,
 		CreatedAt: dbChirp.CreatedAt,
 		UpdatedAt: dbChirp.UpdatedAt,
 		Body:      dbChirp.Body,
 		UserID:    dbChirp.UserID,
+	}}
+
+	err = cfg.loadAttachments(r.Context(), chirps)
+	if err != nil {
+		respondWithError(w, r, err)
+		return
 	}
 
-	respondWithJSON(w, 200, chirp)
+	respondWithJSON(w, 200, chirps[0])
 }
 
-func (cfg *apiConfig) deleteChirp(w http.ResponseWriter, r *http.Request) {
+// editChirp replaces a chirp's body. Attachments stay as they are; editing is
+// a Red feature, so the author's plan decides both access and length.
+func (cfg *apiConfig) editChirp(w http.ResponseWriter, r *http.Request) {
 	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
 	if err != nil {
-		respondWithError(w, 404, "Invalid UUID format", err)
+		respondWithError(w, r, apierror.InvalidID("chirpID must be a UUID", err))
 		return
 	}
 
-	tokenString, err := auth.GetBearerToken(r.Header)
+	type parameters struct {
+		Body string `json:"body"`
+	}
+
+	params := parameters{}
+	err = httpjson.Decode(w, r, &params, maxChirpBodySize)
 	if err != nil {
-		respondWithError(w, 401, "no token", err)
+		respondWithError(w, r, err)
 		return
 	}
 
-	validUser, err := auth.ValidateJWT(tokenString, cfg.secret)
+	caller, err := cfg.authenticate(r, scopeChirpsWrite)
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+	validUser := caller.UserID
+
+	dbUser, err := cfg.queries.GetUser(r.Context(), validUser)
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	ent := cfg.entitlements(dbUser)
+	if !ent.EditChirps {
+		respondWithError(w, r, apierror.UpgradeRequired("editing chirps requires Chirpy Red"))
+		return
+	}
+
+	err = cfg.rateLimit(dbUser, caller)
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	err = checkChirpLength(params.Body, ent)
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	dbChirp, err := cfg.queries.GetChirp(r.Context(), chirpID)
 	if err != nil {
-		if strings.Contains(err.Error(), "invalid token") {
-			respondWithError(w, 403, "Unauthorized", err)
+		if err == sql.ErrNoRows {
+			respondWithError(w, r, apierror.NotFound("chirp not found", err))
+			return
+		} else {
+			respondWithError(w, r, err)
 			return
 		}
-		respondWithError(w, 500, "internal error", err)
+	}
+
+	if dbChirp.UserID != validUser {
+		respondWithError(w, r, apierror.Forbidden("only the author can edit a chirp", nil))
+		return
+	}
+
+	dbChirp, err = cfg.queries.UpdateChirpBody(r.Context(), database.UpdateChirpBodyParams{
+		ID:   chirpID,
+		Body: replaceBadWords(params.Body),
+	})
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	chirps := []Chirp{{
+		ID:        dbChirp.ID,
+		CreatedAt: dbChirp.CreatedAt,
+		UpdatedAt: dbChirp.UpdatedAt,
+		Body:      dbChirp.Body,
+		UserID:    dbChirp.UserID,
+	}}
+
+	err = cfg.loadAttachments(r.Context(), chirps)
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	respondWithJSON(w, 200, chirps[0])
+}
+
+func (cfg *apiConfig) deleteChirp(w http.ResponseWriter, r *http.Request) {
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		respondWithError(w, r, apierror.InvalidID("chirpID must be a UUID", err))
+		return
+	}
+
+	caller, err := cfg.authenticate(r, scopeChirpsWrite)
+	if err != nil {
+		respondWithError(w, r, err)
 		return
 	}
+	validUser := caller.UserID
 
 	dbChirp, err := cfg.queries.GetChirp(r.Context(), chirpID)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			respondWithError(w, 404, "chirp not found", err)
+			respondWithError(w, r, apierror.NotFound("chirp not found", err))
 			return
 		} else {
-			respondWithError(w, 500, "internal error", err)
+			respondWithError(w, r, err)
 			return
 		}
 	}
@@ -400,12 +557,16 @@ func (cfg *apiConfig) deleteChirp(w http.ResponseWriter, r *http.Request) {
 	if validUser == dbChirp.UserID {
 		err = cfg.queries.DeleteChirp(r.Context(), chirpID)
 		if err != nil {
-			respondWithError(w, 500, "internal error", err)
+			respondWithError(w, r, err)
 			return
 		}
+		cfg.publishEvent(r.Context(), eventChirpDeleted, struct {
+			ID     uuid.UUID `json:"id"`
+			UserID uuid.UUID `json:"user_id"`
+		}{dbChirp.ID, dbChirp.UserID})
 		w.WriteHeader(204)
 	} else {
-		respondWithError(w, 403, "Unauthorized", err)
+		respondWithError(w, r, apierror.Forbidden("only the author can delete a chirp", nil))
 		return
 	}
 }
@@ -413,29 +574,29 @@ func (cfg *apiConfig) deleteChirp(w http.ResponseWriter, r *http.Request) {
 func (cfg *apiConfig) refresh(w http.ResponseWriter, r *http.Request) {
 	refreshTokenString, err := auth.GetBearerToken(r.Header)
 	if err != nil {
-		respondWithError(w, 401, "no token", err)
+		respondWithError(w, r, apierror.Unauthorized("token missing", err))
 		return
 	}
 
 	dbRefreshToken, err := cfg.queries.GetUserFromRefreshToken(r.Context(), refreshTokenString)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			respondWithError(w, 401, "user does not exist", err)
+			respondWithError(w, r, apierror.Unauthorized("invalid refresh token", err))
 			return
 		} else {
-			respondWithError(w, 500, "internal error", err)
+			respondWithError(w, r, err)
 			return
 		}
 	}
 
 	if dbRefreshToken.ExpiresAt.Compare(time.Now()) <= 0 || dbRefreshToken.RevokedAt.Valid {
-		respondWithError(w, 401, "user access not allowed", err)
+		respondWithError(w, r, apierror.Unauthorized("refresh token expired or revoked", nil))
 		return
 	}
 
-	tokenString, err := auth.MakeJWT(dbRefreshToken.UserID, cfg.secret)
+	tokenString, err := auth.MakeJWT(dbRefreshToken.UserID, cfg.secret, cfg.accessTokenTTL)
 	if err != nil {
-		respondWithError(w, 500, "internal error", err)
+		respondWithError(w, r, err)
 		return
 	}
 
@@ -453,13 +614,13 @@ func (cfg *apiConfig) refresh(w http.ResponseWriter, r *http.Request) {
 func (cfg *apiConfig) revoke(w http.ResponseWriter, r *http.Request) {
 	refreshTokenString, err := auth.GetBearerToken(r.Header)
 	if err != nil {
-		respondWithError(w, 401, "no token", err)
+		respondWithError(w, r, apierror.Unauthorized("token missing", err))
 		return
 	}
 
 	err = cfg.queries.RevokeRefreshToken(r.Context(), refreshTokenString)
 	if err != nil {
-		respondWithError(w, 500, "internal error", err)
+		respondWithError(w, r, err)
 		return
 	}
 
@@ -0,0 +1,299 @@
+package main
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"fmt"
+	"math"
+	"net/http"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/nickemp1996/chirpy/internal/apierror"
+	"github.com/nickemp1996/chirpy/internal/auth"
+	"github.com/nickemp1996/chirpy/internal/database"
+	"github.com/nickemp1996/chirpy/internal/httpjson"
+	"github.com/nickemp1996/chirpy/internal/logging"
+)
+
+// Scopes a personal API key can be granted. Access tokens can do everything.
+const (
+	scopeChirpsWrite = "chirps:write"
+	scopeMediaWrite  = "media:write"
+)
+
+var apiKeyScopes = []string{scopeChirpsWrite, scopeMediaWrite}
+
+const (
+	maxAPIKeys          = 20
+	maxAPIKeyNameLength = 50
+)
+
+// principal is who a request acts for.
+type principal struct {
+	UserID uuid.UUID
+	// APIKey is set when the request used a personal API key rather than an
+	// access token.
+	APIKey *database.ApiKey
+}
+
+// authenticate accepts an access token, a personal API key holding scope, or
+// an access token issued to an OAuth client with scope. Only endpoints bots
+// and apps need call this; the rest stay access token only.
+func (cfg *apiConfig) authenticate(r *http.Request, scope string) (principal, error) {
+	if strings.HasPrefix(r.Header.Get("Authorization"), "ApiKey ") {
+		return cfg.authenticateAPIKey(r, scope)
+	}
+
+	tokenString, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		return principal{}, apierror.Unauthorized("token missing", err)
+	}
+
+	claims, err := auth.ParseJWT(tokenString, cfg.secret)
+	if err != nil {
+		return principal{}, apierror.Unauthorized("invalid or expired token", err)
+	}
+
+	validUser, err := claims.UserID()
+	if err != nil {
+		return principal{}, apierror.Unauthorized("invalid or expired token", err)
+	}
+
+	logging.SetUserID(r.Context(), validUser)
+
+	if claims.Scoped() {
+		err = cfg.checkOAuthGrant(r.Context(), claims, scope)
+		if err != nil {
+			return principal{}, err
+		}
+	}
+
+	return principal{UserID: validUser}, nil
+}
+
+func (cfg *apiConfig) authenticateAPIKey(r *http.Request, scope string) (principal, error) {
+	key, err := auth.GetAPIKey(r.Header)
+	if err != nil {
+		return principal{}, apierror.Unauthorized("api key missing", err)
+	}
+
+	prefix, err := auth.APIKeyPrefix(key)
+	if err != nil {
+		return principal{}, apierror.Unauthorized("invalid api key", err)
+	}
+
+	dbKey, err := cfg.queries.GetAPIKeyByPrefix(r.Context(), prefix)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return principal{}, apierror.Unauthorized("invalid api key", err)
+		}
+		return principal{}, err
+	}
+
+	if subtle.ConstantTimeCompare([]byte(auth.HashAPIKey(key)), []byte(dbKey.KeyHash)) != 1 {
+		return principal{}, apierror.Unauthorized("invalid api key", nil)
+	}
+	if dbKey.RevokedAt.Valid {
+		return principal{}, apierror.Unauthorized("api key has been revoked", nil)
+	}
+
+	logging.SetUserID(r.Context(), dbKey.UserID)
+
+	if !slices.Contains(dbKey.Scopes, scope) {
+		return principal{}, apierror.Forbidden("api key lacks the "+scope+" scope", nil)
+	}
+
+	err = cfg.queries.TouchAPIKey(r.Context(), dbKey.ID)
+	if err != nil {
+		// last used is informational, don't fail the request over it
+		logging.FromContext(r.Context()).Warn("error recording api key use", "api_key_id", dbKey.ID, "err", err)
+	}
+
+	return principal{UserID: dbKey.UserID, APIKey: &dbKey}, nil
+}
+
+func apiKeyFromDB(dbKey database.ApiKey) APIKey {
+	key := APIKey{
+		ID:        dbKey.ID,
+		CreatedAt: dbKey.CreatedAt,
+		Name:      dbKey.Name,
+		Prefix:    dbKey.Prefix,
+		Scopes:    dbKey.Scopes,
+		RateLimit: int(dbKey.RateLimit.Int32),
+	}
+	if dbKey.LastUsedAt.Valid {
+		key.LastUsedAt = &dbKey.LastUsedAt.Time
+	}
+	if dbKey.RevokedAt.Valid {
+		key.RevokedAt = &dbKey.RevokedAt.Time
+	}
+	return key
+}
+
+func (cfg *apiConfig) createAPIKey(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Name      string   `json:"name"`
+		Scopes    []string `json:"scopes"`
+		RateLimit *int     `json:"rate_limit"`
+	}
+
+	params := parameters{}
+	err := httpjson.Decode(w, r, &params, maxUserBodySize)
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	tokenString, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, r, apierror.Unauthorized("token missing", err))
+		return
+	}
+
+	validUser, err := auth.ValidateJWT(tokenString, cfg.secret)
+	if err != nil {
+		respondWithError(w, r, apierror.Unauthorized("invalid or expired token", err))
+		return
+	}
+
+	logging.SetUserID(r.Context(), validUser)
+
+	var fields []apierror.FieldError
+
+	name := strings.TrimSpace(params.Name)
+	if name == "" || utf8.RuneCountInString(name) > maxAPIKeyNameLength {
+		fields = append(fields, apierror.FieldError{Field: "name", Message: fmt.Sprintf("must be between 1 and %d characters", maxAPIKeyNameLength)})
+	}
+
+	var scopes []string
+	if len(params.Scopes) == 0 {
+		fields = append(fields, apierror.FieldError{Field: "scopes", Message: "must list at least one scope"})
+	}
+	for _, scope := range params.Scopes {
+		if !slices.Contains(apiKeyScopes, scope) {
+			fields = append(fields, apierror.FieldError{Field: "scopes", Message: fmt.Sprintf("unknown scope %q, must be chirps:write or media:write", scope)})
+			break
+		}
+		if !slices.Contains(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+
+	var rateLimit sql.NullInt32
+	if params.RateLimit != nil {
+		// capped by the plan when used, this only keeps it storable
+		if *params.RateLimit < 1 || *params.RateLimit > math.MaxInt32 {
+			fields = append(fields, apierror.FieldError{Field: "rate_limit", Message: fmt.Sprintf("must be between 1 and %d requests per minute", math.MaxInt32)})
+		}
+		rateLimit = sql.NullInt32{Int32: int32(*params.RateLimit), Valid: true}
+	}
+
+	if len(fields) > 0 {
+		respondWithError(w, r, apierror.Validation(fields...))
+		return
+	}
+
+	count, err := cfg.queries.CountUserAPIKeys(r.Context(), validUser)
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+	if count >= maxAPIKeys {
+		respondWithError(w, r, apierror.Conflict(fmt.Sprintf("an account can have at most %d active api keys", maxAPIKeys), nil))
+		return
+	}
+
+	key, prefix, err := auth.MakeAPIKey()
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	dbKey, err := cfg.queries.CreateAPIKey(r.Context(), database.CreateAPIKeyParams{
+		UserID:    validUser,
+		Name:      name,
+		Prefix:    prefix,
+		KeyHash:   auth.HashAPIKey(key),
+		Scopes:    scopes,
+		RateLimit: rateLimit,
+	})
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	// the key is only ever shown here
+	apiKey := apiKeyFromDB(dbKey)
+	apiKey.Key = key
+
+	respondWithJSON(w, 201, apiKey)
+}
+
+func (cfg *apiConfig) getAPIKeys(w http.ResponseWriter, r *http.Request) {
+	tokenString, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, r, apierror.Unauthorized("token missing", err))
+		return
+	}
+
+	validUser, err := auth.ValidateJWT(tokenString, cfg.secret)
+	if err != nil {
+		respondWithError(w, r, apierror.Unauthorized("invalid or expired token", err))
+		return
+	}
+
+	logging.SetUserID(r.Context(), validUser)
+
+	dbKeys, err := cfg.queries.GetUserAPIKeys(r.Context(), validUser)
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	keys := make([]APIKey, len(dbKeys))
+	for i, dbKey := range dbKeys {
+		keys[i] = apiKeyFromDB(dbKey)
+	}
+
+	respondWithJSON(w, 200, keys)
+}
+
+func (cfg *apiConfig) revokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	keyID, err := uuid.Parse(r.PathValue("keyID"))
+	if err != nil {
+		respondWithError(w, r, apierror.InvalidID("keyID must be a UUID", err))
+		return
+	}
+
+	tokenString, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, r, apierror.Unauthorized("token missing", err))
+		return
+	}
+
+	validUser, err := auth.ValidateJWT(tokenString, cfg.secret)
+	if err != nil {
+		respondWithError(w, r, apierror.Unauthorized("invalid or expired token", err))
+		return
+	}
+
+	logging.SetUserID(r.Context(), validUser)
+
+	revoked, err := cfg.queries.RevokeAPIKey(r.Context(), database.RevokeAPIKeyParams{
+		ID:     keyID,
+		UserID: validUser,
+	})
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+	if revoked == 0 {
+		respondWithError(w, r, apierror.NotFound("api key not found", nil))
+		return
+	}
+
+	w.WriteHeader(204)
+}
@@ -0,0 +1,359 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nickemp1996/chirpy/internal/auth"
+	"github.com/nickemp1996/chirpy/internal/config"
+	"github.com/nickemp1996/chirpy/internal/database"
+)
+
+const (
+	roleUser  = "user"
+	roleAdmin = "admin"
+)
+
+// adminCLI runs the operational subcommands against the same queries the
+// server uses, so there is no raw SQL to get wrong at 3am.
+type adminCLI struct {
+	cfg     *config.Config
+	db      *sql.DB
+	queries *database.Queries
+	out     io.Writer
+}
+
+func (c *adminCLI) run(ctx context.Context, cmd string, args []string) error {
+	switch cmd {
+	case "user":
+		return c.user(ctx, args)
+	case "chirp":
+		return c.chirp(ctx, args)
+	case "seed":
+		return c.seed(ctx, args)
+	case "reset":
+		return c.reset(ctx, args)
+	default:
+		return fmt.Errorf("unknown command %q", cmd)
+	}
+}
+
+// lookupUser accepts a user id, an email or a handle with or without the @.
+func (c *adminCLI) lookupUser(ctx context.Context, ref string) (database.User, error) {
+	var user database.User
+	var err error
+
+	if id, parseErr := uuid.Parse(ref); parseErr == nil {
+		user, err = c.queries.GetUser(ctx, id)
+	} else if strings.Contains(ref, "@") && !strings.HasPrefix(ref, "@") {
+		user, err = c.queries.GetPassword(ctx, ref)
+	} else {
+		handle := strings.ToLower(strings.TrimPrefix(ref, "@"))
+		user, err = c.queries.GetUserByHandle(ctx, sql.NullString{String: handle, Valid: true})
+	}
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return database.User{}, fmt.Errorf("no user matches %q", ref)
+	}
+
+	return user, err
+}
+
+func (c *adminCLI) printUser(user database.User) {
+	tw := tabwriter.NewWriter(c.out, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "id\t%s\n", user.ID)
+	fmt.Fprintf(tw, "email\t%s\n", user.Email)
+	fmt.Fprintf(tw, "handle\t%s\n", user.Handle.String)
+	fmt.Fprintf(tw, "display name\t%s\n", user.DisplayName)
+	fmt.Fprintf(tw, "role\t%s\n", user.Role)
+	fmt.Fprintf(tw, "chirpy red\t%t\n", user.IsChirpyRed)
+	fmt.Fprintf(tw, "created\t%s\n", user.CreatedAt.Format(time.RFC3339))
+	fmt.Fprintf(tw, "updated\t%s\n", user.UpdatedAt.Format(time.RFC3339))
+	tw.Flush()
+}
+
+const userUsage = `usage: chirpy user <command> <user>
+
+<user> is an id, an email or a @handle.
+
+commands:
+  show <user>                  print the account
+  set-red <user> true|false    grant or remove Chirpy Red
+  set-role <user> user|admin   change the account's role
+  revoke-sessions <user>       revoke every refresh token and oauth grant
+`
+
+func (c *adminCLI) user(ctx context.Context, args []string) error {
+	if len(args) < 2 {
+		return errors.New(userUsage)
+	}
+
+	user, err := c.lookupUser(ctx, args[1])
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "show":
+		stats, err := c.queries.GetUserStats(ctx, user.ID)
+		if err != nil {
+			return err
+		}
+		subs, err := c.queries.GetUserSubscriptions(ctx, user.ID)
+		if err != nil {
+			return err
+		}
+		c.printUser(user)
+		fmt.Fprintf(c.out, "chirps: %d, followers: %d, following: %d\n", stats.ChirpCount, stats.FollowerCount, stats.FollowingCount)
+		for _, sub := range subs {
+			periodEnd := "open ended"
+			if sub.CurrentPeriodEnd.Valid {
+				periodEnd = "until " + sub.CurrentPeriodEnd.Time.Format(time.RFC3339)
+			}
+			fmt.Fprintf(c.out, "subscription: %s via %s, %s, %s\n", sub.Plan, sub.Provider, sub.Status, periodEnd)
+		}
+		return nil
+
+	case "set-red":
+		if len(args) != 3 {
+			return errors.New(userUsage)
+		}
+		red, err := strconv.ParseBool(args[2])
+		if err != nil {
+			return fmt.Errorf("set-red takes true or false, got %q", args[2])
+		}
+		err = c.setChirpyRed(ctx, user, red)
+		if err != nil {
+			return err
+		}
+		return c.user(ctx, []string{"show", user.ID.String()})
+
+	case "set-role":
+		if len(args) != 3 {
+			return errors.New(userUsage)
+		}
+		role := args[2]
+		if role != roleUser && role != roleAdmin {
+			return fmt.Errorf("role must be %s or %s, got %q", roleUser, roleAdmin, role)
+		}
+		user, err = c.queries.SetUserRole(ctx, database.SetUserRoleParams{ID: user.ID, Role: role})
+		if err != nil {
+			return err
+		}
+		c.printUser(user)
+		return nil
+
+	case "revoke-sessions":
+		tokens, err := c.queries.RevokeUserRefreshTokens(ctx, user.ID)
+		if err != nil {
+			return err
+		}
+		// third party apps hold refresh tokens of their own through grants
+		grants, err := c.queries.RevokeUserOAuthGrants(ctx, user.ID)
+		if err != nil {
+			return err
+		}
+		// access tokens are stateless and stay valid until they expire
+		fmt.Fprintf(c.out, "revoked %d refresh tokens and %d oauth grants for %s, access tokens expire within %s\n", tokens, grants, user.Email, c.cfg.AccessTokenTTL)
+		return nil
+
+	default:
+		return errors.New(userUsage)
+	}
+}
+
+// setChirpyRed grants Red through an open ended manual subscription, or
+// takes it away by expiring every subscription the user has.
+func (c *adminCLI) setChirpyRed(ctx context.Context, user database.User, red bool) error {
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	qtx := c.queries.WithTx(tx)
+
+	if red {
+		_, err = applySubscriptionChange(ctx, qtx, subscriptionChange{
+			UserID:    user.ID,
+			Provider:  manualProvider,
+			EventType: "admin.granted",
+			Status:    subscriptionActive,
+		})
+		if err != nil {
+			return err
+		}
+		return tx.Commit()
+	}
+
+	subs, err := qtx.GetUserSubscriptions(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+	for _, sub := range subs {
+		if sub.Status == subscriptionExpired {
+			continue
+		}
+		_, err = applySubscriptionChange(ctx, qtx, subscriptionChange{
+			UserID:    user.ID,
+			Provider:  sub.Provider,
+			EventType: "admin.revoked",
+			Status:    subscriptionExpired,
+			PeriodEnd: sub.CurrentPeriodEnd,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	// keep the cache right even for users with no subscriptions at all
+	_, err = qtx.RefreshUserChirpyRed(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+const chirpUsage = `usage: chirpy chirp takedown <chirp id>
+`
+
+func (c *adminCLI) chirp(ctx context.Context, args []string) error {
+	if len(args) != 2 || args[0] != "takedown" {
+		return errors.New(chirpUsage)
+	}
+
+	id, err := uuid.Parse(args[1])
+	if err != nil {
+		return fmt.Errorf("invalid chirp id %q", args[1])
+	}
+
+	chirp, err := c.queries.GetChirp(ctx, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("no chirp with id %s", id)
+	} else if err != nil {
+		return err
+	}
+
+	err = c.queries.DeleteChirp(ctx, chirp.ID)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(c.out, "took down chirp %s by user %s: %q\n", chirp.ID, chirp.UserID, chirp.Body)
+	return nil
+}
+
+// requireForce keeps destructive or test-only commands away from production
+// unless the operator says they mean it.
+func (c *adminCLI) requireForce(cmd string, force bool) error {
+	if c.cfg.IsDev() || force {
+		return nil
+	}
+	return fmt.Errorf("%s is meant for development, pass -force to run it against PLATFORM=%s", cmd, c.cfg.Platform)
+}
+
+var seedBodies = []string{
+	"Hello from the seed script!",
+	"I had something interesting for breakfast",
+	"Gale! Have you seen the latest chirps?",
+	"Testing one, two, three",
+	"What a wonderful day to write software",
+	"Does anyone else think the build is slow today?",
+}
+
+func (c *adminCLI) seed(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("seed", flag.ContinueOnError)
+	fs.SetOutput(c.out)
+	users := fs.Int("users", 5, "number of users to create")
+	chirps := fs.Int("chirps", 3, "chirps per user")
+	password := fs.String("password", "chirpy-seed-password", "password for every seeded user")
+	force := fs.Bool("force", false, "allow seeding outside PLATFORM=dev")
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	err = c.requireForce("seed", *force)
+	if err != nil {
+		return err
+	}
+
+	hashed, err := auth.HashPassword(*password)
+	if err != nil {
+		return err
+	}
+
+	// a random suffix lets seed run repeatedly without unique violations
+	suffix := make([]byte, 4)
+	rand.Read(suffix)
+	batch := hex.EncodeToString(suffix)
+
+	for i := range *users {
+		handle := fmt.Sprintf("seed_%s_%d", batch, i+1)
+		user, err := c.queries.CreateUser(ctx, database.CreateUserParams{
+			Email:          handle + "@example.com",
+			HashedPassword: sql.NullString{String: hashed, Valid: true},
+		})
+		if err != nil {
+			return err
+		}
+
+		_, err = c.queries.UpdateUserProfile(ctx, database.UpdateUserProfileParams{
+			ID:          user.ID,
+			Handle:      sql.NullString{String: handle, Valid: true},
+			DisplayName: fmt.Sprintf("Seed User %d", i+1),
+		})
+		if err != nil {
+			return err
+		}
+
+		for j := range *chirps {
+			_, err := c.queries.CreateChirp(ctx, database.CreateChirpParams{
+				Body:   seedBodies[(i+j)%len(seedBodies)],
+				UserID: user.ID,
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		fmt.Fprintf(c.out, "created %s (@%s) with %d chirps\n", user.Email, handle, *chirps)
+	}
+
+	return nil
+}
+
+func (c *adminCLI) reset(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("reset", flag.ContinueOnError)
+	fs.SetOutput(c.out)
+	force := fs.Bool("force", false, "allow resetting outside PLATFORM=dev")
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	err = c.requireForce("reset", *force)
+	if err != nil {
+		return err
+	}
+
+	// chirps, tokens and everything else owned by a user cascade
+	err = c.queries.DeleteUsers(ctx)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(c.out, "deleted every user and their data")
+	return nil
+}
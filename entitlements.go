@@ -0,0 +1,45 @@
+package main
+
+import (
+	"github.com/nickemp1996/chirpy/internal/apierror"
+	"github.com/nickemp1996/chirpy/internal/database"
+	"github.com/nickemp1996/chirpy/internal/entitlements"
+	"github.com/nickemp1996/chirpy/internal/ratelimit"
+)
+
+// entitlements is what dbUser's plan unlocks. Handlers check these rather
+// than is_chirpy_red, so what Red includes lives in one config.
+func (cfg *apiConfig) entitlements(dbUser database.User) entitlements.Entitlements {
+	return cfg.plans.For(entitlements.PlanFor(dbUser.IsChirpyRed))
+}
+
+// rateLimit spends one of the user's write requests for the minute. Requests
+// made with an API key also spend from the key's own bucket, which the key
+// may set lower than the plan, so one busy bot can't starve the others.
+func (cfg *apiConfig) rateLimit(dbUser database.User, p principal) error {
+	limit := cfg.entitlements(dbUser).RateLimit
+	rate := ratelimit.Rate{PerMinute: limit.PerMinute, Burst: limit.Burst}
+
+	if p.APIKey != nil {
+		keyRate := rate
+		if p.APIKey.RateLimit.Valid {
+			keyRate.PerMinute = min(rate.PerMinute, int(p.APIKey.RateLimit.Int32))
+			keyRate.Burst = min(rate.Burst, int(p.APIKey.RateLimit.Int32))
+		}
+		err := cfg.allow("apikey:"+p.APIKey.ID.String(), keyRate)
+		if err != nil {
+			return err
+		}
+	}
+
+	return cfg.allow("user:"+dbUser.ID.String(), rate)
+}
+
+func (cfg *apiConfig) allow(key string, rate ratelimit.Rate) error {
+	ok, retryAfter := cfg.limiter.Allow(key, rate)
+	if !ok {
+		cfg.metrics.rateLimited.Inc()
+		return apierror.TooManyRequests("too many requests, slow down", retryAfter)
+	}
+	return nil
+}
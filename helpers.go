@@ -2,38 +2,47 @@ package main
 
 import (
 	"encoding/json"
-	"log"
+	"fmt"
+	"log/slog"
 	"net/http"
+	"net/mail"
 	"slices"
 	"strings"
+	"unicode/utf8"
+
+	"github.com/nickemp1996/chirpy/internal/apierror"
+	"github.com/nickemp1996/chirpy/internal/auth"
+	"github.com/nickemp1996/chirpy/internal/database"
+	"github.com/nickemp1996/chirpy/internal/entitlements"
+	"github.com/nickemp1996/chirpy/internal/logging"
 )
 
-func respondWithError(w http.ResponseWriter, code int, msg string, err error) {
-	log.Printf("%s: %s", msg, err)
+// request body limits, sized well above any valid payload for the route
+const (
+	maxUserBodySize    = 4 << 10
+	maxChirpBodySize   = 8 << 10
+	maxProfileBodySize = 8 << 10
+	maxWebhookBodySize = 64 << 10
+)
 
-	type returnVals struct {
-		// the key will be the name of struct field unless you give it an explicit JSON tag
-		Error string `json:"error"`
-	}
-	respBody := returnVals{
-		Error: msg,
-	}
-	dat, err := json.Marshal(respBody)
-	if err != nil {
-		log.Printf("Error marshalling JSON: %s", err)
-		w.WriteHeader(500)
-		return
-	}
+// respondWithError writes err as a problem+json response. Errors that aren't
+// already an *apierror.Error are mapped by apierror.From, so handlers can
+// pass database and decoding errors straight through.
+func respondWithError(w http.ResponseWriter, r *http.Request, err error) {
+	apiErr := apierror.Write(w, r, err)
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(code)
-	w.Write(dat)
+	logger := logging.FromContext(r.Context())
+	if apiErr.Status >= 500 {
+		logger.Error(apiErr.Detail, "status", apiErr.Status, "code", apiErr.Code, "err", apiErr.Cause)
+	} else {
+		logger.Info(apiErr.Detail, "status", apiErr.Status, "code", apiErr.Code, "err", apiErr.Cause)
+	}
 }
 
 func respondWithJSON(w http.ResponseWriter, code int, payload interface{}) {
 	dat, err := json.Marshal(payload)
 	if err != nil {
-		log.Printf("Error marshalling JSON: %s", err)
+		slog.Error("error marshalling JSON", "err", err)
 		w.WriteHeader(500)
 		return
 	}
@@ -43,6 +52,29 @@ func respondWithJSON(w http.ResponseWriter, code int, payload interface{}) {
 	w.Write(dat)
 }
 
+// checkPassword reports whether password is dbUser's. Accounts without a
+// password never match.
+func checkPassword(dbUser database.User, password string) (bool, error) {
+	if !dbUser.HashedPassword.Valid {
+		return false, nil
+	}
+	return auth.CheckPasswordHash(password, dbUser.HashedPassword.String)
+}
+
+// normalizeEmail lower-cases the whole address. The local part is
+// technically case sensitive, but no provider treats it that way and users
+// expect A@x.com and a@x.com to be the same account.
+func normalizeEmail(email string) (string, error) {
+	email = strings.ToLower(strings.TrimSpace(email))
+
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Address != email || !strings.Contains(email[strings.LastIndex(email, "@"):], ".") {
+		return "", apierror.Field("email", "must be a valid email address")
+	}
+
+	return email, nil
+}
+
 func replaceBadWords(body string) string {
 	badWords := []string{"kerfuffle", "sharbert", "fornax"}
 	words := strings.Split(body, " ")
@@ -55,3 +87,11 @@ func replaceBadWords(body string) string {
 
 	return strings.Join(words, " ")
 }
+
+// checkChirpLength counts characters, not bytes, against the plan's limit.
+func checkChirpLength(body string, ent entitlements.Entitlements) error {
+	if utf8.RuneCountInString(body) > ent.MaxChirpLength {
+		return apierror.Field("body", fmt.Sprintf("must be at most %d characters", ent.MaxChirpLength))
+	}
+	return nil
+}
@@ -0,0 +1,276 @@
+// Package apierror is the API's error model: every error response carries a
+// stable machine-readable code and is rendered as an RFC 9457 problem
+// document.
+package apierror
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Code identifies a kind of failure. Codes are part of the API contract;
+// clients switch on them, so never rename one.
+type Code string
+
+const (
+	CodeBadRequest           Code = "bad_request"
+	CodeInvalidJSON          Code = "invalid_json"
+	CodeValidation           Code = "validation_failed"
+	CodeInvalidID            Code = "invalid_id"
+	CodeUnauthorized         Code = "unauthorized"
+	CodeInvalidCredentials   Code = "invalid_credentials"
+	CodeForbidden            Code = "forbidden"
+	CodeUpgradeRequired      Code = "upgrade_required"
+	CodeNotFound             Code = "not_found"
+	CodeConflict             Code = "conflict"
+	CodePayloadTooLarge      Code = "payload_too_large"
+	CodeUnsupportedMediaType Code = "unsupported_media_type"
+	CodeRateLimited          Code = "rate_limited"
+	CodeInternal             Code = "internal_error"
+)
+
+// ContentType is the media type of problem documents.
+const ContentType = "application/problem+json"
+
+// typeBase prefixes the problem type URI, which stays stable per code.
+const typeBase = "urn:chirpy:problem:"
+
+// FieldError points at one invalid field in a request body or query.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Error is an API error. Detail is shown to the client; Cause is only
+// logged, so it may hold anything. RetryAfter, when set, is sent as the
+// Retry-After header.
+type Error struct {
+	Status     int
+	Code       Code
+	Detail     string
+	Fields     []FieldError
+	Cause      error
+	RetryAfter time.Duration
+}
+
+func (e *Error) Error() string {
+	if e.Cause != nil {
+		return fmt.Sprintf("%s: %s: %v", e.Code, e.Detail, e.Cause)
+	}
+	return fmt.Sprintf("%s: %s", e.Code, e.Detail)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Cause
+}
+
+func New(status int, code Code, detail string, cause error) *Error {
+	return &Error{Status: status, Code: code, Detail: detail, Cause: cause}
+}
+
+func BadRequest(detail string, cause error) *Error {
+	return New(http.StatusBadRequest, CodeBadRequest, detail, cause)
+}
+
+func InvalidID(detail string, cause error) *Error {
+	return New(http.StatusBadRequest, CodeInvalidID, detail, cause)
+}
+
+func Unauthorized(detail string, cause error) *Error {
+	return New(http.StatusUnauthorized, CodeUnauthorized, detail, cause)
+}
+
+func Forbidden(detail string, cause error) *Error {
+	return New(http.StatusForbidden, CodeForbidden, detail, cause)
+}
+
+// UpgradeRequired is a Forbidden for features the user's plan doesn't
+// include, so clients can offer an upgrade instead of an error.
+func UpgradeRequired(detail string) *Error {
+	return New(http.StatusForbidden, CodeUpgradeRequired, detail, nil)
+}
+
+func NotFound(detail string, cause error) *Error {
+	return New(http.StatusNotFound, CodeNotFound, detail, cause)
+}
+
+func Conflict(detail string, cause error) *Error {
+	return New(http.StatusConflict, CodeConflict, detail, cause)
+}
+
+func PayloadTooLarge(detail string, cause error) *Error {
+	return New(http.StatusRequestEntityTooLarge, CodePayloadTooLarge, detail, cause)
+}
+
+func UnsupportedMediaType(detail string, cause error) *Error {
+	return New(http.StatusUnsupportedMediaType, CodeUnsupportedMediaType, detail, cause)
+}
+
+func TooManyRequests(detail string, retryAfter time.Duration) *Error {
+	err := New(http.StatusTooManyRequests, CodeRateLimited, detail, nil)
+	err.RetryAfter = retryAfter
+	return err
+}
+
+func Internal(cause error) *Error {
+	return New(http.StatusInternalServerError, CodeInternal, "internal error", cause)
+}
+
+// Validation reports one or more invalid fields at once.
+func Validation(fields ...FieldError) *Error {
+	detail := "the request has invalid fields"
+	if len(fields) == 1 {
+		detail = fields[0].Field + ": " + fields[0].Message
+	}
+	return &Error{
+		Status: http.StatusBadRequest,
+		Code:   CodeValidation,
+		Detail: detail,
+		Fields: fields,
+	}
+}
+
+// Field is shorthand for Validation with a single field.
+func Field(field, message string) *Error {
+	return Validation(FieldError{Field: field, Message: message})
+}
+
+// From maps any error to an API error. *Error values pass through, and the
+// failures every handler runs into get their proper 4xx here once instead
+// of in each handler. Everything else is a 500.
+func From(err error) *Error {
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		return apiErr
+	}
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return NotFound("resource not found", err)
+	}
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		switch pqErr.Code {
+		case "23505":
+			return Conflict("a resource with the same unique value already exists", err)
+		case "23503":
+			return Conflict("a referenced resource does not exist", err)
+		}
+	}
+
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		return PayloadTooLarge(fmt.Sprintf("request body must be at most %d bytes", maxBytesErr.Limit), err)
+	}
+
+	var syntaxErr *json.SyntaxError
+	if errors.As(err, &syntaxErr) {
+		return New(http.StatusBadRequest, CodeInvalidJSON, fmt.Sprintf("malformed JSON at byte %d", syntaxErr.Offset), err)
+	}
+
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		if typeErr.Field != "" {
+			return New(http.StatusBadRequest, CodeInvalidJSON, fmt.Sprintf("%s must be a %s", typeErr.Field, jsonTypeName(typeErr.Type.Kind().String())), err).
+				withField(typeErr.Field, "must be a "+jsonTypeName(typeErr.Type.Kind().String()))
+		}
+		return New(http.StatusBadRequest, CodeInvalidJSON, "request body has the wrong JSON type", err)
+	}
+
+	if errors.Is(err, io.EOF) {
+		return New(http.StatusBadRequest, CodeInvalidJSON, "request body is empty", err)
+	}
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		return New(http.StatusBadRequest, CodeInvalidJSON, "request body ends in the middle of a JSON value", err)
+	}
+
+	return Internal(err)
+}
+
+// UniqueViolation reports whether err is a Postgres unique violation and on
+// which constraint or index, for handlers that want a specific message.
+func UniqueViolation(err error) (constraint string, ok bool) {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		return pqErr.Constraint, true
+	}
+	return "", false
+}
+
+func (e *Error) withField(field, message string) *Error {
+	e.Fields = append(e.Fields, FieldError{Field: field, Message: message})
+	return e
+}
+
+func jsonTypeName(kind string) string {
+	switch kind {
+	case "string":
+		return "string"
+	case "bool":
+		return "boolean"
+	case "slice", "array":
+		return "array"
+	case "struct", "map":
+		return "object"
+	case "int", "int8", "int16", "int32", "int64", "uint", "uint8", "uint16", "uint32", "uint64", "float32", "float64":
+		return "number"
+	default:
+		return kind
+	}
+}
+
+// Problem is the RFC 9457 body. Error repeats Detail for clients written
+// against the old {"error": "..."} responses.
+type Problem struct {
+	Type     string       `json:"type"`
+	Title    string       `json:"title"`
+	Status   int          `json:"status"`
+	Detail   string       `json:"detail,omitempty"`
+	Instance string       `json:"instance,omitempty"`
+	Code     Code         `json:"code"`
+	Errors   []FieldError `json:"errors,omitempty"`
+	Error    string       `json:"error"`
+}
+
+func (e *Error) Problem(instance string) Problem {
+	return Problem{
+		Type:     typeBase + string(e.Code),
+		Title:    http.StatusText(e.Status),
+		Status:   e.Status,
+		Detail:   e.Detail,
+		Instance: instance,
+		Code:     e.Code,
+		Errors:   e.Fields,
+		Error:    e.Detail,
+	}
+}
+
+// Write renders err as a problem document for r.
+func Write(w http.ResponseWriter, r *http.Request, err error) *Error {
+	apiErr := From(err)
+
+	body, marshalErr := json.Marshal(apiErr.Problem(r.URL.Path))
+	if marshalErr != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return apiErr
+	}
+
+	w.Header().Set("Content-Type", ContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if apiErr.RetryAfter > 0 {
+		// whole seconds, rounded up so clients never retry too early
+		w.Header().Set("Retry-After", strconv.Itoa(int((apiErr.RetryAfter+time.Second-1)/time.Second)))
+	}
+	w.WriteHeader(apiErr.Status)
+	w.Write(body)
+
+	return apiErr
+}
@@ -0,0 +1,124 @@
+package apierror
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+func decodeErr(body string, v any) error {
+	return json.NewDecoder(strings.NewReader(body)).Decode(v)
+}
+
+func TestFromMapsCommonErrors(t *testing.T) {
+	var target struct {
+		Body string `json:"body"`
+	}
+
+	cases := []struct {
+		name   string
+		err    error
+		status int
+		code   Code
+	}{
+		{"no rows", fmt.Errorf("getting chirp: %w", sql.ErrNoRows), 404, CodeNotFound},
+		{"unique violation", &pq.Error{Code: "23505"}, 409, CodeConflict},
+		{"foreign key violation", &pq.Error{Code: "23503"}, 409, CodeConflict},
+		{"syntax error", decodeErr(`{"body": }`, &target), 400, CodeInvalidJSON},
+		{"wrong type", decodeErr(`{"body": 12}`, &target), 400, CodeInvalidJSON},
+		{"empty body", decodeErr(``, &target), 400, CodeInvalidJSON},
+		{"truncated body", decodeErr(`{"body": "hi"`, &target), 400, CodeInvalidJSON},
+		{"too large", &http.MaxBytesError{Limit: 10}, 413, CodePayloadTooLarge},
+		{"api error", Forbidden("nope", nil), 403, CodeForbidden},
+		{"unknown", fmt.Errorf("connection reset"), 500, CodeInternal},
+	}
+
+	for _, c := range cases {
+		got := From(c.err)
+		if got.Status != c.status || got.Code != c.code {
+			t.Errorf("%s: expected %d %s, got %d %s", c.name, c.status, c.code, got.Status, got.Code)
+		}
+	}
+}
+
+func TestFromKeepsTypeErrorField(t *testing.T) {
+	var target struct {
+		Body string `json:"body"`
+	}
+
+	got := From(decodeErr(`{"body": 12}`, &target))
+	if len(got.Fields) != 1 || got.Fields[0].Field != "body" {
+		t.Errorf("Type errors should name the field, got %+v", got.Fields)
+	}
+}
+
+func TestWriteRendersProblemJSON(t *testing.T) {
+	req := httptest.NewRequest("PATCH", "/api/users/me?x=1", nil)
+	rec := httptest.NewRecorder()
+
+	Write(rec, req, Validation(
+		FieldError{Field: "handle", Message: "must be 3-30 characters"},
+		FieldError{Field: "bio", Message: "too long"},
+	))
+
+	if rec.Code != 400 {
+		t.Errorf("Validation errors should be 400, got %d", rec.Code)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != ContentType {
+		t.Errorf("Content-Type should be %s, got %q", ContentType, ct)
+	}
+
+	var problem Problem
+	err := json.Unmarshal(rec.Body.Bytes(), &problem)
+	if err != nil {
+		t.Fatalf("Error decoding problem: %v", err)
+	}
+
+	if problem.Type != "urn:chirpy:problem:validation_failed" || problem.Code != CodeValidation {
+		t.Errorf("Unexpected problem type or code: %+v", problem)
+	}
+	if problem.Status != 400 || problem.Title != "Bad Request" || problem.Instance != "/api/users/me" {
+		t.Errorf("Unexpected problem fields: %+v", problem)
+	}
+	if len(problem.Errors) != 2 || problem.Errors[1].Field != "bio" {
+		t.Errorf("Field errors should be listed, got %+v", problem.Errors)
+	}
+	if problem.Error != problem.Detail {
+		t.Errorf("The legacy error member should repeat the detail")
+	}
+}
+
+func TestInternalErrorsHideCause(t *testing.T) {
+	req := httptest.NewRequest("GET", "/api/chirps", nil)
+	rec := httptest.NewRecorder()
+
+	Write(rec, req, fmt.Errorf("pq: password authentication failed for user chirpy"))
+
+	if rec.Code != 500 {
+		t.Errorf("Unknown errors should be 500, got %d", rec.Code)
+	}
+	if strings.Contains(rec.Body.String(), "password") {
+		t.Errorf("Internal causes must not reach the client: %s", rec.Body.String())
+	}
+}
+
+func TestWriteSetsRetryAfter(t *testing.T) {
+	req := httptest.NewRequest("POST", "/api/chirps", nil)
+	rec := httptest.NewRecorder()
+
+	Write(rec, req, TooManyRequests("slow down", 1500*time.Millisecond))
+
+	if rec.Code != 429 {
+		t.Errorf("Expected 429, got %d", rec.Code)
+	}
+	if got := rec.Header().Get("Retry-After"); got != "2" {
+		t.Errorf("Retry-After should round up to whole seconds, got %q", got)
+	}
+}
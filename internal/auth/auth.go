@@ -2,6 +2,7 @@ package auth
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
 	"net/http"
@@ -31,14 +32,54 @@ func CheckPasswordHash(password, hash string) (bool, error) {
 	return match, nil
 }
 
-func MakeJWT(userID uuid.UUID, tokenSecret string) (string, error) {
-	claims := jwt.RegisteredClaims{
-		Issuer:    "chirpy",
-		IssuedAt:  jwt.NewNumericDate(time.Now()),
-		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
-		Subject:   userID.String(),
+// Claims are the claims of chirpy's access tokens. ClientID and Scope are
+// only set on tokens issued to OAuth clients, which act for the user with
+// limited access; ID then names the grant so the token can be revoked.
+type Claims struct {
+	jwt.RegisteredClaims
+	ClientID string `json:"client_id,omitempty"`
+	Scope    string `json:"scope,omitempty"`
+}
+
+// Scoped reports whether the token was issued to an OAuth client.
+func (c *Claims) Scoped() bool {
+	return c.ClientID != ""
+}
+
+func (c *Claims) UserID() (uuid.UUID, error) {
+	subject, err := c.GetSubject()
+	if err != nil {
+		return uuid.Nil, err
 	}
+	return uuid.Parse(subject)
+}
 
+func MakeJWT(userID uuid.UUID, tokenSecret string, expiresIn time.Duration) (string, error) {
+	return signClaims(newClaims(userID, expiresIn), tokenSecret)
+}
+
+// MakeScopedJWT issues an access token for an OAuth client. ValidateJWT
+// refuses these, so they only work where ParseJWT's caller checks the scope.
+func MakeScopedJWT(userID uuid.UUID, tokenSecret string, expiresIn time.Duration, grantID uuid.UUID, clientID, scope string) (string, error) {
+	claims := newClaims(userID, expiresIn)
+	claims.ID = grantID.String()
+	claims.ClientID = clientID
+	claims.Scope = scope
+	return signClaims(claims, tokenSecret)
+}
+
+func newClaims(userID uuid.UUID, expiresIn time.Duration) *Claims {
+	return &Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    "chirpy",
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(expiresIn)),
+			Subject:   userID.String(),
+		},
+	}
+}
+
+func signClaims(claims *Claims, tokenSecret string) (string, error) {
 	t := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	s, err := t.SignedString([]byte(tokenSecret))
 	if err != nil {
@@ -48,8 +89,9 @@ func MakeJWT(userID uuid.UUID, tokenSecret string) (string, error) {
 	return s, nil
 }
 
-func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
-	claims := &jwt.RegisteredClaims{}
+// ParseJWT validates any chirpy access token, scoped or not.
+func ParseJWT(tokenString, tokenSecret string) (*Claims, error) {
+	claims := &Claims{}
 
 	t, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
 		if m, ok := token.Method.(*jwt.SigningMethodHMAC); !ok || m.Alg() != jwt.SigningMethodHS256.Alg() {
@@ -60,26 +102,31 @@ func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
 
 	if err != nil {
 		if strings.Contains(err.Error(), "malformed") {
-			return uuid.Nil, fmt.Errorf("invalid token")
+			return nil, fmt.Errorf("invalid token")
 		}
-		return uuid.Nil, err
+		return nil, err
 	}
 
 	if !t.Valid {
-		return uuid.Nil, fmt.Errorf("invalid token")
+		return nil, fmt.Errorf("invalid token")
 	}
 
-	subject, err := t.Claims.GetSubject()
+	return claims, nil
+}
+
+// ValidateJWT validates a user's own access token. Tokens issued to OAuth
+// clients are refused, so a client can never reach the account endpoints.
+func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
+	claims, err := ParseJWT(tokenString, tokenSecret)
 	if err != nil {
 		return uuid.Nil, err
 	}
 
-	id, err := uuid.Parse(subject)
-	if err != nil {
-		return uuid.Nil, err
+	if claims.Scoped() {
+		return uuid.Nil, fmt.Errorf("token was issued to an oauth client")
 	}
 
-	return id, nil
+	return claims.UserID()
 }
 
 func GetBearerToken(headers http.Header) (string, error) {
@@ -112,3 +159,49 @@ func MakeRefreshToken() (string, error) {
 	token := hex.EncodeToString(b)
 	return token, nil
 }
+
+// apiKeyPrefix marks personal API keys so they are easy to recognise in
+// config files and secret scanners.
+const apiKeyPrefix = "chirpy_"
+
+// MakeAPIKey returns a new personal API key and its prefix. The prefix is
+// stored and shown to the user to tell keys apart; the key itself is only
+// stored as HashAPIKey(key).
+func MakeAPIKey() (key, prefix string, err error) {
+	id := make([]byte, 6)
+	_, err = rand.Read(id)
+	if err != nil {
+		return "", "", err
+	}
+
+	secret := make([]byte, 32)
+	_, err = rand.Read(secret)
+	if err != nil {
+		return "", "", err
+	}
+
+	prefix = apiKeyPrefix + hex.EncodeToString(id)
+	return prefix + "_" + hex.EncodeToString(secret), prefix, nil
+}
+
+// APIKeyPrefix returns the prefix a key is looked up by.
+func APIKeyPrefix(key string) (string, error) {
+	rest, ok := strings.CutPrefix(key, apiKeyPrefix)
+	if !ok {
+		return "", fmt.Errorf("not a chirpy api key")
+	}
+
+	id, secret, ok := strings.Cut(rest, "_")
+	if !ok || len(id) != 12 || len(secret) != 64 {
+		return "", fmt.Errorf("malformed api key")
+	}
+
+	return apiKeyPrefix + id, nil
+}
+
+// HashAPIKey hashes a key for storage. Keys carry 256 random bits, so unlike
+// passwords they don't need a slow hash.
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
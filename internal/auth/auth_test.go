@@ -108,3 +108,66 @@ func TestMakeRefreshToken(t *testing.T) {
 		t.Errorf("Error making refresh token")
 	}
 }
+
+func TestMakeAPIKey(t *testing.T) {
+	key, prefix, err := MakeAPIKey()
+	if err != nil {
+		t.Fatalf("Error making api key: %v", err)
+	}
+
+	if !strings.HasPrefix(key, prefix+"_") {
+		t.Errorf("Key %q should start with its prefix %q", key, prefix)
+	}
+
+	parsed, err := APIKeyPrefix(key)
+	if err != nil || parsed != prefix {
+		t.Errorf("Expected prefix %q from key, got %q (%v)", prefix, parsed, err)
+	}
+
+	other, _, _ := MakeAPIKey()
+	if HashAPIKey(key) != HashAPIKey(key) || HashAPIKey(key) == HashAPIKey(other) {
+		t.Errorf("Hashes should be stable and differ between keys")
+	}
+}
+
+func TestAPIKeyPrefixRejectsMalformedKeys(t *testing.T) {
+	key, _, _ := MakeAPIKey()
+
+	for _, bad := range []string{"", "f271c81ff7084ee5b99a5091b42d486e", "chirpy_abc", key[:len(key)-1], strings.Replace(key, "chirpy_", "other_", 1)} {
+		_, err := APIKeyPrefix(bad)
+		if err == nil {
+			t.Errorf("Expected an error for %q", bad)
+		}
+	}
+}
+
+func TestScopedTokens(t *testing.T) {
+	tokenSecret := "super-secret-test-key-please-change-me"
+	id := uuid.New()
+	grantID := uuid.New()
+
+	s, err := MakeScopedJWT(id, tokenSecret, time.Hour, grantID, "client_1", "chirps:write")
+	if err != nil {
+		t.Fatalf("Error creating scoped JWT: %v", err)
+	}
+
+	claims, err := ParseJWT(s, tokenSecret)
+	if err != nil {
+		t.Fatalf("Error parsing scoped JWT: %v", err)
+	}
+	userID, _ := claims.UserID()
+	if !claims.Scoped() || claims.Scope != "chirps:write" || claims.ClientID != "client_1" || claims.ID != grantID.String() || userID != id {
+		t.Errorf("Scoped claims don't round trip: %+v", claims)
+	}
+
+	_, err = ValidateJWT(s, tokenSecret)
+	if err == nil {
+		t.Errorf("ValidateJWT must refuse tokens issued to oauth clients")
+	}
+
+	s, _ = MakeJWT(id, tokenSecret, time.Hour)
+	claims, err = ParseJWT(s, tokenSecret)
+	if err != nil || claims.Scoped() {
+		t.Errorf("User tokens should parse as unscoped, got %+v (%v)", claims, err)
+	}
+}
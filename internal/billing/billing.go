@@ -0,0 +1,70 @@
+// Package billing adapts payment providers' webhooks to one subscription
+// event model. Each Provider verifies its own requests and parses its own
+// payloads; everything after that is provider agnostic.
+package billing
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ErrUnauthenticated is returned by Verify for requests that don't come from
+// the provider.
+var ErrUnauthenticated = errors.New("webhook not authenticated")
+
+// Kind is what an event does to a subscription.
+type Kind string
+
+const (
+	// KindActivated starts or renews a subscription.
+	KindActivated Kind = "activated"
+	// KindPaymentFailed puts an existing subscription in arrears.
+	KindPaymentFailed Kind = "payment_failed"
+	// KindCanceled stops renewal; the subscription runs to its period end.
+	KindCanceled Kind = "canceled"
+	// KindExpired ends a subscription now.
+	KindExpired Kind = "expired"
+	// KindIgnored is an event chirpy doesn't act on.
+	KindIgnored Kind = "ignored"
+)
+
+// Event is a provider's webhook in normalized form.
+type Event struct {
+	// ID identifies the event at the provider, for deduplication.
+	ID string
+	// Type is the provider's own name for the event, kept for logs.
+	Type           string
+	Kind           Kind
+	UserID         uuid.UUID
+	SubscriptionID string
+	// PeriodEnd is when the paid period ends, nil if the provider didn't
+	// say or the subscription is open ended.
+	PeriodEnd *time.Time
+}
+
+type Provider interface {
+	// Name is the provider's path segment in /api/billing/{provider}/webhooks
+	// and its value in the subscriptions.provider column.
+	Name() string
+	// Verify checks a delivery really came from the provider.
+	Verify(header http.Header, body []byte) error
+	// Parse turns a verified body into an Event. Stored bodies are parsed
+	// again when a delivery is replayed, so Parse must not depend on the
+	// request.
+	Parse(body []byte) (Event, error)
+}
+
+// EventID prefers the provider's event id. Without one, a hash of the body
+// still collapses retried deliveries of the same event.
+func EventID(id string, body []byte) string {
+	if id != "" {
+		return id
+	}
+	sum := sha256.Sum256(body)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
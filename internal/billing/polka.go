@@ -0,0 +1,118 @@
+package billing
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nickemp1996/chirpy/internal/apierror"
+	"github.com/nickemp1996/chirpy/internal/auth"
+	"github.com/nickemp1996/chirpy/internal/httpjson"
+	"github.com/nickemp1996/chirpy/internal/signature"
+)
+
+const (
+	PolkaName            = "polka"
+	PolkaSignatureHeader = "Polka-Signature"
+)
+
+// Polka event types. Upgrades and renewals start or extend a subscription;
+// the rest only change one that already exists.
+const (
+	polkaEventUpgraded      = "user.upgraded"
+	polkaEventRenewed       = "subscription.renewed"
+	polkaEventPaymentFailed = "payment.failed"
+	polkaEventCanceled      = "subscription.canceled"
+	polkaEventDowngraded    = "user.downgraded"
+)
+
+var polkaKinds = map[string]Kind{
+	polkaEventUpgraded:      KindActivated,
+	polkaEventRenewed:       KindActivated,
+	polkaEventPaymentFailed: KindPaymentFailed,
+	polkaEventCanceled:      KindCanceled,
+	polkaEventDowngraded:    KindExpired,
+}
+
+type Polka struct {
+	apiKey        string
+	webhookSecret string
+	tolerance     time.Duration
+	now           func() time.Time
+}
+
+// NewPolka authenticates with the HMAC signature when webhookSecret is set,
+// and otherwise with Polka's static api key.
+func NewPolka(apiKey, webhookSecret string, tolerance time.Duration) *Polka {
+	return &Polka{
+		apiKey:        apiKey,
+		webhookSecret: webhookSecret,
+		tolerance:     tolerance,
+		now:           time.Now,
+	}
+}
+
+func (p *Polka) Name() string {
+	return PolkaName
+}
+
+func (p *Polka) Verify(header http.Header, body []byte) error {
+	if p.webhookSecret != "" {
+		err := signature.Verify(header.Get(PolkaSignatureHeader), body, p.webhookSecret, p.tolerance, p.now())
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrUnauthenticated, err)
+		}
+		return nil
+	}
+
+	key, err := auth.GetAPIKey(header)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrUnauthenticated, err)
+	}
+	if subtle.ConstantTimeCompare([]byte(key), []byte(p.apiKey)) != 1 {
+		return fmt.Errorf("%w: incorrect api key", ErrUnauthenticated)
+	}
+
+	return nil
+}
+
+func (p *Polka) Parse(body []byte) (Event, error) {
+	type parameters struct {
+		ID    string `json:"id"`
+		Event string `json:"event"`
+		Data  struct {
+			UserID         string     `json:"user_id"`
+			SubscriptionID string     `json:"subscription_id"`
+			PeriodEnd      *time.Time `json:"period_end"`
+		} `json:"data"`
+	}
+
+	params := parameters{}
+	err := httpjson.Unmarshal(body, &params, httpjson.AllowUnknownFields())
+	if err != nil {
+		return Event{}, err
+	}
+
+	event := Event{
+		ID:             EventID(params.ID, body),
+		Type:           params.Event,
+		Kind:           KindIgnored,
+		SubscriptionID: params.Data.SubscriptionID,
+		PeriodEnd:      params.Data.PeriodEnd,
+	}
+
+	kind, ok := polkaKinds[params.Event]
+	if !ok {
+		return event, nil
+	}
+	event.Kind = kind
+
+	event.UserID, err = uuid.Parse(params.Data.UserID)
+	if err != nil {
+		return event, apierror.Field("data.user_id", "must be a UUID")
+	}
+
+	return event, nil
+}
@@ -0,0 +1,106 @@
+package billing
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nickemp1996/chirpy/internal/apierror"
+	"github.com/nickemp1996/chirpy/internal/signature"
+)
+
+func TestPolkaVerifyAPIKey(t *testing.T) {
+	p := NewPolka("f271c81ff7084ee5b99a5091b42d486e", "", time.Minute)
+
+	header := http.Header{}
+	header.Set("Authorization", "ApiKey f271c81ff7084ee5b99a5091b42d486e")
+	if err := p.Verify(header, []byte(`{}`)); err != nil {
+		t.Errorf("The configured key should verify: %v", err)
+	}
+
+	header.Set("Authorization", "ApiKey wrong")
+	if err := p.Verify(header, []byte(`{}`)); !errors.Is(err, ErrUnauthenticated) {
+		t.Errorf("Expected ErrUnauthenticated for a wrong key, got %v", err)
+	}
+
+	if err := p.Verify(http.Header{}, []byte(`{}`)); !errors.Is(err, ErrUnauthenticated) {
+		t.Errorf("Expected ErrUnauthenticated without a key, got %v", err)
+	}
+}
+
+func TestPolkaVerifySignature(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	p := NewPolka("", "whsec_polka", time.Minute)
+	p.now = func() time.Time { return now }
+	body := []byte(`{"event":"user.upgraded"}`)
+
+	header := http.Header{}
+	header.Set(PolkaSignatureHeader, signature.Header("whsec_polka", now, body))
+	if err := p.Verify(header, body); err != nil {
+		t.Errorf("A valid signature should verify: %v", err)
+	}
+
+	// with a secret configured the api key alone is no longer enough
+	header = http.Header{}
+	header.Set("Authorization", "ApiKey anything")
+	err := p.Verify(header, body)
+	if !errors.Is(err, ErrUnauthenticated) || !errors.Is(err, signature.ErrMissing) {
+		t.Errorf("Expected a missing signature, got %v", err)
+	}
+}
+
+func TestPolkaParseNormalizesEvents(t *testing.T) {
+	p := NewPolka("key", "", time.Minute)
+	userID := uuid.New()
+
+	cases := map[string]Kind{
+		"user.upgraded":         KindActivated,
+		"subscription.renewed":  KindActivated,
+		"payment.failed":        KindPaymentFailed,
+		"subscription.canceled": KindCanceled,
+		"user.downgraded":       KindExpired,
+		"user.created":          KindIgnored,
+	}
+
+	for eventType, kind := range cases {
+		body := []byte(`{"id":"evt_1","event":"` + eventType + `","data":{"user_id":"` + userID.String() + `","subscription_id":"sub_1","period_end":"2030-01-01T00:00:00Z"}}`)
+		event, err := p.Parse(body)
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", eventType, err)
+			continue
+		}
+		if event.Kind != kind || event.Type != eventType || event.ID != "evt_1" {
+			t.Errorf("%s: expected kind %s, got %+v", eventType, kind, event)
+		}
+		if kind != KindIgnored && (event.UserID != userID || event.SubscriptionID != "sub_1" || event.PeriodEnd == nil) {
+			t.Errorf("%s: expected the subscription data, got %+v", eventType, event)
+		}
+	}
+}
+
+func TestPolkaParseRejectsBadUserID(t *testing.T) {
+	p := NewPolka("key", "", time.Minute)
+
+	event, err := p.Parse([]byte(`{"event":"user.upgraded","data":{"user_id":"nope"}}`))
+
+	var apiErr *apierror.Error
+	if !errors.As(err, &apiErr) || apiErr.Status != 400 {
+		t.Errorf("Expected a validation error, got %v", err)
+	}
+	if event.ID == "" || event.Type != "user.upgraded" {
+		t.Errorf("The event should still be identified for the delivery log, got %+v", event)
+	}
+}
+
+func TestEventIDFallsBackToBodyHash(t *testing.T) {
+	a := EventID("", []byte(`{"event":"user.upgraded"}`))
+	b := EventID("", []byte(`{"event":"user.upgraded"}`))
+	if a != b || a == "" {
+		t.Errorf("Identical bodies should get the same id, got %q and %q", a, b)
+	}
+	if EventID("evt_1", []byte(`{}`)) != "evt_1" {
+		t.Errorf("The provider's id should win")
+	}
+}
@@ -0,0 +1,371 @@
+package config
+
+import (
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+)
+
+const minSecretLength = 32
+
+// Config is everything the server needs at startup. Values come from, in
+// increasing precedence: defaults, the optional YAML or TOML file, .env and
+// the process environment. File keys are the lower-cased environment names,
+// e.g. db_url or read_timeout.
+type Config struct {
+	DBURL    string
+	Platform string
+	Secret   string
+	PolkaKey string
+	// PolkaWebhookSecret, when set, requires signed Polka webhooks instead
+	// of the static PolkaKey.
+	PolkaWebhookSecret string
+	WebhookTolerance   time.Duration
+	MediaDir           string
+	LogLevel           slog.Level
+
+	// EntitlementsFile overrides what each plan unlocks, see
+	// entitlements.Load.
+	EntitlementsFile string
+
+	// AutoMigrate applies pending migrations at startup.
+	AutoMigrate bool
+
+	Host              string
+	Port              int
+	ReadTimeout       time.Duration
+	ReadHeaderTimeout time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	MaxHeaderBytes    int
+	ShutdownTimeout   time.Duration
+	// ShutdownDelay is how long readiness fails before the server stops
+	// accepting connections, so load balancers see it and route elsewhere.
+	ShutdownDelay time.Duration
+
+	AccessTokenTTL  time.Duration
+	RefreshTokenTTL time.Duration
+
+	// PublicURL is where users reach the server, for urls other services
+	// send them back to.
+	PublicURL string
+	// OIDCProviders are the OpenID Connect providers users can sign in
+	// with, named in OIDC_PROVIDERS and set up by OIDC_<NAME>_ISSUER,
+	// OIDC_<NAME>_CLIENT_ID and OIDC_<NAME>_CLIENT_SECRET.
+	OIDCProviders []OIDCProvider
+
+	// TraceExporter is none, stdout, file or otlp.
+	TraceExporter string
+	TraceFile     string
+	OTLPEndpoint  string
+	ServiceName   string
+}
+
+type OIDCProvider struct {
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+}
+
+func (c *Config) Addr() string {
+	return fmt.Sprintf("%s:%d", c.Host, c.Port)
+}
+
+func (c *Config) IsDev() bool {
+	return c.Platform == "dev"
+}
+
+// ValidationError lists every problem found, so a bad deploy can be fixed in
+// one pass instead of one restart per missing variable.
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid configuration:\n  - " + strings.Join(e.Problems, "\n  - ")
+}
+
+// Load reads .env and the YAML or TOML file at path (if path isn't empty) and builds
+// a validated Config.
+func Load(path string) (*Config, error) {
+	// a missing .env is normal outside local development
+	godotenv.Load()
+
+	l := &loader{file: map[string]string{}}
+	if path != "" {
+		err := l.readFile(path)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	cfg := &Config{
+		DBURL:    l.string("DB_URL", ""),
+		Platform: l.string("PLATFORM", "prod"),
+		Secret:   l.string("SECRET", ""),
+		PolkaKey: l.string("POLKA_KEY", ""),
+
+		PolkaWebhookSecret: l.string("POLKA_WEBHOOK_SECRET", ""),
+		WebhookTolerance:   l.duration("WEBHOOK_TOLERANCE", 5*time.Minute),
+		MediaDir:           l.string("MEDIA_DIR", "uploads"),
+		LogLevel:           l.level("LOG_LEVEL", slog.LevelInfo),
+
+		EntitlementsFile: l.string("ENTITLEMENTS_FILE", ""),
+
+		AutoMigrate: l.bool("AUTO_MIGRATE", false),
+
+		Host:              l.string("HOST", ""),
+		Port:              l.int("PORT", 8080),
+		ReadTimeout:       l.duration("READ_TIMEOUT", 30*time.Second),
+		ReadHeaderTimeout: l.duration("READ_HEADER_TIMEOUT", 5*time.Second),
+		WriteTimeout:      l.duration("WRITE_TIMEOUT", 30*time.Second),
+		IdleTimeout:       l.duration("IDLE_TIMEOUT", 120*time.Second),
+		MaxHeaderBytes:    l.int("MAX_HEADER_BYTES", 64<<10),
+		ShutdownTimeout:   l.duration("SHUTDOWN_TIMEOUT", 20*time.Second),
+		ShutdownDelay:     l.duration("SHUTDOWN_DELAY", 5*time.Second),
+
+		AccessTokenTTL:  l.duration("ACCESS_TOKEN_TTL", time.Hour),
+		RefreshTokenTTL: l.duration("REFRESH_TOKEN_TTL", 60*24*time.Hour),
+
+		PublicURL:     strings.TrimRight(l.string("PUBLIC_URL", "http://localhost:8080"), "/"),
+		OIDCProviders: l.oidcProviders(),
+
+		TraceExporter: l.string("TRACE_EXPORTER", "none"),
+		TraceFile:     l.string("TRACE_FILE", "traces.jsonl"),
+		OTLPEndpoint:  l.string("OTLP_ENDPOINT", "http://localhost:4318/v1/traces"),
+		ServiceName:   l.string("SERVICE_NAME", "chirpy"),
+	}
+
+	cfg.validate(l)
+
+	if len(l.problems) > 0 {
+		return nil, &ValidationError{Problems: l.problems}
+	}
+
+	return cfg, nil
+}
+
+func (c *Config) validate(l *loader) {
+	if c.DBURL == "" {
+		l.problem("DB_URL is required")
+	} else if u, err := url.Parse(c.DBURL); err != nil || (u.Scheme != "postgres" && u.Scheme != "postgresql") {
+		l.problem("DB_URL must be a postgres:// connection url")
+	}
+
+	if c.Platform != "dev" && c.Platform != "prod" {
+		l.problem(fmt.Sprintf("PLATFORM must be dev or prod, got %q", c.Platform))
+	}
+
+	if c.Secret == "" {
+		l.problem("SECRET is required, it signs every access token")
+	} else if len(c.Secret) < minSecretLength {
+		l.problem(fmt.Sprintf("SECRET must be at least %d bytes, got %d", minSecretLength, len(c.Secret)))
+	} else if strings.Count(c.Secret, c.Secret[:1]) == len(c.Secret) {
+		l.problem("SECRET must not be a single repeated character")
+	}
+
+	if c.PolkaKey == "" && c.PolkaWebhookSecret == "" {
+		l.problem("POLKA_KEY or POLKA_WEBHOOK_SECRET is required")
+	}
+
+	if c.Port < 1 || c.Port > 65535 {
+		l.problem(fmt.Sprintf("PORT must be between 1 and 65535, got %d", c.Port))
+	}
+
+	if c.MaxHeaderBytes < 1 {
+		l.problem("MAX_HEADER_BYTES must be positive")
+	}
+
+	if c.RefreshTokenTTL <= c.AccessTokenTTL {
+		l.problem("REFRESH_TOKEN_TTL must be longer than ACCESS_TOKEN_TTL")
+	}
+
+	if u, err := url.Parse(c.PublicURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		l.problem(fmt.Sprintf("PUBLIC_URL must be an http(s) url, got %q", c.PublicURL))
+	}
+
+	for _, p := range c.OIDCProviders {
+		key := "OIDC_" + strings.ToUpper(p.Name) + "_"
+		// the issuer vouches for who users are, so only dev may skip TLS
+		if u, err := url.Parse(p.Issuer); err != nil || u.Host == "" || (u.Scheme != "https" && !(c.IsDev() && u.Scheme == "http")) {
+			l.problem(fmt.Sprintf("%sISSUER must be an https url, got %q", key, p.Issuer))
+		}
+		if p.ClientID == "" {
+			l.problem(key + "CLIENT_ID is required")
+		}
+		if p.ClientSecret == "" {
+			l.problem(key + "CLIENT_SECRET is required")
+		}
+	}
+
+	switch c.TraceExporter {
+	case "none", "stdout", "file":
+	case "otlp":
+		if u, err := url.Parse(c.OTLPEndpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			l.problem(fmt.Sprintf("OTLP_ENDPOINT must be an http(s) url, got %q", c.OTLPEndpoint))
+		}
+	default:
+		l.problem(fmt.Sprintf("TRACE_EXPORTER must be none, stdout, file or otlp, got %q", c.TraceExporter))
+	}
+}
+
+type loader struct {
+	file     map[string]string
+	problems []string
+}
+
+func (l *loader) problem(msg string) {
+	l.problems = append(l.problems, msg)
+}
+
+func (l *loader) readFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("reading config file: %w", err)
+	}
+
+	raw := map[string]any{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &raw)
+	case ".toml":
+		raw, err = parseTOML(data)
+	default:
+		return fmt.Errorf("config file %s must end in .yaml, .yml or .toml", path)
+	}
+	if err != nil {
+		return fmt.Errorf("parsing config file %s: %w", path, err)
+	}
+
+	for key, value := range raw {
+		switch value.(type) {
+		case map[string]any, []any:
+			l.problem(fmt.Sprintf("%s: %s must be a scalar value", path, key))
+		case nil:
+		default:
+			l.file[strings.ToUpper(key)] = fmt.Sprint(value)
+		}
+	}
+
+	return nil
+}
+
+func (l *loader) lookup(key string) (string, bool) {
+	if v, ok := os.LookupEnv(key); ok {
+		return v, true
+	}
+	v, ok := l.file[key]
+	return v, ok
+}
+
+func (l *loader) string(key, def string) string {
+	v, ok := l.lookup(key)
+	if !ok || strings.TrimSpace(v) == "" {
+		return def
+	}
+	return strings.TrimSpace(v)
+}
+
+var oidcProviderName = regexp.MustCompile(`^[a-z0-9]{1,20}$`)
+
+func (l *loader) oidcProviders() []OIDCProvider {
+	var providers []OIDCProvider
+	seen := map[string]bool{}
+	for _, name := range strings.Split(l.string("OIDC_PROVIDERS", ""), ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+
+		if !oidcProviderName.MatchString(name) {
+			l.problem(fmt.Sprintf("OIDC_PROVIDERS names must be up to 20 letters or digits, got %q", name))
+			continue
+		}
+
+		key := "OIDC_" + strings.ToUpper(name) + "_"
+		providers = append(providers, OIDCProvider{
+			Name:         name,
+			Issuer:       l.string(key+"ISSUER", ""),
+			ClientID:     l.string(key+"CLIENT_ID", ""),
+			ClientSecret: l.string(key+"CLIENT_SECRET", ""),
+		})
+	}
+	return providers
+}
+
+func (l *loader) int(key string, def int) int {
+	v, ok := l.lookup(key)
+	if !ok || v == "" {
+		return def
+	}
+
+	n, err := strconv.Atoi(strings.TrimSpace(v))
+	if err != nil {
+		l.problem(fmt.Sprintf("%s must be an integer, got %q", key, v))
+		return def
+	}
+
+	return n
+}
+
+func (l *loader) bool(key string, def bool) bool {
+	v, ok := l.lookup(key)
+	if !ok || v == "" {
+		return def
+	}
+
+	b, err := strconv.ParseBool(strings.TrimSpace(v))
+	if err != nil {
+		l.problem(fmt.Sprintf("%s must be true or false, got %q", key, v))
+		return def
+	}
+
+	return b
+}
+
+func (l *loader) level(key string, def slog.Level) slog.Level {
+	v, ok := l.lookup(key)
+	if !ok || v == "" {
+		return def
+	}
+
+	var level slog.Level
+	err := level.UnmarshalText([]byte(strings.TrimSpace(v)))
+	if err != nil {
+		l.problem(fmt.Sprintf("%s must be one of debug, info, warn or error, got %q", key, v))
+		return def
+	}
+
+	return level
+}
+
+func (l *loader) duration(key string, def time.Duration) time.Duration {
+	v, ok := l.lookup(key)
+	if !ok || v == "" {
+		return def
+	}
+
+	d, err := time.ParseDuration(strings.TrimSpace(v))
+	if err != nil {
+		l.problem(fmt.Sprintf("%s must be a duration like 30s or 5m, got %q", key, v))
+		return def
+	}
+
+	if d <= 0 {
+		l.problem(fmt.Sprintf("%s must be positive, got %s", key, d))
+		return def
+	}
+
+	return d
+}
@@ -0,0 +1,161 @@
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var tomlBareKey = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// parseTOML reads the flat subset of TOML a config file needs: top level
+// key = value pairs whose values are strings, integers, floats, booleans or
+// dates. Tables, dotted keys and arrays come back as map[string]any or
+// []any so readFile reports them like their YAML equivalents; multi-line
+// values aren't supported.
+func parseTOML(data []byte) (map[string]any, error) {
+	raw := map[string]any{}
+	// keys under a [table] header aren't top level, they're skipped once
+	// the table itself has been recorded
+	inTable := false
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") {
+			name := strings.Trim(stripTOMLComment(line), "[] \t")
+			if name == "" {
+				return nil, fmt.Errorf("line %d: empty table name", n)
+			}
+			key, _, _ := strings.Cut(name, ".")
+			raw[strings.TrimSpace(key)] = map[string]any{}
+			inTable = true
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected key = value", n)
+		}
+		key = strings.TrimSpace(key)
+		if inTable {
+			continue
+		}
+
+		if strings.Contains(key, ".") && !strings.HasPrefix(key, `"`) {
+			first, _, _ := strings.Cut(key, ".")
+			raw[strings.TrimSpace(first)] = map[string]any{}
+			continue
+		}
+		key, err := parseTOMLKey(key)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		if _, dup := raw[key]; dup {
+			return nil, fmt.Errorf("line %d: %s is defined twice", n, key)
+		}
+
+		parsed, err := parseTOMLValue(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s: %w", n, key, err)
+		}
+		raw[key] = parsed
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return raw, nil
+}
+
+func parseTOMLKey(key string) (string, error) {
+	switch {
+	case strings.HasPrefix(key, `"`):
+		return strconv.Unquote(key)
+	case strings.HasPrefix(key, "'") && strings.HasSuffix(key, "'") && len(key) >= 2:
+		return key[1 : len(key)-1], nil
+	case tomlBareKey.MatchString(key):
+		return key, nil
+	default:
+		return "", fmt.Errorf("invalid key %q", key)
+	}
+}
+
+func parseTOMLValue(v string) (any, error) {
+	switch {
+	case strings.HasPrefix(v, `"""`), strings.HasPrefix(v, "'''"):
+		return nil, fmt.Errorf("multi-line strings are not supported")
+	case strings.HasPrefix(v, `"`):
+		end := closingQuote(v)
+		if end < 0 {
+			return nil, fmt.Errorf("unterminated string")
+		}
+		if rest := stripTOMLComment(v[end+1:]); strings.TrimSpace(rest) != "" {
+			return nil, fmt.Errorf("unexpected %q after string", rest)
+		}
+		return strconv.Unquote(v[:end+1])
+	case strings.HasPrefix(v, "'"):
+		end := strings.Index(v[1:], "'")
+		if end < 0 {
+			return nil, fmt.Errorf("unterminated string")
+		}
+		if rest := stripTOMLComment(v[end+2:]); strings.TrimSpace(rest) != "" {
+			return nil, fmt.Errorf("unexpected %q after string", rest)
+		}
+		return v[1 : end+1], nil
+	case strings.HasPrefix(v, "["):
+		return []any{}, nil
+	case strings.HasPrefix(v, "{"):
+		return map[string]any{}, nil
+	}
+
+	v = strings.TrimSpace(stripTOMLComment(v))
+	switch v {
+	case "":
+		return nil, fmt.Errorf("missing value")
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	}
+
+	number := strings.ReplaceAll(v, "_", "")
+	if i, err := strconv.ParseInt(number, 0, 64); err == nil {
+		return i, nil
+	}
+	if f, err := strconv.ParseFloat(number, 64); err == nil {
+		return f, nil
+	}
+	// dates and times are kept as written
+	if v[0] >= '0' && v[0] <= '9' && !strings.ContainsAny(v, " \t") {
+		return v, nil
+	}
+
+	return nil, fmt.Errorf("invalid value %q, strings must be quoted", v)
+}
+
+// closingQuote returns the index of the quote ending the basic string v
+// starts with, skipping escaped ones.
+func closingQuote(v string) int {
+	for i := 1; i < len(v); i++ {
+		switch v[i] {
+		case '\\':
+			i++
+		case '"':
+			return i
+		}
+	}
+	return -1
+}
+
+func stripTOMLComment(s string) string {
+	before, _, _ := strings.Cut(s, "#")
+	return before
+}
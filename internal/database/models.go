@@ -6,11 +6,25 @@ package database
 
 import (
 	"database/sql"
+	"encoding/json"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+type ApiKey struct {
+	ID         uuid.UUID
+	CreatedAt  time.Time
+	UserID     uuid.UUID
+	Name       string
+	Prefix     string
+	KeyHash    string
+	Scopes     []string
+	RateLimit  sql.NullInt32
+	LastUsedAt sql.NullTime
+	RevokedAt  sql.NullTime
+}
+
 type Chirp struct {
 	ID        uuid.UUID
 	CreatedAt time.Time
@@ -19,6 +33,107 @@ type Chirp struct {
 	UserID    uuid.UUID
 }
 
+type ChirpAttachment struct {
+	ChirpID  uuid.UUID
+	MediaID  uuid.UUID
+	Position int32
+}
+
+type EndpointDelivery struct {
+	ID             uuid.UUID
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+	EndpointID     uuid.UUID
+	EventType      string
+	Payload        json.RawMessage
+	Status         string
+	Attempts       int32
+	ResponseStatus sql.NullInt32
+	ResponseBody   sql.NullString
+	Error          sql.NullString
+	DurationMs     sql.NullInt32
+	DeliveredAt    sql.NullTime
+}
+
+type Follow struct {
+	FollowerID uuid.UUID
+	FolloweeID uuid.UUID
+	CreatedAt  time.Time
+}
+
+type Job struct {
+	ID          uuid.UUID
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	Kind        string
+	Payload     json.RawMessage
+	Status      string
+	Attempts    int32
+	MaxAttempts int32
+	RunAt       time.Time
+	LockedUntil sql.NullTime
+	LastError   sql.NullString
+}
+
+type MediaFile struct {
+	ID          uuid.UUID
+	CreatedAt   time.Time
+	UserID      uuid.UUID
+	Kind        string
+	StorageKey  string
+	ContentType string
+	SizeBytes   int64
+}
+
+type MediaVariant struct {
+	MediaID     uuid.UUID
+	Width       int32
+	Format      string
+	CreatedAt   time.Time
+	Height      int32
+	StorageKey  string
+	ContentType string
+	SizeBytes   int64
+}
+
+type OauthClient struct {
+	ID           uuid.UUID
+	CreatedAt    time.Time
+	OwnerID      uuid.UUID
+	ClientID     string
+	SecretHash   sql.NullString
+	Name         string
+	RedirectUris []string
+	Scopes       []string
+}
+
+type OauthCode struct {
+	CodeHash            string
+	CreatedAt           time.Time
+	ExpiresAt           time.Time
+	ClientID            uuid.UUID
+	UserID              uuid.UUID
+	RedirectUri         string
+	Scopes              []string
+	CodeChallenge       string
+	CodeChallengeMethod string
+	UsedAt              sql.NullTime
+	GrantID             uuid.NullUUID
+}
+
+type OauthGrant struct {
+	ID                       uuid.UUID
+	CreatedAt                time.Time
+	UpdatedAt                time.Time
+	ClientID                 uuid.UUID
+	UserID                   uuid.UUID
+	Scopes                   []string
+	RefreshTokenHash         string
+	RefreshExpiresAt         time.Time
+	RevokedAt                sql.NullTime
+	PreviousRefreshTokenHash sql.NullString
+}
+
 type RefreshToken struct {
 	Token     string
 	CreatedAt time.Time
@@ -28,11 +143,103 @@ type RefreshToken struct {
 	RevokedAt sql.NullTime
 }
 
+type Subscription struct {
+	ID               uuid.UUID
+	CreatedAt        time.Time
+	UpdatedAt        time.Time
+	UserID           uuid.UUID
+	Provider         string
+	ExternalID       sql.NullString
+	Plan             string
+	Status           string
+	CurrentPeriodEnd sql.NullTime
+}
+
+type SubscriptionEvent struct {
+	ID               uuid.UUID
+	CreatedAt        time.Time
+	SubscriptionID   uuid.UUID
+	EventType        string
+	Status           string
+	CurrentPeriodEnd sql.NullTime
+}
+
 type User struct {
 	ID             uuid.UUID
 	CreatedAt      time.Time
 	UpdatedAt      time.Time
 	Email          string
-	HashedPassword string
+	HashedPassword sql.NullString
 	IsChirpyRed    bool
+	Handle         sql.NullString
+	DisplayName    string
+	Bio            string
+	AvatarUrl      string
+	Role           string
+}
+
+type UserIdentity struct {
+	ID          uuid.UUID
+	CreatedAt   time.Time
+	UserID      uuid.UUID
+	Provider    string
+	Subject     string
+	Email       string
+	LastLoginAt sql.NullTime
+}
+
+type WebauthnChallenge struct {
+	Challenge string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	Ceremony  string
+	UserID    uuid.NullUUID
+}
+
+type WebauthnCredential struct {
+	ID           uuid.UUID
+	CreatedAt    time.Time
+	UserID       uuid.UUID
+	Name         string
+	CredentialID []byte
+	PublicKey    []byte
+	SignCount    int64
+	Transports   []string
+	LastUsedAt   sql.NullTime
+}
+
+type WebhookDelivery struct {
+	ID             uuid.UUID
+	ReceivedAt     time.Time
+	Provider       string
+	Headers        json.RawMessage
+	Body           []byte
+	EventID        sql.NullString
+	EventType      sql.NullString
+	Status         string
+	ResponseStatus sql.NullInt32
+	Error          sql.NullString
+	Attempts       int32
+	ProcessedAt    sql.NullTime
+}
+
+type WebhookEndpoint struct {
+	ID                  uuid.UUID
+	CreatedAt           time.Time
+	UpdatedAt           time.Time
+	UserID              uuid.UUID
+	Url                 string
+	Secret              string
+	EventTypes          []string
+	Enabled             bool
+	ConsecutiveFailures int32
+	DisabledAt          sql.NullTime
+	DisabledReason      sql.NullString
+}
+
+type WebhookEvent struct {
+	Provider   string
+	EventID    string
+	EventType  string
+	ReceivedAt time.Time
 }
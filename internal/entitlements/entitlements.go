@@ -0,0 +1,171 @@
+// Package entitlements maps a user's plan to what it unlocks. Handlers ask
+// for a user's Entitlements instead of checking is_chirpy_red themselves, so
+// changing what Red includes is a config change.
+package entitlements
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	PlanFree      = "free"
+	PlanChirpyRed = "chirpy_red"
+)
+
+// maxChirpLength bounds what a config file can set. Chirp requests are
+// capped at 8KB, which has to fit the longest chirp in any encoding.
+const maxChirpLength = 1_000
+
+type RateLimit struct {
+	// PerMinute is the sustained rate, Burst how many may arrive at once.
+	PerMinute int `yaml:"per_minute"`
+	Burst     int `yaml:"burst"`
+}
+
+type Entitlements struct {
+	MaxChirpLength int       `yaml:"max_chirp_length"`
+	EditChirps     bool      `yaml:"edit_chirps"`
+	RateLimit      RateLimit `yaml:"rate_limit"`
+	// Badge is shown on the public profile, empty for none.
+	Badge string `yaml:"badge"`
+}
+
+type Plans map[string]Entitlements
+
+func Default() Plans {
+	return Plans{
+		PlanFree: {
+			MaxChirpLength: 140,
+			RateLimit:      RateLimit{PerMinute: 30, Burst: 10},
+		},
+		PlanChirpyRed: {
+			MaxChirpLength: 500,
+			EditChirps:     true,
+			RateLimit:      RateLimit{PerMinute: 120, Burst: 30},
+			Badge:          "chirpy_red",
+		},
+	}
+}
+
+// For returns the entitlements of plan, falling back to the free plan for
+// plans the config doesn't know.
+func (p Plans) For(plan string) Entitlements {
+	if e, ok := p[plan]; ok {
+		return e
+	}
+	return p[PlanFree]
+}
+
+// PlanFor is the plan a user is on. Red is the only paid plan, and
+// is_chirpy_red is already derived from the user's subscriptions.
+func PlanFor(isChirpyRed bool) string {
+	if isChirpyRed {
+		return PlanChirpyRed
+	}
+	return PlanFree
+}
+
+// patch has pointer fields so a file only overrides what it mentions.
+type patch struct {
+	MaxChirpLength *int  `yaml:"max_chirp_length"`
+	EditChirps     *bool `yaml:"edit_chirps"`
+	RateLimit      *struct {
+		PerMinute *int `yaml:"per_minute"`
+		Burst     *int `yaml:"burst"`
+	} `yaml:"rate_limit"`
+	Badge *string `yaml:"badge"`
+}
+
+// Load applies the YAML file at path on top of the defaults. An empty path
+// returns the defaults. The file looks like:
+//
+//	plans:
+//	  chirpy_red:
+//	    max_chirp_length: 280
+//	    rate_limit:
+//	      per_minute: 60
+func Load(path string) (Plans, error) {
+	plans := Default()
+	if path == "" {
+		return plans, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading entitlements file: %w", err)
+	}
+
+	var file struct {
+		Plans map[string]patch `yaml:"plans"`
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	err = dec.Decode(&file)
+	if err != nil {
+		return nil, fmt.Errorf("parsing entitlements file %s: %w", path, err)
+	}
+
+	for name, p := range file.Plans {
+		e := plans[name]
+		if p.MaxChirpLength != nil {
+			e.MaxChirpLength = *p.MaxChirpLength
+		}
+		if p.EditChirps != nil {
+			e.EditChirps = *p.EditChirps
+		}
+		if p.RateLimit != nil {
+			if p.RateLimit.PerMinute != nil {
+				e.RateLimit.PerMinute = *p.RateLimit.PerMinute
+			}
+			if p.RateLimit.Burst != nil {
+				e.RateLimit.Burst = *p.RateLimit.Burst
+			}
+		}
+		if p.Badge != nil {
+			e.Badge = *p.Badge
+		}
+		plans[name] = e
+	}
+
+	err = plans.validate()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return plans, nil
+}
+
+func (p Plans) validate() error {
+	names := make([]string, 0, len(p))
+	for name := range p {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	var problems []string
+	for _, name := range names {
+		e := p[name]
+		if e.MaxChirpLength < 1 || e.MaxChirpLength > maxChirpLength {
+			problems = append(problems, fmt.Sprintf("%s: max_chirp_length must be between 1 and %d", name, maxChirpLength))
+		}
+		if e.RateLimit.PerMinute < 1 {
+			problems = append(problems, fmt.Sprintf("%s: rate_limit.per_minute must be positive", name))
+		}
+		if e.RateLimit.Burst < 1 {
+			problems = append(problems, fmt.Sprintf("%s: rate_limit.burst must be positive", name))
+		}
+	}
+
+	if len(problems) > 0 {
+		return errors.New("invalid entitlements: " + strings.Join(problems, "; "))
+	}
+
+	return nil
+}
@@ -0,0 +1,80 @@
+package entitlements
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "entitlements.yaml")
+	err := os.WriteFile(path, []byte(content), 0o644)
+	if err != nil {
+		t.Fatalf("Error writing file: %v", err)
+	}
+	return path
+}
+
+func TestDefaultsRedUnlocksMore(t *testing.T) {
+	plans := Default()
+	free, red := plans.For(PlanFree), plans.For(PlanChirpyRed)
+
+	if free.MaxChirpLength != 140 {
+		t.Errorf("Free chirps should keep the 140 character limit, got %d", free.MaxChirpLength)
+	}
+	if red.MaxChirpLength <= free.MaxChirpLength || !red.EditChirps || free.EditChirps {
+		t.Errorf("Red should allow longer chirps and editing: free %+v, red %+v", free, red)
+	}
+	if red.RateLimit.PerMinute <= free.RateLimit.PerMinute || red.Badge == "" {
+		t.Errorf("Red should have a higher rate limit and a badge: %+v", red)
+	}
+	if plans.For("gold").MaxChirpLength != free.MaxChirpLength {
+		t.Errorf("Unknown plans should fall back to free")
+	}
+}
+
+func TestLoadOverridesOnlyWhatItMentions(t *testing.T) {
+	path := writeFile(t, `
+plans:
+  chirpy_red:
+    max_chirp_length: 280
+    rate_limit:
+      burst: 50
+`)
+
+	plans, err := Load(path)
+	if err != nil {
+		t.Fatalf("Error loading entitlements: %v", err)
+	}
+
+	red := plans.For(PlanChirpyRed)
+	if red.MaxChirpLength != 280 || red.RateLimit.Burst != 50 {
+		t.Errorf("File values should apply: %+v", red)
+	}
+	if red.RateLimit.PerMinute != Default()[PlanChirpyRed].RateLimit.PerMinute || !red.EditChirps {
+		t.Errorf("Unmentioned values should keep their defaults: %+v", red)
+	}
+}
+
+func TestLoadRejectsBadFiles(t *testing.T) {
+	cases := map[string]string{
+		"typo":         "plans:\n  free:\n    max_chirp_lenght: 200\n",
+		"zero length":  "plans:\n  free:\n    max_chirp_length: 0\n",
+		"zero rate":    "plans:\n  free:\n    rate_limit:\n      per_minute: 0\n",
+		"missing rate": "plans:\n  gold:\n    max_chirp_length: 300\n",
+	}
+
+	for name, content := range cases {
+		_, err := Load(writeFile(t, content))
+		if err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+
+	_, err := Load(writeFile(t, "plans:\n  free:\n    max_chirp_length: 0\n    rate_limit:\n      burst: 0\n"))
+	if err == nil || !strings.Contains(err.Error(), "max_chirp_length") || !strings.Contains(err.Error(), "burst") {
+		t.Errorf("Every problem should be reported, got %v", err)
+	}
+}
@@ -0,0 +1,108 @@
+// Package httpjson decodes JSON request bodies strictly: the body must be
+// declared as JSON, fit in a size limit, hold exactly one value and use only
+// known fields. Failures come back as *apierror.Error values.
+package httpjson
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/nickemp1996/chirpy/internal/apierror"
+)
+
+type options struct {
+	allowUnknown bool
+}
+
+type Option func(*options)
+
+// AllowUnknownFields is for payloads we don't control, such as third party
+// webhooks, which may add fields at any time.
+func AllowUnknownFields() Option {
+	return func(o *options) { o.allowUnknown = true }
+}
+
+// Decode reads r's body into dst, allowing at most limit bytes.
+func Decode(w http.ResponseWriter, r *http.Request, dst any, limit int64, opts ...Option) error {
+	data, err := ReadBody(w, r, limit)
+	if err != nil {
+		return err
+	}
+	return Unmarshal(data, dst, opts...)
+}
+
+// ReadBody checks the content type and returns the raw body, for handlers
+// that need the exact bytes, e.g. to verify a signature, before decoding.
+func ReadBody(w http.ResponseWriter, r *http.Request, limit int64) ([]byte, error) {
+	err := checkContentType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, limit))
+	if err != nil {
+		return nil, apierror.From(err)
+	}
+
+	return data, nil
+}
+
+// Unmarshal decodes data into dst with the same rules as Decode.
+func Unmarshal(data []byte, dst any, opts ...Option) error {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if !o.allowUnknown {
+		dec.DisallowUnknownFields()
+	}
+
+	err := dec.Decode(dst)
+	if err != nil {
+		return decodeError(err)
+	}
+
+	// a second value, or garbage after the first, means the client sent
+	// something other than what it thinks it sent
+	err = dec.Decode(&struct{}{})
+	if !errors.Is(err, io.EOF) {
+		return apierror.New(http.StatusBadRequest, apierror.CodeInvalidJSON, "request body must contain a single JSON value", err)
+	}
+
+	return nil
+}
+
+func checkContentType(header string) error {
+	if header == "" {
+		return apierror.UnsupportedMediaType("Content-Type must be application/json", nil)
+	}
+
+	mediaType, _, err := mime.ParseMediaType(header)
+	if err != nil {
+		return apierror.UnsupportedMediaType("Content-Type must be application/json", err)
+	}
+
+	if mediaType != "application/json" && !(strings.HasPrefix(mediaType, "application/") && strings.HasSuffix(mediaType, "+json")) {
+		return apierror.UnsupportedMediaType(fmt.Sprintf("Content-Type must be application/json, got %s", mediaType), nil)
+	}
+
+	return nil
+}
+
+func decodeError(err error) error {
+	// encoding/json has no typed error for unknown fields
+	if field, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+		field = strings.Trim(field, `"`)
+		return apierror.New(http.StatusBadRequest, apierror.CodeInvalidJSON, fmt.Sprintf("unknown field %q", field), err)
+	}
+
+	return apierror.From(err)
+}
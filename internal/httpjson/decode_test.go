@@ -0,0 +1,82 @@
+package httpjson
+
+import (
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/nickemp1996/chirpy/internal/apierror"
+)
+
+type chirpParams struct {
+	Body string `json:"body"`
+}
+
+func decode(contentType, body string, limit int64, opts ...Option) (chirpParams, error) {
+	req := httptest.NewRequest("POST", "/api/chirps", strings.NewReader(body))
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	var params chirpParams
+	err := Decode(httptest.NewRecorder(), req, &params, limit, opts...)
+	return params, err
+}
+
+func TestDecodeAcceptsValidBody(t *testing.T) {
+	for _, ct := range []string{"application/json", "application/json; charset=utf-8", "application/merge-patch+json"} {
+		params, err := decode(ct, `{"body": "hello"}`+"\n", 1024)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", ct, err)
+		}
+		if params.Body != "hello" {
+			t.Errorf("%s: body should decode, got %q", ct, params.Body)
+		}
+	}
+}
+
+func TestDecodeRejections(t *testing.T) {
+	cases := []struct {
+		name        string
+		contentType string
+		body        string
+		limit       int64
+		status      int
+		code        apierror.Code
+	}{
+		{"missing content type", "", `{"body": "hi"}`, 1024, 415, apierror.CodeUnsupportedMediaType},
+		{"form content type", "application/x-www-form-urlencoded", `{"body": "hi"}`, 1024, 415, apierror.CodeUnsupportedMediaType},
+		{"too large", "application/json", `{"body": "` + strings.Repeat("a", 100) + `"}`, 32, 413, apierror.CodePayloadTooLarge},
+		{"unknown field", "application/json", `{"body": "hi", "bdoy": "typo"}`, 1024, 400, apierror.CodeInvalidJSON},
+		{"trailing data", "application/json", `{"body": "hi"} {"body": "again"}`, 1024, 400, apierror.CodeInvalidJSON},
+		{"trailing garbage", "application/json", `{"body": "hi"}x`, 1024, 400, apierror.CodeInvalidJSON},
+		{"malformed", "application/json", `{"body": `, 1024, 400, apierror.CodeInvalidJSON},
+		{"empty", "application/json", ``, 1024, 400, apierror.CodeInvalidJSON},
+		{"wrong type", "application/json", `{"body": true}`, 1024, 400, apierror.CodeInvalidJSON},
+	}
+
+	for _, c := range cases {
+		_, err := decode(c.contentType, c.body, c.limit)
+		var apiErr *apierror.Error
+		if !errors.As(err, &apiErr) {
+			t.Errorf("%s: expected an *apierror.Error, got %v", c.name, err)
+			continue
+		}
+		if apiErr.Status != c.status || apiErr.Code != c.code {
+			t.Errorf("%s: expected %d %s, got %d %s (%s)", c.name, c.status, c.code, apiErr.Status, apiErr.Code, apiErr.Detail)
+		}
+	}
+}
+
+func TestDecodeUnknownFieldNamesField(t *testing.T) {
+	_, err := decode("application/json", `{"body": "hi", "bdoy": "typo"}`, 1024)
+	if err == nil || !strings.Contains(err.Error(), `"bdoy"`) {
+		t.Errorf("The error should name the unknown field, got %v", err)
+	}
+
+	_, err = decode("application/json", `{"body": "hi", "extra": 1}`, 1024, AllowUnknownFields())
+	if err != nil {
+		t.Errorf("AllowUnknownFields should accept extra fields, got %v", err)
+	}
+}
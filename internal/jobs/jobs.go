@@ -0,0 +1,315 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nickemp1996/chirpy/internal/database"
+)
+
+const (
+	DefaultMaxAttempts  = 8
+	DefaultConcurrency  = 4
+	DefaultPollInterval = time.Second
+	DefaultJobTimeout   = time.Minute
+
+	baseBackoff = 5 * time.Second
+	maxBackoff  = time.Hour
+)
+
+// Store is the subset of database.Queries the queue needs.
+type Store interface {
+	EnqueueJob(ctx context.Context, arg database.EnqueueJobParams) (database.Job, error)
+	ClaimJobs(ctx context.Context, arg database.ClaimJobsParams) ([]database.Job, error)
+	KillLapsedJobs(ctx context.Context) (int64, error)
+	CompleteJob(ctx context.Context, arg database.CompleteJobParams) (int64, error)
+	RetryJob(ctx context.Context, arg database.RetryJobParams) (int64, error)
+	KillJob(ctx context.Context, arg database.KillJobParams) (int64, error)
+}
+
+type handlerFunc func(ctx context.Context, payload json.RawMessage) error
+
+// Queue runs jobs stored in the jobs table. Jobs are claimed with
+// FOR UPDATE SKIP LOCKED so any number of processes can share the table.
+type Queue struct {
+	store    Store
+	handlers map[string]handlerFunc
+
+	Concurrency  int
+	PollInterval time.Duration
+	JobTimeout   time.Duration
+
+	inFlight sync.WaitGroup
+	// stopped is closed when Run returns, after which nothing adds to inFlight
+	stopped chan struct{}
+}
+
+func New(store Store) *Queue {
+	return &Queue{
+		store:        store,
+		handlers:     map[string]handlerFunc{},
+		Concurrency:  DefaultConcurrency,
+		PollInterval: DefaultPollInterval,
+		JobTimeout:   DefaultJobTimeout,
+		stopped:      make(chan struct{}),
+	}
+}
+
+// Register installs the handler for a job kind. The stored JSON payload is
+// decoded into T before fn is called; a payload that doesn't decode is dead
+// lettered straight away since retrying can't fix it.
+func Register[T any](q *Queue, kind string, fn func(ctx context.Context, payload T) error) {
+	q.handlers[kind] = func(ctx context.Context, raw json.RawMessage) error {
+		var payload T
+		err := json.Unmarshal(raw, &payload)
+		if err != nil {
+			return Permanent(fmt.Errorf("decoding payload: %w", err))
+		}
+		return fn(ctx, payload)
+	}
+}
+
+type options struct {
+	runAt       time.Time
+	maxAttempts int32
+}
+
+type Option func(*options)
+
+// RunAt schedules the job to run no earlier than t.
+func RunAt(t time.Time) Option {
+	return func(o *options) { o.runAt = t }
+}
+
+// Delay schedules the job to run after d.
+func Delay(d time.Duration) Option {
+	return func(o *options) { o.runAt = time.Now().Add(d) }
+}
+
+func MaxAttempts(n int) Option {
+	return func(o *options) { o.maxAttempts = int32(n) }
+}
+
+func (q *Queue) Enqueue(ctx context.Context, kind string, payload any, opts ...Option) (uuid.UUID, error) {
+	o := options{
+		runAt:       time.Now(),
+		maxAttempts: DefaultMaxAttempts,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	jobParams := database.EnqueueJobParams{
+		Kind:        kind,
+		Payload:     data,
+		MaxAttempts: o.maxAttempts,
+		RunAt:       o.runAt,
+	}
+
+	job, err := q.store.EnqueueJob(ctx, jobParams)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	return job.ID, nil
+}
+
+// Run polls for due jobs until ctx is cancelled. It stops claiming new work
+// as soon as ctx is done; use Drain to wait for jobs already running. Run
+// may only be called once per Queue.
+func (q *Queue) Run(ctx context.Context) {
+	defer close(q.stopped)
+
+	slots := make(chan struct{}, q.Concurrency)
+	ticker := time.NewTicker(q.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		free := q.Concurrency - len(slots)
+		if free > 0 {
+			claimed, err := q.claim(ctx, free)
+			if err != nil && ctx.Err() == nil {
+				slog.Error("error claiming jobs", "err", err)
+			}
+
+			for _, job := range claimed {
+				slots <- struct{}{}
+				q.inFlight.Add(1)
+				go func() {
+					defer func() {
+						<-slots
+						q.inFlight.Done()
+					}()
+					q.runJob(job)
+				}()
+			}
+
+			// a full batch means there's probably more waiting, don't sleep
+			if len(claimed) == free {
+				continue
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Drain waits for Run to return and in-flight jobs to finish, or for ctx to
+// expire, so it must be called after cancelling Run's context. Jobs that are
+// still running when ctx expires keep their lock and are picked up again by
+// another worker once it lapses.
+func (q *Queue) Drain(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		// Run may still be starting jobs it claimed just before ctx was
+		// cancelled, and Wait can't race with Add
+		<-q.stopped
+		q.inFlight.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (q *Queue) claim(ctx context.Context, limit int) ([]database.Job, error) {
+	killed, err := q.store.KillLapsedJobs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if killed > 0 {
+		slog.Warn("jobs dead lettered after their lock lapsed on the final attempt", "count", killed)
+	}
+
+	claimParams := database.ClaimJobsParams{
+		// leave the handler time to record its result before the lock lapses
+		LockedUntil: sql.NullTime{Time: time.Now().Add(q.JobTimeout * 2), Valid: true},
+		Limit:       int32(limit),
+	}
+
+	return q.store.ClaimJobs(ctx, claimParams)
+}
+
+// runJob executes a claimed job and records the outcome. It deliberately
+// doesn't use the Run context, so shutting down lets running jobs finish.
+func (q *Queue) runJob(job database.Job) {
+	ctx, cancel := context.WithTimeout(context.Background(), q.JobTimeout)
+	defer cancel()
+
+	err := q.execute(ctx, job)
+
+	// record the outcome even if the job used up its own deadline
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err == nil {
+		updated, err := q.store.CompleteJob(ctx, database.CompleteJobParams{ID: job.ID, Attempts: job.Attempts})
+		if err != nil {
+			slog.Error("error completing job", "job_id", job.ID, "err", err)
+			return
+		}
+		logLapsed(job, updated)
+		return
+	}
+
+	lastError := sql.NullString{String: err.Error(), Valid: true}
+	if IsPermanent(err) || job.Attempts >= job.MaxAttempts {
+		slog.Warn("job dead lettered", "job_id", job.ID, "kind", job.Kind, "attempts", job.Attempts, "err", err)
+		updated, killErr := q.store.KillJob(ctx, database.KillJobParams{ID: job.ID, LastError: lastError, Attempts: job.Attempts})
+		if killErr != nil {
+			slog.Error("error dead lettering job", "job_id", job.ID, "err", killErr)
+			return
+		}
+		logLapsed(job, updated)
+		return
+	}
+
+	retryParams := database.RetryJobParams{
+		ID:        job.ID,
+		RunAt:     time.Now().Add(Backoff(int(job.Attempts))),
+		LastError: lastError,
+		Attempts:  job.Attempts,
+	}
+
+	updated, retryErr := q.store.RetryJob(ctx, retryParams)
+	if retryErr != nil {
+		slog.Error("error rescheduling job", "job_id", job.ID, "err", retryErr)
+		return
+	}
+	logLapsed(job, updated)
+}
+
+// logLapsed notes an outcome that wasn't recorded because the job's lock
+// lapsed and it was claimed again, or dead lettered, while it ran.
+func logLapsed(job database.Job, updated int64) {
+	if updated == 0 {
+		slog.Warn("job outlived its lock, outcome not recorded", "job_id", job.ID, "kind", job.Kind, "attempt", job.Attempts)
+	}
+}
+
+func (q *Queue) execute(ctx context.Context, job database.Job) (err error) {
+	handler, ok := q.handlers[job.Kind]
+	if !ok {
+		return Permanent(fmt.Errorf("no handler registered for job kind %q", job.Kind))
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("job panicked: %v", r)
+		}
+	}()
+
+	return handler(ctx, job.Payload)
+}
+
+// Backoff returns how long to wait before the next attempt: exponential from
+// baseBackoff, capped at maxBackoff, with up to 20% jitter so a burst of
+// failures doesn't retry in lockstep.
+func Backoff(attempt int) time.Duration {
+	d := maxBackoff
+	if attempt < 20 {
+		d = min(baseBackoff<<max(attempt-1, 0), maxBackoff)
+	}
+
+	jitter := time.Duration(rand.Int64N(int64(d/5) + 1))
+
+	return d + jitter
+}
+
+type permanentError struct {
+	err error
+}
+
+func (e permanentError) Error() string { return e.err.Error() }
+func (e permanentError) Unwrap() error { return e.err }
+
+// Permanent marks an error as not worth retrying; the job is dead lettered.
+func Permanent(err error) error {
+	return permanentError{err: err}
+}
+
+func IsPermanent(err error) bool {
+	var p permanentError
+	return errors.As(err, &p)
+}
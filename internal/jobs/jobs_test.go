@@ -0,0 +1,288 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nickemp1996/chirpy/internal/database"
+)
+
+// memStore is an in-memory Store that hands each pending job out once.
+type memStore struct {
+	mu   sync.Mutex
+	jobs map[uuid.UUID]*database.Job
+}
+
+func newMemStore() *memStore {
+	return &memStore{jobs: map[uuid.UUID]*database.Job{}}
+}
+
+func (s *memStore) EnqueueJob(ctx context.Context, arg database.EnqueueJobParams) (database.Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job := &database.Job{
+		ID:          uuid.New(),
+		Kind:        arg.Kind,
+		Payload:     arg.Payload,
+		Status:      "pending",
+		MaxAttempts: arg.MaxAttempts,
+		RunAt:       arg.RunAt,
+	}
+	s.jobs[job.ID] = job
+	return *job, nil
+}
+
+func (s *memStore) ClaimJobs(ctx context.Context, arg database.ClaimJobsParams) ([]database.Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	claimed := []database.Job{}
+	for _, job := range s.jobs {
+		if len(claimed) == int(arg.Limit) {
+			break
+		}
+		lapsed := job.Status == "running" && job.LockedUntil.Time.Before(time.Now()) && job.Attempts < job.MaxAttempts
+		if (job.Status == "pending" && !job.RunAt.After(time.Now())) || lapsed {
+			job.Status = "running"
+			job.Attempts++
+			job.LockedUntil = arg.LockedUntil
+			claimed = append(claimed, *job)
+		}
+	}
+	return claimed, nil
+}
+
+func (s *memStore) KillLapsedJobs(ctx context.Context) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var killed int64
+	for _, job := range s.jobs {
+		if job.Status == "running" && job.LockedUntil.Time.Before(time.Now()) && job.Attempts >= job.MaxAttempts {
+			job.Status = "dead"
+			killed++
+		}
+	}
+	return killed, nil
+}
+
+// holds reports whether the attempt still holds the job.
+func (s *memStore) holds(id uuid.UUID, attempts int32) bool {
+	return s.jobs[id].Status == "running" && s.jobs[id].Attempts == attempts
+}
+
+func (s *memStore) CompleteJob(ctx context.Context, arg database.CompleteJobParams) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.holds(arg.ID, arg.Attempts) {
+		return 0, nil
+	}
+	s.jobs[arg.ID].Status = "succeeded"
+	return 1, nil
+}
+
+func (s *memStore) RetryJob(ctx context.Context, arg database.RetryJobParams) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.holds(arg.ID, arg.Attempts) {
+		return 0, nil
+	}
+	s.jobs[arg.ID].Status = "pending"
+	// run retries immediately so the test doesn't wait out the backoff
+	s.jobs[arg.ID].RunAt = time.Now()
+	return 1, nil
+}
+
+func (s *memStore) KillJob(ctx context.Context, arg database.KillJobParams) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.holds(arg.ID, arg.Attempts) {
+		return 0, nil
+	}
+	s.jobs[arg.ID].Status = "dead"
+	s.jobs[arg.ID].LastError = arg.LastError
+	return 1, nil
+}
+
+func (s *memStore) status(id uuid.UUID) (string, int32) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.jobs[id].Status, s.jobs[id].Attempts
+}
+
+type greeting struct {
+	Name string `json:"name"`
+}
+
+func runUntil(t *testing.T, q *Queue, done func() bool) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	go q.Run(ctx)
+	defer func() {
+		cancel()
+		q.Drain(context.Background())
+	}()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for !done() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for jobs")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestJobSucceeds(t *testing.T) {
+	store := newMemStore()
+	q := New(store)
+	q.PollInterval = time.Millisecond
+
+	var mu sync.Mutex
+	got := ""
+	Register(q, "greet", func(ctx context.Context, g greeting) error {
+		mu.Lock()
+		defer mu.Unlock()
+		got = g.Name
+		return nil
+	})
+
+	id, err := q.Enqueue(context.Background(), "greet", greeting{Name: "chirpy"})
+	if err != nil {
+		t.Fatalf("Error enqueueing job: %v", err)
+	}
+
+	runUntil(t, q, func() bool {
+		status, _ := store.status(id)
+		return status == "succeeded"
+	})
+
+	mu.Lock()
+	defer mu.Unlock()
+	if got != "chirpy" {
+		t.Errorf("Handler got wrong payload: %q", got)
+	}
+}
+
+func TestJobRetriesThenDeadLetters(t *testing.T) {
+	store := newMemStore()
+	q := New(store)
+	q.PollInterval = time.Millisecond
+
+	Register(q, "flaky", func(ctx context.Context, g greeting) error {
+		return errors.New("boom")
+	})
+
+	id, _ := q.Enqueue(context.Background(), "flaky", greeting{}, MaxAttempts(3))
+
+	runUntil(t, q, func() bool {
+		status, _ := store.status(id)
+		return status == "dead"
+	})
+
+	_, attempts := store.status(id)
+	if attempts != 3 {
+		t.Errorf("Job should have been attempted 3 times, got %d", attempts)
+	}
+}
+
+func TestPermanentErrorSkipsRetries(t *testing.T) {
+	store := newMemStore()
+	q := New(store)
+	q.PollInterval = time.Millisecond
+
+	Register(q, "bad", func(ctx context.Context, g greeting) error {
+		return Permanent(errors.New("never going to work"))
+	})
+
+	id, _ := q.Enqueue(context.Background(), "bad", greeting{})
+
+	runUntil(t, q, func() bool {
+		status, _ := store.status(id)
+		return status == "dead"
+	})
+
+	_, attempts := store.status(id)
+	if attempts != 1 {
+		t.Errorf("Permanent failure should not be retried, got %d attempts", attempts)
+	}
+}
+
+func TestDrainWaitsForRun(t *testing.T) {
+	q := New(newMemStore())
+	q.PollInterval = time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go q.Run(ctx)
+
+	// Run is still claiming work, so Drain can't finish yet
+	drainCtx, drainCancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer drainCancel()
+	err := q.Drain(drainCtx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Drain should wait for Run to return, got %v", err)
+	}
+
+	cancel()
+	err = q.Drain(context.Background())
+	if err != nil {
+		t.Errorf("Drain after Run returned: %v", err)
+	}
+}
+
+func TestLapsedAttemptCannotRecordOutcome(t *testing.T) {
+	store := newMemStore()
+	q := New(store)
+	q.JobTimeout = -time.Minute // locks lapse as soon as they're taken
+
+	id, _ := q.Enqueue(context.Background(), "greet", greeting{}, MaxAttempts(2))
+
+	first, _ := q.claim(context.Background(), 1)
+	second, _ := q.claim(context.Background(), 1)
+	if len(first) != 1 || len(second) != 1 {
+		t.Fatalf("A lapsed job should be claimed again, got %d then %d", len(first), len(second))
+	}
+
+	// the first worker finishing late must not touch the second's attempt
+	updated, _ := store.CompleteJob(context.Background(), database.CompleteJobParams{ID: id, Attempts: first[0].Attempts})
+	if updated != 0 {
+		t.Errorf("A lapsed attempt should not complete the job")
+	}
+
+	// the second attempt was the last, so once it lapses the job is dead
+	// rather than run a third time
+	third, _ := q.claim(context.Background(), 1)
+	if len(third) != 0 {
+		t.Errorf("A job with no attempts left should not be claimed again")
+	}
+	if status, attempts := store.status(id); status != "dead" || attempts != 2 {
+		t.Errorf("Expected the job dead after 2 attempts, got %s after %d", status, attempts)
+	}
+}
+
+func TestDelayedJobWaits(t *testing.T) {
+	store := newMemStore()
+	q := New(store)
+
+	id, _ := q.Enqueue(context.Background(), "greet", greeting{}, Delay(time.Hour))
+
+	claimed, _ := q.claim(context.Background(), 10)
+	if len(claimed) != 0 {
+		t.Errorf("Delayed job %s should not be claimed yet", id)
+	}
+}
+
+func TestBackoffGrowsAndCaps(t *testing.T) {
+	if Backoff(1) < baseBackoff || Backoff(1) > baseBackoff*6/5 {
+		t.Errorf("First backoff out of range: %v", Backoff(1))
+	}
+
+	if Backoff(3) < 4*baseBackoff {
+		t.Errorf("Backoff should grow exponentially: %v", Backoff(3))
+	}
+
+	if Backoff(100) > maxBackoff*6/5 {
+		t.Errorf("Backoff should be capped: %v", Backoff(100))
+	}
+}
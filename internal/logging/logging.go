@@ -0,0 +1,134 @@
+package logging
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"regexp"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/nickemp1996/chirpy/internal/tracing"
+)
+
+const redacted = "[REDACTED]"
+
+// sensitiveKeys are attribute keys whose values never reach the output,
+// whatever they contain. Matching ignores case, dashes and underscores.
+var sensitiveKeys = []string{
+	"password",
+	"token",
+	"secret",
+	"apikey",
+	"authorization",
+	"cookie",
+	"signature",
+}
+
+var sensitiveValues = []*regexp.Regexp{
+	// JWTs
+	regexp.MustCompile(`eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`),
+	// credentials in authorization header form
+	regexp.MustCompile(`(?i)\b(bearer|apikey)\s+\S+`),
+	// refresh tokens and other hex encoded 256 bit secrets
+	regexp.MustCompile(`\b[0-9a-fA-F]{64}\b`),
+}
+
+// New returns a JSON logger that redacts credentials from every record.
+func New(w io.Writer, level slog.Level) *slog.Logger {
+	opts := &slog.HandlerOptions{
+		Level:       level,
+		ReplaceAttr: redact,
+	}
+
+	return slog.New(slog.NewJSONHandler(w, opts))
+}
+
+func isSensitiveKey(key string) bool {
+	normalized := strings.ToLower(strings.NewReplacer("_", "", "-", "").Replace(key))
+	for _, k := range sensitiveKeys {
+		if strings.Contains(normalized, k) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// RedactString masks anything in s that looks like a credential.
+func RedactString(s string) string {
+	for _, re := range sensitiveValues {
+		s = re.ReplaceAllString(s, redacted)
+	}
+
+	return s
+}
+
+func redact(groups []string, a slog.Attr) slog.Attr {
+	if a.Value.Kind() == slog.KindGroup {
+		return a
+	}
+
+	if isSensitiveKey(a.Key) {
+		return slog.String(a.Key, redacted)
+	}
+
+	switch a.Value.Kind() {
+	case slog.KindString:
+		return slog.String(a.Key, RedactString(a.Value.String()))
+	case slog.KindAny:
+		// errors and other values are flattened so their text can be checked
+		if err, ok := a.Value.Any().(error); ok {
+			return slog.String(a.Key, RedactString(err.Error()))
+		}
+	}
+
+	return a
+}
+
+type ctxKey struct{}
+
+// requestInfo is shared between the access log middleware and the handlers
+// beneath it, which fill in the user once they have authenticated.
+type requestInfo struct {
+	requestID string
+	userID    string
+}
+
+func withRequestInfo(ctx context.Context, info *requestInfo) context.Context {
+	return context.WithValue(ctx, ctxKey{}, info)
+}
+
+func infoFrom(ctx context.Context) *requestInfo {
+	info, _ := ctx.Value(ctxKey{}).(*requestInfo)
+	return info
+}
+
+func RequestID(ctx context.Context) string {
+	info := infoFrom(ctx)
+	if info == nil {
+		return ""
+	}
+	return info.requestID
+}
+
+// SetUserID records the authenticated user for the access log line.
+func SetUserID(ctx context.Context, userID uuid.UUID) {
+	info := infoFrom(ctx)
+	if info != nil {
+		info.userID = userID.String()
+	}
+}
+
+// FromContext returns the default logger tagged with the request ID, if any.
+func FromContext(ctx context.Context) *slog.Logger {
+	logger := slog.Default()
+	if id := RequestID(ctx); id != "" {
+		logger = logger.With("request_id", id)
+	}
+	if sc := tracing.SpanFromContext(ctx).SpanContext(); sc.IsValid() {
+		logger = logger.With("trace_id", sc.TraceID.String())
+	}
+
+	return logger
+}
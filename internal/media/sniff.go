@@ -0,0 +1,28 @@
+package media
+
+import (
+	"errors"
+	"net/http"
+)
+
+var ErrUnsupportedType = errors.New("unsupported media type")
+
+// extensions maps every content type we accept to the extension it is stored under.
+var extensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+}
+
+// Sniff detects the content type from the file's leading bytes rather than
+// trusting the client supplied header, and returns the extension to store it under.
+func Sniff(data []byte) (contentType, ext string, err error) {
+	contentType = http.DetectContentType(data)
+	ext, ok := extensions[contentType]
+	if !ok {
+		return "", "", ErrUnsupportedType
+	}
+
+	return contentType, ext, nil
+}
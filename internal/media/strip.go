@@ -0,0 +1,261 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+)
+
+var ErrMalformed = errors.New("malformed image")
+
+// StripMetadata removes EXIF, XMP and text metadata from an image so uploads
+// don't leak GPS coordinates, device serials and the like. Pixel data is copied
+// untouched; formats without a stripper are returned as-is.
+func StripMetadata(contentType string, data []byte) ([]byte, error) {
+	switch contentType {
+	case "image/jpeg":
+		return stripJPEG(data)
+	case "image/png":
+		return stripPNG(data)
+	case "image/webp":
+		return stripWebP(data)
+	case "image/gif":
+		return stripGIF(data)
+	default:
+		return data, nil
+	}
+}
+
+func stripJPEG(data []byte) ([]byte, error) {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return nil, ErrMalformed
+	}
+
+	out := bytes.NewBuffer(make([]byte, 0, len(data)))
+	out.Write(data[:2])
+
+	i := 2
+	for i < len(data) {
+		if data[i] != 0xFF || i+1 >= len(data) {
+			return nil, ErrMalformed
+		}
+		marker := data[i+1]
+
+		// fill bytes
+		if marker == 0xFF {
+			i++
+			continue
+		}
+
+		// markers without a length
+		if marker == 0x01 || (marker >= 0xD0 && marker <= 0xD9) {
+			out.Write(data[i : i+2])
+			i += 2
+			continue
+		}
+
+		if i+4 > len(data) {
+			return nil, ErrMalformed
+		}
+		end := i + 2 + int(binary.BigEndian.Uint16(data[i+2:i+4]))
+		if end > len(data) {
+			return nil, ErrMalformed
+		}
+
+		// start of scan: everything from here on is entropy coded image data
+		if marker == 0xDA {
+			out.Write(data[i:])
+			return out.Bytes(), nil
+		}
+
+		// APP1 (EXIF/XMP), APP13 (IPTC) and comments are dropped, everything
+		// else (JFIF, ICC profiles, tables) is kept
+		if marker != 0xE1 && marker != 0xED && marker != 0xFE {
+			out.Write(data[i:end])
+		}
+		i = end
+	}
+
+	return out.Bytes(), nil
+}
+
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+func stripPNG(data []byte) ([]byte, error) {
+	if !bytes.HasPrefix(data, pngSignature) {
+		return nil, ErrMalformed
+	}
+
+	out := bytes.NewBuffer(make([]byte, 0, len(data)))
+	out.Write(pngSignature)
+
+	i := len(pngSignature)
+	for i < len(data) {
+		if i+8 > len(data) {
+			return nil, ErrMalformed
+		}
+		length := int(binary.BigEndian.Uint32(data[i : i+4]))
+		chunkType := string(data[i+4 : i+8])
+		// length, type, data, crc
+		end := i + 12 + length
+		if length < 0 || end > len(data) {
+			return nil, ErrMalformed
+		}
+
+		switch chunkType {
+		case "eXIf", "tEXt", "zTXt", "iTXt", "tIME":
+		default:
+			out.Write(data[i:end])
+		}
+
+		i = end
+		if chunkType == "IEND" {
+			break
+		}
+	}
+
+	return out.Bytes(), nil
+}
+
+const (
+	webpFlagXMP  = 0x04
+	webpFlagEXIF = 0x08
+)
+
+func stripWebP(data []byte) ([]byte, error) {
+	if len(data) < 12 || string(data[:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		return nil, ErrMalformed
+	}
+
+	out := bytes.NewBuffer(make([]byte, 0, len(data)))
+	out.Write(data[:12])
+
+	i := 12
+	for i < len(data) {
+		if i+8 > len(data) {
+			return nil, ErrMalformed
+		}
+		fourCC := string(data[i : i+4])
+		size := int(binary.LittleEndian.Uint32(data[i+4 : i+8]))
+		// chunks are padded to an even length
+		end := i + 8 + size + size%2
+		if size < 0 || end > len(data) {
+			return nil, ErrMalformed
+		}
+
+		switch fourCC {
+		case "EXIF", "XMP ":
+		case "VP8X":
+			chunk := bytes.Clone(data[i:end])
+			if len(chunk) > 8 {
+				chunk[8] &^= webpFlagEXIF | webpFlagXMP
+			}
+			out.Write(chunk)
+		default:
+			out.Write(data[i:end])
+		}
+
+		i = end
+	}
+
+	stripped := out.Bytes()
+	binary.LittleEndian.PutUint32(stripped[4:8], uint32(len(stripped)-8))
+
+	return stripped, nil
+}
+
+// subBlocksEnd returns the index just past a GIF data sub-block chain,
+// which ends with an empty block.
+func subBlocksEnd(data []byte, i int) (int, error) {
+	for {
+		if i >= len(data) {
+			return 0, ErrMalformed
+		}
+		size := int(data[i])
+		i++
+		if size == 0 {
+			return i, nil
+		}
+		i += size
+	}
+}
+
+// gifKeptApplications are the application extensions that control playback
+// rather than describe the file: loop counts for animations.
+var gifKeptApplications = map[string]bool{
+	"NETSCAPE2.0": true,
+	"ANIMEXTS1.0": true,
+}
+
+func stripGIF(data []byte) ([]byte, error) {
+	if len(data) < 13 || (string(data[:6]) != "GIF87a" && string(data[:6]) != "GIF89a") {
+		return nil, ErrMalformed
+	}
+
+	// header, logical screen descriptor and the global color table if any
+	i := 13
+	if flags := data[10]; flags&0x80 != 0 {
+		i += 3 << (flags&0x07 + 1)
+	}
+	if i > len(data) {
+		return nil, ErrMalformed
+	}
+
+	out := bytes.NewBuffer(make([]byte, 0, len(data)))
+	out.Write(data[:i])
+
+	for {
+		if i >= len(data) {
+			return nil, ErrMalformed
+		}
+
+		switch data[i] {
+		case 0x3B:
+			// trailer, anything after it is dropped
+			out.WriteByte(0x3B)
+			return out.Bytes(), nil
+		case 0x21:
+			if i+2 > len(data) {
+				return nil, ErrMalformed
+			}
+			label := data[i+1]
+			end, err := subBlocksEnd(data, i+2)
+			if err != nil {
+				return nil, err
+			}
+
+			keep := true
+			switch label {
+			case 0xFE:
+				// comment
+				keep = false
+			case 0xFF:
+				// application extension, e.g. XMP; the identifier is the
+				// first sub-block
+				keep = i+3+11 <= len(data) && data[i+2] == 11 && gifKeptApplications[string(data[i+3:i+3+11])]
+			}
+			if keep {
+				out.Write(data[i:end])
+			}
+			i = end
+		case 0x2C:
+			// image descriptor, local color table, LZW code size, image data
+			end := i + 10
+			if end > len(data) {
+				return nil, ErrMalformed
+			}
+			if flags := data[i+9]; flags&0x80 != 0 {
+				end += 3 << (flags&0x07 + 1)
+			}
+			end++
+			end, err := subBlocksEnd(data, end)
+			if err != nil {
+				return nil, err
+			}
+			out.Write(data[i:end])
+			i = end
+		default:
+			return nil, ErrMalformed
+		}
+	}
+}
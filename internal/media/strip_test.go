@@ -0,0 +1,146 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color/palette"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+func testImage() image.Image {
+	return image.NewRGBA(image.Rect(0, 0, 8, 8))
+}
+
+func TestStripJPEG(t *testing.T) {
+	var buf bytes.Buffer
+	err := jpeg.Encode(&buf, testImage(), nil)
+	if err != nil {
+		t.Fatalf("Error encoding JPEG: %v", err)
+	}
+
+	payload := []byte("Exif\x00\x00GPS-SECRET")
+	segment := []byte{0xFF, 0xE1, 0, 0}
+	binary.BigEndian.PutUint16(segment[2:], uint16(len(payload)+2))
+	segment = append(segment, payload...)
+
+	data := append([]byte{}, buf.Bytes()[:2]...)
+	data = append(data, segment...)
+	data = append(data, buf.Bytes()[2:]...)
+
+	stripped, err := StripMetadata("image/jpeg", data)
+	if err != nil {
+		t.Fatalf("Error stripping JPEG: %v", err)
+	}
+
+	if bytes.Contains(stripped, []byte("GPS-SECRET")) {
+		t.Errorf("EXIF segment was not removed")
+	}
+
+	_, err = jpeg.Decode(bytes.NewReader(stripped))
+	if err != nil {
+		t.Errorf("Stripped JPEG does not decode: %v", err)
+	}
+}
+
+func TestStripPNG(t *testing.T) {
+	var buf bytes.Buffer
+	err := png.Encode(&buf, testImage())
+	if err != nil {
+		t.Fatalf("Error encoding PNG: %v", err)
+	}
+
+	text := []byte("Comment\x00GPS-SECRET")
+	chunk := make([]byte, 8, 12+len(text))
+	binary.BigEndian.PutUint32(chunk[:4], uint32(len(text)))
+	copy(chunk[4:8], "tEXt")
+	chunk = append(chunk, text...)
+	chunk = binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(chunk[4:]))
+
+	// insert the text chunk right after IHDR
+	encoded := buf.Bytes()
+	ihdrEnd := 8 + 12 + 13
+	data := append([]byte{}, encoded[:ihdrEnd]...)
+	data = append(data, chunk...)
+	data = append(data, encoded[ihdrEnd:]...)
+
+	stripped, err := StripMetadata("image/png", data)
+	if err != nil {
+		t.Fatalf("Error stripping PNG: %v", err)
+	}
+
+	if bytes.Contains(stripped, []byte("GPS-SECRET")) {
+		t.Errorf("tEXt chunk was not removed")
+	}
+
+	_, err = png.Decode(bytes.NewReader(stripped))
+	if err != nil {
+		t.Errorf("Stripped PNG does not decode: %v", err)
+	}
+}
+
+func TestStripGIF(t *testing.T) {
+	frame := image.NewPaletted(image.Rect(0, 0, 8, 8), palette.Plan9)
+	var buf bytes.Buffer
+	err := gif.EncodeAll(&buf, &gif.GIF{Image: []*image.Paletted{frame, frame}, Delay: []int{10, 10}, LoopCount: 3})
+	if err != nil {
+		t.Fatalf("Error encoding GIF: %v", err)
+	}
+
+	comment := append([]byte{0x21, 0xFE, 10}, "GPS-SECRET"...)
+	comment = append(comment, 0)
+	xmp := append([]byte{0x21, 0xFF, 11}, "XMP DataXMP"...)
+	xmp = append(xmp, 11)
+	xmp = append(xmp, "XMP-SECRET!"...)
+	xmp = append(xmp, 0)
+
+	// insert the extensions just before the trailer
+	encoded := buf.Bytes()
+	data := append([]byte{}, encoded[:len(encoded)-1]...)
+	data = append(data, comment...)
+	data = append(data, xmp...)
+	data = append(data, 0x3B)
+
+	stripped, err := StripMetadata("image/gif", data)
+	if err != nil {
+		t.Fatalf("Error stripping GIF: %v", err)
+	}
+
+	if bytes.Contains(stripped, []byte("GPS-SECRET")) || bytes.Contains(stripped, []byte("XMP-SECRET")) {
+		t.Errorf("Comment or XMP extension was not removed")
+	}
+
+	decoded, err := gif.DecodeAll(bytes.NewReader(stripped))
+	if err != nil {
+		t.Fatalf("Stripped GIF does not decode: %v", err)
+	}
+	if len(decoded.Image) != 2 || decoded.LoopCount != 3 {
+		t.Errorf("Animation was not kept: %d frames, loop count %d", len(decoded.Image), decoded.LoopCount)
+	}
+}
+
+func TestStripRejectsMalformed(t *testing.T) {
+	_, err := StripMetadata("image/jpeg", []byte("not a jpeg"))
+	if err != ErrMalformed {
+		t.Errorf("Malformed JPEG should be rejected, got %v", err)
+	}
+}
+
+func TestSniff(t *testing.T) {
+	var buf bytes.Buffer
+	png.Encode(&buf, testImage())
+
+	contentType, ext, err := Sniff(buf.Bytes())
+	if err != nil || contentType != "image/png" || ext != ".png" {
+		t.Errorf("PNG sniffed as %q %q %v", contentType, ext, err)
+	}
+
+	_, _, err = Sniff([]byte("<html><script>alert(1)</script></html>"))
+	if err != ErrUnsupportedType {
+		t.Errorf("HTML should be rejected, got %v", err)
+	}
+}
@@ -0,0 +1,121 @@
+package media
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/jpeg"
+
+	// decoders for the upload formats we accept
+	_ "image/gif"
+	_ "image/png"
+
+	"github.com/HugoSmits86/nativewebp"
+	"golang.org/x/image/draw"
+)
+
+// VariantWidths are the fixed widths resized copies are generated at.
+var VariantWidths = []int{160, 320, 640, 1280}
+
+// MaxPixels bounds the decoded size of a source image so a tiny, highly
+// compressed upload can't exhaust memory when it is decoded.
+const MaxPixels = 40_000_000
+
+const jpegQuality = 82
+
+var ErrTooLarge = errors.New("image dimensions too large")
+
+// Format describes one output encoding of a variant.
+type Format struct {
+	Name        string
+	ContentType string
+	Ext         string
+	encode      func(buf *bytes.Buffer, img image.Image) error
+}
+
+var (
+	FormatJPEG = Format{
+		Name:        "jpeg",
+		ContentType: "image/jpeg",
+		Ext:         ".jpg",
+		encode: func(buf *bytes.Buffer, img image.Image) error {
+			return jpeg.Encode(buf, img, &jpeg.Options{Quality: jpegQuality})
+		},
+	}
+	FormatWebP = Format{
+		Name:        "webp",
+		ContentType: "image/webp",
+		Ext:         ".webp",
+		encode: func(buf *bytes.Buffer, img image.Image) error {
+			return nativewebp.Encode(buf, img, nil)
+		},
+	}
+)
+
+var VariantFormats = []Format{FormatJPEG, FormatWebP}
+
+type Variant struct {
+	Width  int
+	Height int
+	Format Format
+	Data   []byte
+}
+
+// GenerateVariants decodes an image and produces a resized copy for every
+// width in widths that is narrower than the source, in every format. Images
+// are never upscaled.
+func GenerateVariants(data []byte, widths []int, formats []Format) ([]Variant, error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	if config.Width*config.Height > MaxPixels {
+		return nil, ErrTooLarge
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	bounds := src.Bounds()
+	variants := []Variant{}
+	for _, width := range widths {
+		if width >= bounds.Dx() {
+			continue
+		}
+
+		img := Resize(src, width)
+		for _, format := range formats {
+			var buf bytes.Buffer
+			err = format.encode(&buf, img)
+			if err != nil {
+				return nil, err
+			}
+
+			variants = append(variants, Variant{
+				Width:  width,
+				Height: img.Bounds().Dy(),
+				Format: format,
+				Data:   buf.Bytes(),
+			})
+		}
+	}
+
+	return variants, nil
+}
+
+// Resize scales img to the given width, keeping its aspect ratio.
+func Resize(img image.Image, width int) image.Image {
+	bounds := img.Bounds()
+	height := bounds.Dy() * width / bounds.Dx()
+	if height < 1 {
+		height = 1
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, bounds, draw.Src, nil)
+
+	return dst
+}
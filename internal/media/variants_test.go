@@ -0,0 +1,42 @@
+package media
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"testing"
+)
+
+func TestGenerateVariants(t *testing.T) {
+	var buf bytes.Buffer
+	err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 400, 200)))
+	if err != nil {
+		t.Fatalf("Error encoding PNG: %v", err)
+	}
+
+	variants, err := GenerateVariants(buf.Bytes(), []int{100, 200, 800}, VariantFormats)
+	if err != nil {
+		t.Fatalf("Error generating variants: %v", err)
+	}
+
+	// 800 is wider than the source and must be skipped
+	if len(variants) != 4 {
+		t.Fatalf("Expected 4 variants, got %d", len(variants))
+	}
+
+	for _, v := range variants {
+		img, format, err := image.Decode(bytes.NewReader(v.Data))
+		if err != nil {
+			t.Errorf("Variant %d %s does not decode: %v", v.Width, v.Format.Name, err)
+			continue
+		}
+
+		if format != v.Format.Name {
+			t.Errorf("Variant encoded as %s, expected %s", format, v.Format.Name)
+		}
+
+		if img.Bounds().Dx() != v.Width || img.Bounds().Dy() != v.Width/2 {
+			t.Errorf("Variant has wrong size %v for width %d", img.Bounds(), v.Width)
+		}
+	}
+}
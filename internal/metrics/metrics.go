@@ -0,0 +1,361 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// DefBuckets are latency buckets in seconds suited to an HTTP API.
+var DefBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// collector is anything that can write itself in the Prometheus text format.
+type collector interface {
+	write(w *bufio.Writer)
+}
+
+// Registry holds every metric and renders them in the Prometheus text
+// exposition format (version 0.0.4).
+type Registry struct {
+	mu         sync.Mutex
+	collectors []collector
+	names      map[string]bool
+}
+
+func NewRegistry() *Registry {
+	return &Registry{names: map[string]bool{}}
+}
+
+func (r *Registry) register(name string, c collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.names[name] {
+		panic("metrics: duplicate metric " + name)
+	}
+	r.names[name] = true
+	r.collectors = append(r.collectors, c)
+}
+
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mu.Lock()
+	collectors := slices.Clone(r.collectors)
+	r.mu.Unlock()
+
+	cw := &countingWriter{w: w}
+	bw := bufio.NewWriter(cw)
+	for _, c := range collectors {
+		c.write(bw)
+	}
+	err := bw.Flush()
+
+	return cw.n, err
+}
+
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	r.WriteTo(w)
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func writeHeader(w *bufio.Writer, name, help, kind string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, escapeHelp(help), name, kind)
+}
+
+func escapeHelp(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(s)
+}
+
+func escapeLabel(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`).Replace(s)
+}
+
+func formatLabels(names, values []string, extra ...string) string {
+	if len(names) == 0 && len(extra) == 0 {
+		return ""
+	}
+
+	parts := make([]string, 0, len(names)+len(extra)/2)
+	for i, name := range names {
+		parts = append(parts, fmt.Sprintf(`%s="%s"`, name, escapeLabel(values[i])))
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		parts = append(parts, fmt.Sprintf(`%s="%s"`, extra[i], escapeLabel(extra[i+1])))
+	}
+
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	case math.IsNaN(f):
+		return "NaN"
+	default:
+		return strconv.FormatFloat(f, 'g', -1, 64)
+	}
+}
+
+// atomicFloat is a float64 that can be added to from many goroutines.
+type atomicFloat struct {
+	bits atomic.Uint64
+}
+
+func (f *atomicFloat) Add(v float64) {
+	for {
+		old := f.bits.Load()
+		next := math.Float64bits(math.Float64frombits(old) + v)
+		if f.bits.CompareAndSwap(old, next) {
+			return
+		}
+	}
+}
+
+func (f *atomicFloat) Load() float64 {
+	return math.Float64frombits(f.bits.Load())
+}
+
+// Counter only goes up.
+type Counter struct {
+	name string
+	help string
+	v    atomic.Uint64
+}
+
+func (r *Registry) NewCounter(name, help string) *Counter {
+	c := &Counter{name: name, help: help}
+	r.register(name, c)
+	return c
+}
+
+func (c *Counter) Inc()          { c.v.Add(1) }
+func (c *Counter) Add(n uint64)  { c.v.Add(n) }
+func (c *Counter) Value() uint64 { return c.v.Load() }
+
+// Reset zeroes the counter. Scrapers treat it like a process restart.
+func (c *Counter) Reset() { c.v.Store(0) }
+
+func (c *Counter) write(w *bufio.Writer) {
+	writeHeader(w, c.name, c.help, "counter")
+	fmt.Fprintf(w, "%s %d\n", c.name, c.v.Load())
+}
+
+// vec keeps one child per distinct combination of label values.
+type vec[T any] struct {
+	labels   []string
+	mu       sync.RWMutex
+	children map[string]*T
+	values   map[string][]string
+	newChild func() *T
+}
+
+func newVec[T any](labels []string, newChild func() *T) vec[T] {
+	return vec[T]{
+		labels:   labels,
+		children: map[string]*T{},
+		values:   map[string][]string{},
+		newChild: newChild,
+	}
+}
+
+func (v *vec[T]) with(values ...string) *T {
+	if len(values) != len(v.labels) {
+		panic(fmt.Sprintf("metrics: expected %d label values, got %d", len(v.labels), len(values)))
+	}
+	key := strings.Join(values, "\xff")
+
+	v.mu.RLock()
+	child, ok := v.children[key]
+	v.mu.RUnlock()
+	if ok {
+		return child
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	child, ok = v.children[key]
+	if !ok {
+		child = v.newChild()
+		v.children[key] = child
+		v.values[key] = slices.Clone(values)
+	}
+
+	return child
+}
+
+// each visits children in a stable order so output doesn't churn between scrapes.
+func (v *vec[T]) each(fn func(values []string, child *T)) {
+	v.mu.RLock()
+	keys := make([]string, 0, len(v.children))
+	for key := range v.children {
+		keys = append(keys, key)
+	}
+	v.mu.RUnlock()
+	slices.Sort(keys)
+
+	for _, key := range keys {
+		v.mu.RLock()
+		child, values := v.children[key], v.values[key]
+		v.mu.RUnlock()
+		fn(values, child)
+	}
+}
+
+type CounterVec struct {
+	name string
+	help string
+	vec[atomic.Uint64]
+}
+
+func (r *Registry) NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{
+		name: name,
+		help: help,
+		vec:  newVec(labels, func() *atomic.Uint64 { return &atomic.Uint64{} }),
+	}
+	r.register(name, c)
+	return c
+}
+
+func (c *CounterVec) Inc(values ...string) {
+	c.with(values...).Add(1)
+}
+
+func (c *CounterVec) write(w *bufio.Writer) {
+	writeHeader(w, c.name, c.help, "counter")
+	c.each(func(values []string, v *atomic.Uint64) {
+		fmt.Fprintf(w, "%s%s %d\n", c.name, formatLabels(c.labels, values), v.Load())
+	})
+}
+
+// Gauge can go up and down.
+type Gauge struct {
+	name string
+	help string
+	v    atomic.Int64
+}
+
+func (r *Registry) NewGauge(name, help string) *Gauge {
+	g := &Gauge{name: name, help: help}
+	r.register(name, g)
+	return g
+}
+
+func (g *Gauge) Inc()         { g.v.Add(1) }
+func (g *Gauge) Dec()         { g.v.Add(-1) }
+func (g *Gauge) Set(v int64)  { g.v.Store(v) }
+func (g *Gauge) Value() int64 { return g.v.Load() }
+
+func (g *Gauge) write(w *bufio.Writer) {
+	writeHeader(w, g.name, g.help, "gauge")
+	fmt.Fprintf(w, "%s %d\n", g.name, g.v.Load())
+}
+
+// funcMetric reads its value when scraped, for numbers owned by someone else
+// such as sql.DB pool statistics.
+type funcMetric struct {
+	name string
+	help string
+	kind string
+	fn   func() float64
+}
+
+func (r *Registry) NewGaugeFunc(name, help string, fn func() float64) {
+	r.register(name, &funcMetric{name: name, help: help, kind: "gauge", fn: fn})
+}
+
+func (r *Registry) NewCounterFunc(name, help string, fn func() float64) {
+	r.register(name, &funcMetric{name: name, help: help, kind: "counter", fn: fn})
+}
+
+func (f *funcMetric) write(w *bufio.Writer) {
+	writeHeader(w, f.name, f.help, f.kind)
+	fmt.Fprintf(w, "%s %s\n", f.name, formatFloat(f.fn()))
+}
+
+type histogram struct {
+	buckets []float64
+	counts  []atomic.Uint64
+	count   atomic.Uint64
+	sum     atomicFloat
+}
+
+func (h *histogram) observe(v float64) {
+	for i, upper := range h.buckets {
+		if v <= upper {
+			h.counts[i].Add(1)
+		}
+	}
+	h.count.Add(1)
+	h.sum.Add(v)
+}
+
+type HistogramVec struct {
+	name string
+	help string
+	vec[histogram]
+}
+
+func (r *Registry) NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	buckets = slices.Clone(buckets)
+	slices.Sort(buckets)
+	h := &HistogramVec{
+		name: name,
+		help: help,
+		vec: newVec(labels, func() *histogram {
+			return &histogram{buckets: buckets, counts: make([]atomic.Uint64, len(buckets))}
+		}),
+	}
+	r.register(name, h)
+	return h
+}
+
+func (h *HistogramVec) Observe(v float64, values ...string) {
+	h.with(values...).observe(v)
+}
+
+func (h *HistogramVec) write(w *bufio.Writer) {
+	writeHeader(w, h.name, h.help, "histogram")
+	h.each(func(values []string, hist *histogram) {
+		// bucket counts are already cumulative, observe adds to every bucket >= v
+		for i, upper := range hist.buckets {
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, formatLabels(h.labels, values, "le", formatFloat(upper)), hist.counts[i].Load())
+		}
+		count := hist.count.Load()
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, formatLabels(h.labels, values, "le", "+Inf"), count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, formatLabels(h.labels, values), formatFloat(hist.sum.Load()))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, formatLabels(h.labels, values), count)
+	})
+}
+
+// Method returns the request method as a label value. Clients can send any
+// token as a method, so everything outside the standard set is "other" and
+// can't create unbounded series.
+func Method(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace:
+		return method
+	default:
+		return "other"
+	}
+}
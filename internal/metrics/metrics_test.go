@@ -0,0 +1,100 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+)
+
+func render(t *testing.T, r *Registry) string {
+	t.Helper()
+	var sb strings.Builder
+	_, err := r.WriteTo(&sb)
+	if err != nil {
+		t.Fatalf("Error writing metrics: %v", err)
+	}
+	return sb.String()
+}
+
+func TestCounterAndGauge(t *testing.T) {
+	r := NewRegistry()
+	c := r.NewCounter("chirpy_signups_total", "Users signed up.")
+	g := r.NewGauge("chirpy_in_flight", "Requests in flight.")
+
+	c.Inc()
+	c.Add(2)
+	g.Inc()
+	g.Inc()
+	g.Dec()
+
+	out := render(t, r)
+	for _, want := range []string{
+		"# TYPE chirpy_signups_total counter\n",
+		"chirpy_signups_total 3\n",
+		"# TYPE chirpy_in_flight gauge\n",
+		"chirpy_in_flight 1\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Output missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestCounterVecEscapesLabels(t *testing.T) {
+	r := NewRegistry()
+	cv := r.NewCounterVec("chirpy_requests_total", "Requests.", "route", "status")
+
+	cv.Inc("/api/\"chirps\"", "200")
+	cv.Inc("/api/\"chirps\"", "200")
+
+	out := render(t, r)
+	want := `chirpy_requests_total{route="/api/\"chirps\"",status="200"} 2`
+	if !strings.Contains(out, want) {
+		t.Errorf("Output missing %q:\n%s", want, out)
+	}
+}
+
+func TestHistogramBucketsAreCumulative(t *testing.T) {
+	r := NewRegistry()
+	h := r.NewHistogramVec("chirpy_latency_seconds", "Latency.", []float64{0.1, 1}, "route")
+
+	h.Observe(0.05, "/a")
+	h.Observe(0.5, "/a")
+	h.Observe(5, "/a")
+
+	out := render(t, r)
+	for _, want := range []string{
+		`chirpy_latency_seconds_bucket{route="/a",le="0.1"} 1`,
+		`chirpy_latency_seconds_bucket{route="/a",le="1"} 2`,
+		`chirpy_latency_seconds_bucket{route="/a",le="+Inf"} 3`,
+		`chirpy_latency_seconds_sum{route="/a"} 5.55`,
+		`chirpy_latency_seconds_count{route="/a"} 3`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Output missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestGaugeFunc(t *testing.T) {
+	r := NewRegistry()
+	r.NewGaugeFunc("chirpy_db_open_connections", "Open connections.", func() float64 { return 7 })
+
+	out := render(t, r)
+	if !strings.Contains(out, "chirpy_db_open_connections 7\n") {
+		t.Errorf("Gauge func not rendered:\n%s", out)
+	}
+}
+
+func TestMethodIsBounded(t *testing.T) {
+	for method, want := range map[string]string{
+		"GET":    "GET",
+		"DELETE": "DELETE",
+		"FOO":    "other",
+		"get":    "other",
+		"":       "other",
+	} {
+		if got := Method(method); got != want {
+			t.Errorf("Method(%q) = %q, want %q", method, got, want)
+		}
+	}
+}
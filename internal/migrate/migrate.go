@@ -0,0 +1,382 @@
+// Package migrate applies goose-style SQL migrations. It reads the same
+// files as the goose CLI and keeps its bookkeeping in goose_db_version, so
+// databases migrated by hand and by the server stay interchangeable.
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// advisoryLockKey is an arbitrary constant every replica locks on, so only
+// one of them migrates at a time.
+const advisoryLockKey = 727_118_036
+
+var (
+	ErrNoMigrations = errors.New("no migrations found")
+	ErrNoNextDown   = errors.New("no migration to roll back")
+	// ErrSchemaAhead means the database has migrations this build doesn't
+	// know about, usually because a newer release already migrated it.
+	ErrSchemaAhead = errors.New("database schema is newer than this build")
+)
+
+var fileNameRe = regexp.MustCompile(`^(\d+)_(.+)\.sql$`)
+
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Status is one migration as seen by the database.
+type Status struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time
+}
+
+// Parse reads every NNN_name.sql file at the top of fsys.
+func Parse(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	var migrations []Migration
+	seen := map[int64]string{}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		m := fileNameRe.FindStringSubmatch(entry.Name())
+		if m == nil {
+			continue
+		}
+
+		version, err := strconv.ParseInt(m[1], 10, 64)
+		if err != nil || version < 1 {
+			return nil, fmt.Errorf("%s: invalid version", entry.Name())
+		}
+		if other, ok := seen[version]; ok {
+			return nil, fmt.Errorf("%s: version %d already used by %s", entry.Name(), version, other)
+		}
+		seen[version] = entry.Name()
+
+		data, err := fs.ReadFile(fsys, path.Join(".", entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		up, down, err := splitSections(string(data))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", entry.Name(), err)
+		}
+
+		migrations = append(migrations, Migration{Version: version, Name: m[2], Up: up, Down: down})
+	}
+
+	if len(migrations) == 0 {
+		return nil, ErrNoMigrations
+	}
+
+	slices.SortFunc(migrations, func(a, b Migration) int {
+		return int(a.Version - b.Version)
+	})
+
+	return migrations, nil
+}
+
+// splitSections pulls the Up and Down SQL out of a goose file. Each section
+// runs as a single multi-statement exec, so StatementBegin/End markers are
+// accepted but not needed.
+func splitSections(src string) (up, down string, err error) {
+	var current *strings.Builder
+	var upB, downB strings.Builder
+	foundUp := false
+
+	for _, line := range strings.Split(src, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if annotation, ok := strings.CutPrefix(trimmed, "-- +goose "); ok {
+			switch strings.TrimSpace(annotation) {
+			case "Up":
+				current, foundUp = &upB, true
+			case "Down":
+				current = &downB
+			case "StatementBegin", "StatementEnd":
+			default:
+				return "", "", fmt.Errorf("unsupported goose annotation %q", trimmed)
+			}
+			continue
+		}
+
+		if current != nil {
+			current.WriteString(line)
+			current.WriteString("\n")
+		}
+	}
+
+	if !foundUp {
+		return "", "", errors.New("missing -- +goose Up section")
+	}
+
+	return strings.TrimSpace(upB.String()), strings.TrimSpace(downB.String()), nil
+}
+
+type Migrator struct {
+	db         *sql.DB
+	migrations []Migration
+}
+
+func New(db *sql.DB, fsys fs.FS) (*Migrator, error) {
+	migrations, err := Parse(fsys)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{db: db, migrations: migrations}, nil
+}
+
+// Latest is the newest version this build knows about.
+func (m *Migrator) Latest() int64 {
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+type querier interface {
+	ExecContext(context.Context, string, ...any) (sql.Result, error)
+	QueryContext(context.Context, string, ...any) (*sql.Rows, error)
+}
+
+func ensureVersionTable(ctx context.Context, q querier) error {
+	_, err := q.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS goose_db_version (
+			id serial PRIMARY KEY,
+			version_id bigint NOT NULL,
+			is_applied boolean NOT NULL,
+			tstamp timestamp NULL DEFAULT now()
+		)`)
+	if err != nil {
+		return fmt.Errorf("creating goose_db_version: %w", err)
+	}
+
+	// goose seeds the table with version 0 and expects it to be there
+	_, err = q.ExecContext(ctx, `
+		INSERT INTO goose_db_version (version_id, is_applied)
+		SELECT 0, true
+		WHERE NOT EXISTS (SELECT 1 FROM goose_db_version)`)
+	return err
+}
+
+// applied maps each applied version to when it was applied. Like goose, the
+// newest row for a version decides whether it is applied.
+func applied(ctx context.Context, q querier) (map[int64]time.Time, error) {
+	out := map[int64]time.Time{}
+
+	// a database nobody has migrated yet has no version table at all
+	var exists bool
+	rows, err := q.QueryContext(ctx, "SELECT to_regclass('goose_db_version') IS NOT NULL")
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		err = rows.Scan(&exists)
+	}
+	rows.Close()
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return out, nil
+	}
+
+	rows, err = q.QueryContext(ctx, `
+		SELECT version_id, is_applied, COALESCE(tstamp, now())
+		FROM goose_db_version
+		ORDER BY id DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	seen := map[int64]bool{}
+	for rows.Next() {
+		var version int64
+		var isApplied bool
+		var at time.Time
+		err := rows.Scan(&version, &isApplied, &at)
+		if err != nil {
+			return nil, err
+		}
+		if seen[version] || version == 0 {
+			continue
+		}
+		seen[version] = true
+		if isApplied {
+			out[version] = at
+		}
+	}
+
+	return out, rows.Err()
+}
+
+func currentVersion(versions map[int64]time.Time) int64 {
+	var current int64
+	for v := range versions {
+		current = max(current, v)
+	}
+	return current
+}
+
+// Current returns the newest applied version, 0 for an empty database.
+func (m *Migrator) Current(ctx context.Context) (int64, error) {
+	versions, err := applied(ctx, m.db)
+	if err != nil {
+		return 0, err
+	}
+	return currentVersion(versions), nil
+}
+
+// Check returns ErrSchemaAhead if the database was migrated past this build.
+func (m *Migrator) Check(ctx context.Context) error {
+	current, err := m.Current(ctx)
+	if err != nil {
+		return err
+	}
+	if current > m.Latest() {
+		return fmt.Errorf("%w: database is at version %d, this build knows up to %d", ErrSchemaAhead, current, m.Latest())
+	}
+	return nil
+}
+
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	versions, err := applied(ctx, m.db)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]Status, 0, len(m.migrations))
+	for _, mig := range m.migrations {
+		at, ok := versions[mig.Version]
+		out = append(out, Status{Migration: mig, Applied: ok, AppliedAt: at})
+	}
+
+	return out, nil
+}
+
+// withLock runs fn on a single connection holding the migration advisory
+// lock. Other replicas block here until the first one is done, then find
+// nothing left to apply.
+func (m *Migrator) withLock(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	_, err = conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", advisoryLockKey)
+	if err != nil {
+		return fmt.Errorf("acquiring migration lock: %w", err)
+	}
+	defer conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", advisoryLockKey)
+
+	err = ensureVersionTable(ctx, conn)
+	if err != nil {
+		return err
+	}
+
+	return fn(conn)
+}
+
+func (m *Migrator) run(ctx context.Context, conn *sql.Conn, mig Migration, up bool) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	script := mig.Up
+	if !up {
+		script = mig.Down
+	}
+	if script != "" {
+		_, err = tx.ExecContext(ctx, script)
+		if err != nil {
+			return fmt.Errorf("migration %d_%s: %w", mig.Version, mig.Name, err)
+		}
+	}
+
+	if up {
+		_, err = tx.ExecContext(ctx, "INSERT INTO goose_db_version (version_id, is_applied) VALUES ($1, true)", mig.Version)
+	} else {
+		_, err = tx.ExecContext(ctx, "DELETE FROM goose_db_version WHERE version_id = $1", mig.Version)
+	}
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Up applies every pending migration in order and returns the ones it ran.
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	var ran []Migration
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		versions, err := applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		if current := currentVersion(versions); current > m.Latest() {
+			return fmt.Errorf("%w: database is at version %d, this build knows up to %d", ErrSchemaAhead, current, m.Latest())
+		}
+
+		for _, mig := range m.migrations {
+			if _, ok := versions[mig.Version]; ok {
+				continue
+			}
+			err := m.run(ctx, conn, mig, true)
+			if err != nil {
+				return err
+			}
+			ran = append(ran, mig)
+		}
+
+		return nil
+	})
+
+	return ran, err
+}
+
+// Down rolls back the newest applied migration.
+func (m *Migrator) Down(ctx context.Context) (Migration, error) {
+	var rolledBack Migration
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		versions, err := applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		current := currentVersion(versions)
+		if current == 0 {
+			return ErrNoNextDown
+		}
+
+		idx := slices.IndexFunc(m.migrations, func(mig Migration) bool { return mig.Version == current })
+		if idx < 0 {
+			return fmt.Errorf("%w: version %d has no migration file", ErrSchemaAhead, current)
+		}
+
+		rolledBack = m.migrations[idx]
+		return m.run(ctx, conn, rolledBack, false)
+	})
+
+	return rolledBack, err
+}
@@ -0,0 +1,70 @@
+package migrate
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"testing/fstest"
+)
+
+func TestParseSplitsSectionsAndSorts(t *testing.T) {
+	fsys := fstest.MapFS{
+		"002_chirps.sql": {Data: []byte("-- +goose Up\nCREATE TABLE chirps (id uuid);\n\n-- +goose Down\nDROP TABLE chirps;\n")},
+		"001_users.sql":  {Data: []byte("-- +goose Up\n-- +goose StatementBegin\nCREATE TABLE users (id uuid);\n-- +goose StatementEnd\n")},
+		"README.md":      {Data: []byte("not a migration")},
+	}
+
+	migrations, err := Parse(fsys)
+	if err != nil {
+		t.Fatalf("Error parsing migrations: %v", err)
+	}
+
+	if len(migrations) != 2 || migrations[0].Version != 1 || migrations[1].Version != 2 {
+		t.Fatalf("Expected versions 1 and 2 in order, got %+v", migrations)
+	}
+	if migrations[0].Name != "users" || migrations[0].Up != "CREATE TABLE users (id uuid);" || migrations[0].Down != "" {
+		t.Errorf("Unexpected first migration: %+v", migrations[0])
+	}
+	if migrations[1].Down != "DROP TABLE chirps;" {
+		t.Errorf("Down section should be split out, got %q", migrations[1].Down)
+	}
+}
+
+func TestParseRejectsBadFiles(t *testing.T) {
+	cases := map[string]fstest.MapFS{
+		"duplicate version": {
+			"001_a.sql":  {Data: []byte("-- +goose Up\nSELECT 1;")},
+			"0001_b.sql": {Data: []byte("-- +goose Up\nSELECT 1;")},
+		},
+		"missing up":         {"001_a.sql": {Data: []byte("SELECT 1;")}},
+		"unknown annotation": {"001_a.sql": {Data: []byte("-- +goose Up\n-- +goose NO TRANSACTION\nSELECT 1;")}},
+	}
+
+	for name, fsys := range cases {
+		_, err := Parse(fsys)
+		if err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+
+	_, err := Parse(fstest.MapFS{})
+	if !errors.Is(err, ErrNoMigrations) {
+		t.Errorf("An empty directory should return ErrNoMigrations, got %v", err)
+	}
+}
+
+func TestParseRepoSchema(t *testing.T) {
+	migrations, err := Parse(os.DirFS("../../sql/schema"))
+	if err != nil {
+		t.Fatalf("The repo's own migrations should parse: %v", err)
+	}
+
+	for i, mig := range migrations {
+		if mig.Version != int64(i+1) {
+			t.Errorf("Migrations should be numbered without gaps, found %d at position %d", mig.Version, i+1)
+		}
+		if mig.Down == "" {
+			t.Errorf("Migration %d_%s has no Down section", mig.Version, mig.Name)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+// Package oauth holds the protocol pieces of chirpy's OAuth 2.0 authorization
+// server that don't need the database: PKCE, scope strings, redirect uri
+// rules and the opaque tokens handed to clients.
+package oauth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Error codes from RFC 6749 section 4.1.2.1 and 5.2.
+const (
+	ErrInvalidRequest          = "invalid_request"
+	ErrInvalidClient           = "invalid_client"
+	ErrInvalidGrant            = "invalid_grant"
+	ErrUnauthorizedClient      = "unauthorized_client"
+	ErrUnsupportedGrantType    = "unsupported_grant_type"
+	ErrUnsupportedResponseType = "unsupported_response_type"
+	ErrInvalidScope            = "invalid_scope"
+	ErrAccessDenied            = "access_denied"
+	ErrServerError             = "server_error"
+)
+
+// Error is an OAuth error response. Unlike the rest of the API these use the
+// format RFC 6749 requires, which client libraries parse.
+type Error struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+}
+
+func (e *Error) Error() string {
+	if e.Description == "" {
+		return e.Code
+	}
+	return e.Code + ": " + e.Description
+}
+
+// Status is the HTTP status the token endpoints answer the error with.
+func (e *Error) Status() int {
+	switch e.Code {
+	case ErrInvalidClient:
+		return http.StatusUnauthorized
+	case ErrServerError:
+		return http.StatusInternalServerError
+	default:
+		return http.StatusBadRequest
+	}
+}
+
+func NewError(code, description string) *Error {
+	return &Error{Code: code, Description: description}
+}
+
+// codeVerifierPattern is RFC 7636's 43 to 128 unreserved characters.
+var codeVerifierPattern = regexp.MustCompile(`^[A-Za-z0-9\-._~]{43,128}$`)
+
+// S256Challenge derives the code challenge for verifier.
+func S256Challenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// VerifyPKCE checks a code verifier against the challenge sent when the code
+// was requested. Only S256 is supported; "plain" offers no protection when
+// the authorization request itself leaks.
+func VerifyPKCE(verifier, challenge, method string) bool {
+	if method != "S256" || !codeVerifierPattern.MatchString(verifier) {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(S256Challenge(verifier)), []byte(challenge)) == 1
+}
+
+// ValidChallenge reports whether challenge looks like an S256 challenge.
+func ValidChallenge(challenge string) bool {
+	b, err := base64.RawURLEncoding.DecodeString(challenge)
+	return err == nil && len(b) == sha256.Size
+}
+
+// ParseScope splits a space separated scope string, dropping duplicates.
+func ParseScope(s string) []string {
+	var scopes []string
+	for _, scope := range strings.Fields(s) {
+		if !slices.Contains(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+	return scopes
+}
+
+func FormatScope(scopes []string) string {
+	return strings.Join(scopes, " ")
+}
+
+// Subset reports whether every scope in requested is in allowed.
+func Subset(requested, allowed []string) bool {
+	for _, scope := range requested {
+		if !slices.Contains(allowed, scope) {
+			return false
+		}
+	}
+	return true
+}
+
+// ValidRedirectURI is the rule for registering a redirect uri: absolute,
+// without a fragment, and https unless it points at the loopback interface,
+// where native apps listen (RFC 8252).
+func ValidRedirectURI(raw string) bool {
+	u, err := url.Parse(raw)
+	if err != nil || !u.IsAbs() || u.Host == "" || u.Fragment != "" || u.User != nil {
+		return false
+	}
+	switch u.Scheme {
+	case "https":
+		return true
+	case "http":
+		host := u.Hostname()
+		ip := net.ParseIP(host)
+		return host == "localhost" || (ip != nil && ip.IsLoopback())
+	default:
+		return false
+	}
+}
+
+// NewToken returns a random token for codes, refresh tokens and client
+// secrets. The prefix makes leaked tokens recognisable.
+func NewToken(prefix string) (string, error) {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return prefix + hex.EncodeToString(b), nil
+}
+
+// Hash is how tokens are stored. They are random, so a fast hash is enough.
+func Hash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Equal compares a token to a stored hash in constant time.
+func Equal(token, hash string) bool {
+	return subtle.ConstantTimeCompare([]byte(Hash(token)), []byte(hash)) == 1
+}
@@ -0,0 +1,90 @@
+package oauth
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestVerifyPKCE(t *testing.T) {
+	// the example from RFC 7636 appendix B
+	verifier := "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	challenge := "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+
+	if S256Challenge(verifier) != challenge {
+		t.Fatalf("Expected challenge %s, got %s", challenge, S256Challenge(verifier))
+	}
+	if !VerifyPKCE(verifier, challenge, "S256") {
+		t.Errorf("The matching verifier should pass")
+	}
+	if VerifyPKCE(verifier, challenge, "plain") {
+		t.Errorf("The plain method should be refused")
+	}
+	if VerifyPKCE(strings.Replace(verifier, "d", "e", 1), challenge, "S256") {
+		t.Errorf("A different verifier should fail")
+	}
+	if VerifyPKCE("short", S256Challenge("short"), "S256") {
+		t.Errorf("Verifiers shorter than 43 characters should fail")
+	}
+	if !ValidChallenge(challenge) || ValidChallenge("not-a-challenge") {
+		t.Errorf("ValidChallenge should accept only 32 byte base64url values")
+	}
+}
+
+func TestScopes(t *testing.T) {
+	scopes := ParseScope(" chirps:write  media:write chirps:write ")
+	if FormatScope(scopes) != "chirps:write media:write" {
+		t.Errorf("Expected duplicates and spaces dropped, got %q", FormatScope(scopes))
+	}
+	if !Subset([]string{"chirps:write"}, scopes) || Subset([]string{"admin"}, scopes) {
+		t.Errorf("Subset should only accept allowed scopes")
+	}
+	if ParseScope("") != nil {
+		t.Errorf("An empty scope should parse to nothing")
+	}
+}
+
+func TestValidRedirectURI(t *testing.T) {
+	cases := map[string]bool{
+		"https://app.example.com/callback":   true,
+		"http://127.0.0.1:8123/callback":     true,
+		"http://localhost/callback":          true,
+		"http://app.example.com/callback":    false,
+		"https://app.example.com/cb#section": false,
+		"/callback":                          false,
+		"javascript:alert(1)":                false,
+		"https://user@app.example.com/cb":    false,
+	}
+
+	for uri, ok := range cases {
+		if ValidRedirectURI(uri) != ok {
+			t.Errorf("ValidRedirectURI(%q) should be %v", uri, ok)
+		}
+	}
+}
+
+func TestTokens(t *testing.T) {
+	token, err := NewToken("chirpy_rt_")
+	if err != nil {
+		t.Fatalf("Error making token: %v", err)
+	}
+	if !strings.HasPrefix(token, "chirpy_rt_") || len(token) != len("chirpy_rt_")+64 {
+		t.Errorf("Unexpected token format %q", token)
+	}
+	if !Equal(token, Hash(token)) || Equal(token+"x", Hash(token)) {
+		t.Errorf("Equal should match only the hashed token")
+	}
+}
+
+func TestErrorStatus(t *testing.T) {
+	cases := map[string]int{
+		ErrInvalidClient:  401,
+		ErrInvalidGrant:   400,
+		ErrInvalidRequest: 400,
+		ErrServerError:    500,
+	}
+	for code, status := range cases {
+		if got := NewError(code, "").Status(); got != status {
+			t.Errorf("Expected %s to be a %d, got %d", code, status, got)
+		}
+	}
+}
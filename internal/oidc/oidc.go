@@ -0,0 +1,386 @@
+// Package oidc signs users in with external OpenID Connect providers. It
+// discovers a provider's endpoints, builds the authorization code request
+// and checks the ID token the provider sends back against its published
+// keys.
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	maxResponseSize = 1 << 20
+	// minKeyRefresh bounds how often an unknown key id refetches the key
+	// set, so forged tokens can't make us hammer the provider.
+	minKeyRefresh = time.Minute
+	// leeway allows for clock skew between us and the provider.
+	leeway = time.Minute
+)
+
+// ErrInvalidToken wraps every reason an ID token is refused.
+var ErrInvalidToken = errors.New("invalid id token")
+
+type Config struct {
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	// RedirectURL is our callback, as registered with the provider.
+	RedirectURL string
+}
+
+// Identity is who the provider says the user is. Subject is the only stable
+// identifier; the email can change or be reassigned.
+type Identity struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+type metadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Provider is one configured OpenID Connect provider. Discovery happens on
+// first use, so a provider being down doesn't stop the server starting.
+type Provider struct {
+	cfg    Config
+	client *http.Client
+	now    func() time.Time
+
+	mu          sync.Mutex
+	metadata    *metadata
+	keys        map[string]crypto.PublicKey
+	keysFetched time.Time
+}
+
+func New(cfg Config, client *http.Client) *Provider {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &Provider{cfg: cfg, client: client, now: time.Now}
+}
+
+func (p *Provider) Name() string {
+	return p.cfg.Name
+}
+
+// AuthCodeURL is where to send the user to sign in. state ties the callback
+// to the browser that started it, nonce ties the ID token to this attempt
+// and codeChallenge is the PKCE S256 challenge.
+func (p *Provider) AuthCodeURL(ctx context.Context, state, nonce, codeChallenge string) (string, error) {
+	md, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	u, err := url.Parse(md.AuthorizationEndpoint)
+	if err != nil {
+		return "", fmt.Errorf("oidc %s: bad authorization_endpoint: %w", p.cfg.Name, err)
+	}
+	query := u.Query()
+	query.Set("response_type", "code")
+	query.Set("client_id", p.cfg.ClientID)
+	query.Set("redirect_uri", p.cfg.RedirectURL)
+	query.Set("scope", "openid email profile")
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	query.Set("code_challenge", codeChallenge)
+	query.Set("code_challenge_method", "S256")
+	u.RawQuery = query.Encode()
+
+	return u.String(), nil
+}
+
+// Exchange trades the callback's code for an ID token and verifies it.
+func (p *Provider) Exchange(ctx context.Context, code, codeVerifier, nonce string) (Identity, error) {
+	md, err := p.discover(ctx)
+	if err != nil {
+		return Identity{}, err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.cfg.RedirectURL},
+		"code_verifier": {codeVerifier},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, md.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return Identity{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	// client_secret_basic, which RFC 6749 says is form encoded first
+	req.SetBasicAuth(url.QueryEscape(p.cfg.ClientID), url.QueryEscape(p.cfg.ClientSecret))
+
+	var token struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	status, err := p.doJSON(req, &token)
+	if err != nil {
+		return Identity{}, err
+	}
+	if status != http.StatusOK {
+		return Identity{}, fmt.Errorf("oidc %s: token request failed with %d: %s %s", p.cfg.Name, status, token.Error, token.ErrorDescription)
+	}
+	if token.IDToken == "" {
+		return Identity{}, fmt.Errorf("oidc %s: token response has no id_token", p.cfg.Name)
+	}
+
+	return p.Verify(ctx, token.IDToken, nonce)
+}
+
+type idTokenClaims struct {
+	jwt.RegisteredClaims
+	Nonce           string `json:"nonce"`
+	AuthorizedParty string `json:"azp"`
+	Email           string `json:"email"`
+	// some providers send "true" rather than true
+	EmailVerified any    `json:"email_verified"`
+	Name          string `json:"name"`
+}
+
+// Verify checks an ID token's signature, issuer, audience, expiry and nonce.
+func (p *Provider) Verify(ctx context.Context, rawIDToken, nonce string) (Identity, error) {
+	if _, err := p.discover(ctx); err != nil {
+		return Identity{}, err
+	}
+
+	claims := &idTokenClaims{}
+	_, err := jwt.ParseWithClaims(rawIDToken, claims, func(t *jwt.Token) (any, error) {
+		kid, _ := t.Header["kid"].(string)
+		return p.key(ctx, kid)
+	},
+		jwt.WithValidMethods([]string{"RS256", "ES256"}),
+		jwt.WithIssuer(p.cfg.Issuer),
+		jwt.WithAudience(p.cfg.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(leeway),
+		jwt.WithTimeFunc(p.now),
+	)
+	if err != nil {
+		return Identity{}, fmt.Errorf("%w: %w", ErrInvalidToken, err)
+	}
+
+	if len(claims.Audience) > 1 && claims.AuthorizedParty != p.cfg.ClientID {
+		return Identity{}, fmt.Errorf("%w: azp is %q", ErrInvalidToken, claims.AuthorizedParty)
+	}
+	if nonce == "" || subtle.ConstantTimeCompare([]byte(claims.Nonce), []byte(nonce)) != 1 {
+		return Identity{}, fmt.Errorf("%w: nonce does not match", ErrInvalidToken)
+	}
+	if claims.Subject == "" {
+		return Identity{}, fmt.Errorf("%w: no subject", ErrInvalidToken)
+	}
+
+	return Identity{
+		Subject:       claims.Subject,
+		Email:         claims.Email,
+		EmailVerified: claims.EmailVerified == true || claims.EmailVerified == "true",
+		Name:          claims.Name,
+	}, nil
+}
+
+func (p *Provider) discover(ctx context.Context) (*metadata, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.metadata != nil {
+		return p.metadata, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(p.cfg.Issuer, "/")+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	md := &metadata{}
+	status, err := p.doJSON(req, md)
+	if err != nil {
+		return nil, err
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("oidc %s: discovery failed with %d", p.cfg.Name, status)
+	}
+
+	// a document claiming another issuer could vouch for its users as ours
+	if md.Issuer != p.cfg.Issuer {
+		return nil, fmt.Errorf("oidc %s: discovery issuer %q does not match %q", p.cfg.Name, md.Issuer, p.cfg.Issuer)
+	}
+	if md.AuthorizationEndpoint == "" || md.TokenEndpoint == "" || md.JWKSURI == "" {
+		return nil, fmt.Errorf("oidc %s: discovery document is missing endpoints", p.cfg.Name)
+	}
+
+	p.metadata = md
+	return md, nil
+}
+
+// key finds the signing key for kid, refetching the key set when the
+// provider may have rotated keys since we last looked.
+func (p *Provider) key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if key, ok := p.lookupKey(kid); ok {
+		return key, nil
+	}
+
+	if p.keys != nil && p.now().Sub(p.keysFetched) < minKeyRefresh {
+		return nil, fmt.Errorf("unknown key id %q", kid)
+	}
+
+	keys, err := p.fetchKeys(ctx)
+	if err != nil {
+		return nil, err
+	}
+	p.keys = keys
+	p.keysFetched = p.now()
+
+	if key, ok := p.lookupKey(kid); ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown key id %q", kid)
+}
+
+func (p *Provider) lookupKey(kid string) (crypto.PublicKey, bool) {
+	// a token without a key id is fine while there is only one key
+	if kid == "" && len(p.keys) == 1 {
+		for _, key := range p.keys {
+			return key, true
+		}
+	}
+	key, ok := p.keys[kid]
+	return key, ok
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (p *Provider) fetchKeys(ctx context.Context) (map[string]crypto.PublicKey, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.metadata.JWKSURI, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	status, err := p.doJSON(req, &set)
+	if err != nil {
+		return nil, err
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("oidc %s: fetching keys failed with %d", p.cfg.Name, status)
+	}
+
+	keys := map[string]crypto.PublicKey{}
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		// keys we can't use are skipped, the provider may publish others
+		key, err := k.publicKey()
+		if err != nil {
+			continue
+		}
+		keys[k.Kid] = key
+	}
+	return keys, nil
+}
+
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return nil, errors.New("rsa exponent too large")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		if k.Crv != "P-256" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		key := &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}
+		if !key.Curve.IsOnCurve(x, y) {
+			return nil, errors.New("point is not on the curve")
+		}
+		return key, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
+
+func decodeInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(b) == 0 {
+		return nil, errors.New("bad key parameter")
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+func (p *Provider) doJSON(req *http.Request, v any) (int, error) {
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("oidc %s: %w", p.cfg.Name, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return resp.StatusCode, fmt.Errorf("oidc %s: %w", p.cfg.Name, err)
+	}
+
+	err = json.Unmarshal(body, v)
+	if err != nil && resp.StatusCode == http.StatusOK {
+		return resp.StatusCode, fmt.Errorf("oidc %s: decoding %s: %w", p.cfg.Name, req.URL.Path, err)
+	}
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,228 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// mockIssuer is a minimal OpenID Connect provider. It answers any code with
+// an ID token built from claims and signed with the current key.
+type mockIssuer struct {
+	t      *testing.T
+	server *httptest.Server
+	key    *rsa.PrivateKey
+	kid    string
+	claims jwt.MapClaims
+
+	gotForm    url.Values
+	keyFetches int
+}
+
+func newMockIssuer(t *testing.T) *mockIssuer {
+	m := &mockIssuer{t: t}
+	m.rotateKey("key-1")
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 m.server.URL,
+			"authorization_endpoint": m.server.URL + "/authorize",
+			"token_endpoint":         m.server.URL + "/token",
+			"jwks_uri":               m.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("GET /jwks", func(w http.ResponseWriter, r *http.Request) {
+		m.keyFetches++
+		json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": m.kid,
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(m.key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(m.key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("POST /token", func(w http.ResponseWriter, r *http.Request) {
+		id, secret, _ := r.BasicAuth()
+		if id != "chirpy" || secret != "shh" {
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_client"})
+			return
+		}
+		r.ParseForm()
+		m.gotForm = r.PostForm
+		json.NewEncoder(w).Encode(map[string]string{"id_token": m.sign(m.claims), "token_type": "Bearer"})
+	})
+
+	m.server = httptest.NewServer(mux)
+	t.Cleanup(m.server.Close)
+
+	now := time.Now()
+	m.claims = jwt.MapClaims{
+		"iss":            m.server.URL,
+		"aud":            "chirpy",
+		"sub":            "user-123",
+		"iat":            now.Unix(),
+		"exp":            now.Add(time.Hour).Unix(),
+		"nonce":          "the-nonce",
+		"email":          "walt@example.com",
+		"email_verified": true,
+	}
+	return m
+}
+
+func (m *mockIssuer) rotateKey(kid string) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		m.t.Fatalf("Error generating key: %v", err)
+	}
+	m.key, m.kid = key, kid
+}
+
+func (m *mockIssuer) sign(claims jwt.MapClaims) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = m.kid
+	s, err := token.SignedString(m.key)
+	if err != nil {
+		m.t.Fatalf("Error signing id token: %v", err)
+	}
+	return s
+}
+
+func (m *mockIssuer) provider() *Provider {
+	return New(Config{
+		Name:         "mock",
+		Issuer:       m.server.URL,
+		ClientID:     "chirpy",
+		ClientSecret: "shh",
+		RedirectURL:  "http://localhost:8080/api/auth/oidc/mock/callback",
+	}, m.server.Client())
+}
+
+func TestLoginFlow(t *testing.T) {
+	m := newMockIssuer(t)
+	p := m.provider()
+	ctx := context.Background()
+
+	authURL, err := p.AuthCodeURL(ctx, "the-state", "the-nonce", "the-challenge")
+	if err != nil {
+		t.Fatalf("Error building auth url: %v", err)
+	}
+	u, _ := url.Parse(authURL)
+	query := u.Query()
+	if u.Path != "/authorize" || query.Get("state") != "the-state" || query.Get("nonce") != "the-nonce" ||
+		query.Get("code_challenge_method") != "S256" || query.Get("client_id") != "chirpy" {
+		t.Errorf("Unexpected auth url %s", authURL)
+	}
+
+	identity, err := p.Exchange(ctx, "the-code", "the-verifier", "the-nonce")
+	if err != nil {
+		t.Fatalf("Error exchanging code: %v", err)
+	}
+	if identity.Subject != "user-123" || identity.Email != "walt@example.com" || !identity.EmailVerified {
+		t.Errorf("Unexpected identity %+v", identity)
+	}
+	if m.gotForm.Get("code") != "the-code" || m.gotForm.Get("code_verifier") != "the-verifier" {
+		t.Errorf("Unexpected token request %v", m.gotForm)
+	}
+}
+
+func TestVerifyRejects(t *testing.T) {
+	m := newMockIssuer(t)
+	p := m.provider()
+	ctx := context.Background()
+
+	cases := map[string]func(jwt.MapClaims){
+		"wrong issuer":   func(c jwt.MapClaims) { c["iss"] = "https://evil.example" },
+		"wrong audience": func(c jwt.MapClaims) { c["aud"] = "someone-else" },
+		"expired":        func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Hour).Unix() },
+		"wrong nonce":    func(c jwt.MapClaims) { c["nonce"] = "replayed" },
+		"no subject":     func(c jwt.MapClaims) { delete(c, "sub") },
+		"wrong azp": func(c jwt.MapClaims) {
+			c["aud"] = []string{"chirpy", "other"}
+			c["azp"] = "other"
+		},
+	}
+	for name, mutate := range cases {
+		t.Run(name, func(t *testing.T) {
+			claims := jwt.MapClaims{}
+			for k, v := range m.claims {
+				claims[k] = v
+			}
+			mutate(claims)
+
+			_, err := p.Verify(ctx, m.sign(claims), "the-nonce")
+			if !errors.Is(err, ErrInvalidToken) {
+				t.Errorf("Expected ErrInvalidToken, got %v", err)
+			}
+		})
+	}
+
+	// a token signed with a key the issuer never published
+	other, _ := rsa.GenerateKey(rand.Reader, 2048)
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, m.claims)
+	token.Header["kid"] = m.kid
+	forged, _ := token.SignedString(other)
+	_, err := p.Verify(ctx, forged, "the-nonce")
+	if !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("A forged signature should be refused, got %v", err)
+	}
+
+	// alg none must never be accepted
+	unsigned, _ := jwt.NewWithClaims(jwt.SigningMethodNone, m.claims).SignedString(jwt.UnsafeAllowNoneSignatureType)
+	_, err = p.Verify(ctx, unsigned, "the-nonce")
+	if !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("An unsigned token should be refused, got %v", err)
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	m := newMockIssuer(t)
+	p := m.provider()
+	ctx := context.Background()
+	now := time.Now()
+	p.now = func() time.Time { return now }
+
+	_, err := p.Verify(ctx, m.sign(m.claims), "the-nonce")
+	if err != nil {
+		t.Fatalf("Error verifying: %v", err)
+	}
+
+	m.rotateKey("key-2")
+
+	// unknown key ids don't refetch more than once a minute
+	_, err = p.Verify(ctx, m.sign(m.claims), "the-nonce")
+	if err == nil {
+		t.Errorf("The new key should not be fetched yet")
+	}
+	if m.keyFetches != 1 {
+		t.Errorf("Expected 1 key fetch, got %d", m.keyFetches)
+	}
+
+	now = now.Add(2 * minKeyRefresh)
+	_, err = p.Verify(ctx, m.sign(m.claims), "the-nonce")
+	if err != nil {
+		t.Errorf("The rotated key should be picked up: %v", err)
+	}
+}
+
+func TestDiscoveryIssuerMismatch(t *testing.T) {
+	m := newMockIssuer(t)
+	p := New(Config{Name: "mock", Issuer: m.server.URL + "/", ClientID: "chirpy"}, m.server.Client())
+
+	_, err := p.AuthCodeURL(context.Background(), "s", "n", "c")
+	if err == nil {
+		t.Errorf("A discovery document for another issuer should be refused")
+	}
+}
@@ -0,0 +1,89 @@
+// Package ratelimit is an in-memory token bucket keyed by caller. Limits are
+// per process, which is fine while chirpy runs as a single instance.
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// Rate allows PerMinute requests a minute on average and up to Burst at once.
+type Rate struct {
+	PerMinute int
+	Burst     int
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// sweepInterval is how often buckets that have refilled completely are
+// dropped, since they behave exactly like a new bucket.
+const sweepInterval = time.Minute
+
+type Limiter struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+func New() *Limiter {
+	return &Limiter{
+		buckets: map[string]*bucket{},
+		now:     time.Now,
+	}
+}
+
+// Allow takes a token from key's bucket. The rate is passed on every call
+// rather than fixed per key, so a user who upgrades gets the new limit on
+// their next request. When it refuses, it says how long until a token is
+// available.
+func (l *Limiter) Allow(key string, rate Rate) (bool, time.Duration) {
+	if rate.PerMinute <= 0 || rate.Burst <= 0 {
+		return true, 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	perSecond := float64(rate.PerMinute) / 60
+	capacity := float64(rate.Burst)
+
+	l.sweep(now, perSecond, capacity)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: capacity, last: now}
+		l.buckets[key] = b
+	}
+
+	b.tokens = min(capacity, b.tokens+now.Sub(b.last).Seconds()*perSecond)
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+
+	wait := time.Duration((1 - b.tokens) / perSecond * float64(time.Second))
+	return false, wait
+}
+
+// sweep uses the current caller's rate for every bucket. A bucket idle long
+// enough to refill at that rate is dropped; the worst case is someone on a
+// slower plan getting a fresh bucket slightly early.
+func (l *Limiter) sweep(now time.Time, perSecond, capacity float64) {
+	if now.Sub(l.lastSweep) < sweepInterval {
+		return
+	}
+	l.lastSweep = now
+
+	for key, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*perSecond >= capacity {
+			delete(l.buckets, key)
+		}
+	}
+}
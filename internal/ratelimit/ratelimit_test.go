@@ -0,0 +1,84 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+type fakeClock struct{ t time.Time }
+
+func (c *fakeClock) now() time.Time          { return c.t }
+func (c *fakeClock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func newTestLimiter() (*Limiter, *fakeClock) {
+	clock := &fakeClock{t: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	l := New()
+	l.now = clock.now
+	return l, clock
+}
+
+func TestAllowBurstThenRefill(t *testing.T) {
+	l, clock := newTestLimiter()
+	rate := Rate{PerMinute: 60, Burst: 3}
+
+	for i := range 3 {
+		ok, _ := l.Allow("alice", rate)
+		if !ok {
+			t.Fatalf("Request %d should fit in the burst", i+1)
+		}
+	}
+
+	ok, wait := l.Allow("alice", rate)
+	if ok {
+		t.Fatalf("Request past the burst should be refused")
+	}
+	if wait <= 0 || wait > time.Second {
+		t.Errorf("Expected to wait at most a second for one token, got %v", wait)
+	}
+
+	ok, _ = l.Allow("bob", rate)
+	if !ok {
+		t.Errorf("Keys should have separate buckets")
+	}
+
+	clock.advance(time.Second)
+	ok, _ = l.Allow("alice", rate)
+	if !ok {
+		t.Errorf("A token should refill after a second at 60 a minute")
+	}
+}
+
+func TestAllowUsesCurrentRate(t *testing.T) {
+	l, _ := newTestLimiter()
+
+	ok, _ := l.Allow("alice", Rate{PerMinute: 60, Burst: 1})
+	if !ok {
+		t.Fatalf("First request should be allowed")
+	}
+	ok, _ = l.Allow("alice", Rate{PerMinute: 60, Burst: 1})
+	if ok {
+		t.Fatalf("Second request should exceed a burst of 1")
+	}
+
+	// an upgrade raises the cap, but tokens still have to refill
+	ok, _ = l.Allow("alice", Rate{PerMinute: 600, Burst: 10})
+	if ok {
+		t.Errorf("A higher limit shouldn't grant tokens immediately")
+	}
+}
+
+func TestSweepDropsIdleBuckets(t *testing.T) {
+	l, clock := newTestLimiter()
+	rate := Rate{PerMinute: 60, Burst: 5}
+
+	l.Allow("alice", rate)
+	clock.advance(2 * sweepInterval)
+	l.Allow("bob", rate)
+
+	if _, ok := l.buckets["alice"]; ok {
+		t.Errorf("Refilled buckets should be swept")
+	}
+	if _, ok := l.buckets["bob"]; !ok {
+		t.Errorf("The current caller's bucket should remain")
+	}
+}
@@ -0,0 +1,90 @@
+// Package signature signs and verifies webhook payloads with a timestamped
+// HMAC-SHA256, in a header of the form
+//
+//	t=1700000000,v1=<hex hmac of "1700000000.<body>">
+//
+// Several v1 entries may be present while a secret is being rotated.
+package signature
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrMissing   = errors.New("signature missing")
+	ErrMalformed = errors.New("signature malformed")
+	ErrExpired   = errors.New("signature timestamp outside tolerance")
+	ErrMismatch  = errors.New("signature does not match")
+)
+
+func compute(secret string, timestamp int64, body []byte) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return mac.Sum(nil)
+}
+
+// Header builds the signature header value for body signed at t.
+func Header(secret string, t time.Time, body []byte) string {
+	ts := t.Unix()
+	return "t=" + strconv.FormatInt(ts, 10) + ",v1=" + hex.EncodeToString(compute(secret, ts, body))
+}
+
+// Verify checks header against body. The timestamp must be within tolerance
+// of now in either direction, which bounds how long a captured request can
+// be replayed.
+func Verify(header string, body []byte, secret string, tolerance time.Duration, now time.Time) error {
+	if header == "" {
+		return ErrMissing
+	}
+
+	var timestamp int64
+	var haveTimestamp bool
+	var signatures [][]byte
+	for _, part := range strings.Split(header, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			return ErrMalformed
+		}
+		switch key {
+		case "t":
+			ts, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return ErrMalformed
+			}
+			timestamp, haveTimestamp = ts, true
+		case "v1":
+			sig, err := hex.DecodeString(value)
+			if err != nil {
+				return ErrMalformed
+			}
+			signatures = append(signatures, sig)
+		}
+	}
+
+	if !haveTimestamp || len(signatures) == 0 {
+		return ErrMalformed
+	}
+
+	age := now.Sub(time.Unix(timestamp, 0))
+	if age > tolerance || age < -tolerance {
+		return ErrExpired
+	}
+
+	expected := compute(secret, timestamp, body)
+	for _, sig := range signatures {
+		// hmac.Equal is constant time
+		if hmac.Equal(sig, expected) {
+			return nil
+		}
+	}
+
+	return ErrMismatch
+}
@@ -0,0 +1,59 @@
+package signature
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+const secret = "whsec_test_secret"
+
+func TestVerifyRoundTrip(t *testing.T) {
+	body := []byte(`{"event":"user.upgraded"}`)
+	now := time.Unix(1_700_000_000, 0)
+
+	header := Header(secret, now, body)
+	err := Verify(header, body, secret, 5*time.Minute, now.Add(time.Minute))
+	if err != nil {
+		t.Errorf("A fresh signature should verify: %v", err)
+	}
+
+	// a second signature from a rotated secret is accepted alongside
+	rotated := Header("old_secret", now, body) + "," + strings.Split(header, ",")[1]
+	err = Verify(rotated, body, secret, 5*time.Minute, now)
+	if err != nil {
+		t.Errorf("Any matching v1 entry should verify: %v", err)
+	}
+}
+
+func TestVerifyRejections(t *testing.T) {
+	body := []byte(`{"event":"user.upgraded"}`)
+	now := time.Unix(1_700_000_000, 0)
+	header := Header(secret, now, body)
+
+	cases := []struct {
+		name   string
+		header string
+		body   []byte
+		secret string
+		now    time.Time
+		want   error
+	}{
+		{"missing", "", body, secret, now, ErrMissing},
+		{"no timestamp", "v1=abcd", body, secret, now, ErrMalformed},
+		{"not hex", "t=1700000000,v1=zz", body, secret, now, ErrMalformed},
+		{"garbage", "nonsense", body, secret, now, ErrMalformed},
+		{"replayed later", header, body, secret, now.Add(10 * time.Minute), ErrExpired},
+		{"from the future", header, body, secret, now.Add(-10 * time.Minute), ErrExpired},
+		{"tampered body", header, []byte(`{"event":"user.downgraded"}`), secret, now, ErrMismatch},
+		{"wrong secret", header, body, "other", now, ErrMismatch},
+	}
+
+	for _, c := range cases {
+		err := Verify(c.header, c.body, c.secret, 5*time.Minute, c.now)
+		if !errors.Is(err, c.want) {
+			t.Errorf("%s: expected %v, got %v", c.name, c.want, err)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// LocalStore keeps blobs on the local filesystem under a root directory.
+type LocalStore struct {
+	root string
+}
+
+func NewLocalStore(root string) (*LocalStore, error) {
+	err := os.MkdirAll(root, 0o755)
+	if err != nil {
+		return nil, err
+	}
+
+	return &LocalStore{root: root}, nil
+}
+
+func (s *LocalStore) path(key string) (string, error) {
+	err := ValidateKey(key)
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(s.root, filepath.FromSlash(key)), nil
+}
+
+func (s *LocalStore) Put(ctx context.Context, key string, r io.Reader, contentType string) (Object, error) {
+	p, err := s.path(key)
+	if err != nil {
+		return Object{}, err
+	}
+
+	err = os.MkdirAll(filepath.Dir(p), 0o755)
+	if err != nil {
+		return Object{}, err
+	}
+
+	// write to a temp file first so readers never see a partial blob
+	tmp, err := os.CreateTemp(filepath.Dir(p), ".upload-*")
+	if err != nil {
+		return Object{}, err
+	}
+	defer os.Remove(tmp.Name())
+
+	size, err := io.Copy(tmp, r)
+	if err != nil {
+		tmp.Close()
+		return Object{}, err
+	}
+
+	err = tmp.Close()
+	if err != nil {
+		return Object{}, err
+	}
+
+	err = os.Rename(tmp.Name(), p)
+	if err != nil {
+		return Object{}, err
+	}
+
+	info, err := os.Stat(p)
+	if err != nil {
+		return Object{}, err
+	}
+
+	obj := Object{
+		Key:         key,
+		ContentType: contentType,
+		Size:        size,
+		ModTime:     info.ModTime(),
+	}
+
+	return obj, nil
+}
+
+func (s *LocalStore) Get(ctx context.Context, key string) (io.ReadCloser, Object, error) {
+	p, err := s.path(key)
+	if err != nil {
+		return nil, Object{}, err
+	}
+
+	f, err := os.Open(p)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, Object{}, ErrNotFound
+		}
+		return nil, Object{}, err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, Object{}, err
+	}
+
+	obj := Object{
+		Key:         key,
+		ContentType: mime.TypeByExtension(path.Ext(key)),
+		Size:        info.Size(),
+		ModTime:     info.ModTime(),
+	}
+
+	return f, obj, nil
+}
+
+func (s *LocalStore) Delete(ctx context.Context, key string) error {
+	p, err := s.path(key)
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(p)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	return nil
+}
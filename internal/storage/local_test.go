@@ -0,0 +1,64 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestLocalStoreRoundTrip(t *testing.T) {
+	store, err := NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("Error creating store: %v", err)
+	}
+
+	ctx := context.Background()
+	obj, err := store.Put(ctx, "avatars/test.png", strings.NewReader("hello"), "image/png")
+	if err != nil {
+		t.Fatalf("Error putting blob: %v", err)
+	}
+
+	if obj.Size != 5 {
+		t.Errorf("Size should be 5, got %d", obj.Size)
+	}
+
+	rc, obj, err := store.Get(ctx, "avatars/test.png")
+	if err != nil {
+		t.Fatalf("Error getting blob: %v", err)
+	}
+	data, _ := io.ReadAll(rc)
+	rc.Close()
+
+	if string(data) != "hello" {
+		t.Errorf("Blob contents do not match! %q != %q", data, "hello")
+	}
+
+	if obj.ContentType != "image/png" {
+		t.Errorf("Content type should be image/png, got %q", obj.ContentType)
+	}
+
+	err = store.Delete(ctx, "avatars/test.png")
+	if err != nil {
+		t.Errorf("Error deleting blob: %v", err)
+	}
+
+	_, _, err = store.Get(ctx, "avatars/test.png")
+	if err != ErrNotFound {
+		t.Errorf("Deleted blob should not be found: %v", err)
+	}
+}
+
+func TestLocalStoreRejectsTraversal(t *testing.T) {
+	store, err := NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("Error creating store: %v", err)
+	}
+
+	for _, key := range []string{"../secret", "/etc/passwd", "a//b", "a/./b", ""} {
+		_, err := store.Put(context.Background(), key, strings.NewReader("x"), "text/plain")
+		if err != ErrInvalidKey {
+			t.Errorf("Key %q should be rejected, got %v", key, err)
+		}
+	}
+}
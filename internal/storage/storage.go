@@ -0,0 +1,43 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"time"
+)
+
+var (
+	ErrNotFound   = errors.New("blob not found")
+	ErrInvalidKey = errors.New("invalid blob key")
+)
+
+// Object describes a stored blob.
+type Object struct {
+	Key         string
+	ContentType string
+	Size        int64
+	ModTime     time.Time
+}
+
+// BlobStore is the interface uploaded media is written through. Keys are
+// slash separated relative paths such as "avatars/<id>.png".
+type BlobStore interface {
+	Put(ctx context.Context, key string, r io.Reader, contentType string) (Object, error)
+	Get(ctx context.Context, key string) (io.ReadCloser, Object, error)
+	Delete(ctx context.Context, key string) error
+}
+
+func ValidateKey(key string) error {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, "\\") {
+		return ErrInvalidKey
+	}
+	for _, part := range strings.Split(key, "/") {
+		if part == "" || part == "." || part == ".." {
+			return ErrInvalidKey
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,97 @@
+package tracing
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"regexp"
+	"strings"
+)
+
+// DBTX mirrors the interface sqlc generates in internal/database, so a
+// wrapped connection or transaction can be handed straight to database.New.
+type DBTX interface {
+	ExecContext(context.Context, string, ...interface{}) (sql.Result, error)
+	PrepareContext(context.Context, string) (*sql.Stmt, error)
+	QueryContext(context.Context, string, ...interface{}) (*sql.Rows, error)
+	QueryRowContext(context.Context, string, ...interface{}) *sql.Row
+}
+
+// sqlc prefixes every query with a "-- name: GetChirp :one" comment.
+var queryNameRe = regexp.MustCompile(`^--\s*name:\s*(\w+)`)
+
+type tracedDB struct {
+	db     DBTX
+	tracer *Tracer
+}
+
+// WrapDB records a client span for each query run through db. Queries made
+// outside of a traced request are passed through untouched.
+func (t *Tracer) WrapDB(db DBTX) DBTX {
+	if t == nil {
+		return db
+	}
+	return &tracedDB{db: db, tracer: t}
+}
+
+func (d *tracedDB) start(ctx context.Context, query string) (context.Context, *Span) {
+	name := "query"
+	if m := queryNameRe.FindStringSubmatch(strings.TrimSpace(query)); m != nil {
+		name = m[1]
+	}
+
+	return d.tracer.Start(ctx, "db "+name, OnlyIfParent(), WithKind(KindClient), WithAttributes(
+		"db.system", "postgresql",
+		"db.operation.name", name,
+		"db.query.text", query,
+	))
+}
+
+func (d *tracedDB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	ctx, span := d.start(ctx, query)
+	defer span.End()
+
+	res, err := d.db.ExecContext(ctx, query, args...)
+	span.RecordError(err)
+	if err == nil {
+		if n, err := res.RowsAffected(); err == nil {
+			span.SetAttributes("db.rows_affected", n)
+		}
+	}
+
+	return res, err
+}
+
+func (d *tracedDB) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	ctx, span := d.start(ctx, query)
+	defer span.End()
+
+	stmt, err := d.db.PrepareContext(ctx, query)
+	span.RecordError(err)
+
+	return stmt, err
+}
+
+// QueryContext times the round trip to the first row; scanning the rest
+// happens after the span ends.
+func (d *tracedDB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	ctx, span := d.start(ctx, query)
+	defer span.End()
+
+	rows, err := d.db.QueryContext(ctx, query, args...)
+	span.RecordError(err)
+
+	return rows, err
+}
+
+func (d *tracedDB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	ctx, span := d.start(ctx, query)
+	defer span.End()
+
+	row := d.db.QueryRowContext(ctx, query, args...)
+	if err := row.Err(); err != nil && !errors.Is(err, sql.ErrNoRows) {
+		span.RecordError(err)
+	}
+
+	return row
+}
@@ -0,0 +1,256 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// WriterExporter writes one JSON object per span, for local development or
+// shipping spans with a log collector.
+type WriterExporter struct {
+	mu     sync.Mutex
+	w      io.Writer
+	closer io.Closer
+}
+
+func NewWriterExporter(w io.Writer) *WriterExporter {
+	return &WriterExporter{w: w}
+}
+
+// NewFileExporter appends spans to the file at path, creating it if needed.
+func NewFileExporter(path string) (*WriterExporter, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &WriterExporter{w: f, closer: f}, nil
+}
+
+type jsonSpan struct {
+	TraceID       string         `json:"trace_id"`
+	SpanID        string         `json:"span_id"`
+	ParentSpanID  string         `json:"parent_span_id,omitempty"`
+	Name          string         `json:"name"`
+	Kind          string         `json:"kind"`
+	Start         time.Time      `json:"start"`
+	DurationMS    float64        `json:"duration_ms"`
+	Attributes    map[string]any `json:"attributes,omitempty"`
+	Status        string         `json:"status"`
+	StatusMessage string         `json:"status_message,omitempty"`
+}
+
+var kindNames = map[SpanKind]string{
+	KindInternal: "internal",
+	KindServer:   "server",
+	KindClient:   "client",
+}
+
+var statusNames = map[StatusCode]string{
+	StatusUnset: "unset",
+	StatusOK:    "ok",
+	StatusError: "error",
+}
+
+func (e *WriterExporter) ExportSpans(ctx context.Context, spans []SpanData) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	enc := json.NewEncoder(e.w)
+	for _, s := range spans {
+		out := jsonSpan{
+			TraceID:       s.SpanContext.TraceID.String(),
+			SpanID:        s.SpanContext.SpanID.String(),
+			Name:          s.Name,
+			Kind:          kindNames[s.Kind],
+			Start:         s.Start.UTC(),
+			DurationMS:    float64(s.End.Sub(s.Start).Microseconds()) / 1000,
+			Attributes:    s.Attributes,
+			Status:        statusNames[s.Status],
+			StatusMessage: s.StatusMessage,
+		}
+		if s.Parent.IsValid() {
+			out.ParentSpanID = s.Parent.SpanID.String()
+		}
+
+		err := enc.Encode(out)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (e *WriterExporter) Shutdown(ctx context.Context) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.closer != nil {
+		return e.closer.Close()
+	}
+	return nil
+}
+
+// OTLPExporter posts spans to an OpenTelemetry collector using OTLP/HTTP with
+// the JSON encoding, e.g. http://localhost:4318/v1/traces.
+type OTLPExporter struct {
+	endpoint    string
+	serviceName string
+	client      *http.Client
+	headers     map[string]string
+}
+
+func NewOTLPExporter(endpoint, serviceName string, headers map[string]string) *OTLPExporter {
+	return &OTLPExporter{
+		endpoint:    endpoint,
+		serviceName: serviceName,
+		client:      &http.Client{Timeout: 10 * time.Second},
+		headers:     headers,
+	}
+}
+
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	ParentSpanID      string         `json:"parentSpanId,omitempty"`
+	Name              string         `json:"name"`
+	Kind              SpanKind       `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	Status            otlpStatus     `json:"status"`
+}
+
+type otlpStatus struct {
+	Code    StatusCode `json:"code"`
+	Message string     `json:"message,omitempty"`
+}
+
+type otlpKeyValue struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+// otlpValue is the AnyValue oneof; 64-bit ints travel as strings in OTLP/JSON.
+type otlpValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+}
+
+func otlpAttr(key string, v any) otlpKeyValue {
+	var val otlpValue
+	switch v := v.(type) {
+	case string:
+		val.StringValue = &v
+	case bool:
+		val.BoolValue = &v
+	case int:
+		s := strconv.FormatInt(int64(v), 10)
+		val.IntValue = &s
+	case int32:
+		s := strconv.FormatInt(int64(v), 10)
+		val.IntValue = &s
+	case int64:
+		s := strconv.FormatInt(v, 10)
+		val.IntValue = &s
+	case float64:
+		val.DoubleValue = &v
+	default:
+		s := fmt.Sprint(v)
+		val.StringValue = &s
+	}
+	return otlpKeyValue{Key: key, Value: val}
+}
+
+func (e *OTLPExporter) ExportSpans(ctx context.Context, spans []SpanData) error {
+	out := make([]otlpSpan, 0, len(spans))
+	for _, s := range spans {
+		span := otlpSpan{
+			TraceID:           s.SpanContext.TraceID.String(),
+			SpanID:            s.SpanContext.SpanID.String(),
+			Name:              s.Name,
+			Kind:              s.Kind,
+			StartTimeUnixNano: strconv.FormatInt(s.Start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.End.UnixNano(), 10),
+			Status:            otlpStatus{Code: s.Status, Message: s.StatusMessage},
+		}
+		if s.Parent.IsValid() {
+			span.ParentSpanID = s.Parent.SpanID.String()
+		}
+		for key, v := range s.Attributes {
+			span.Attributes = append(span.Attributes, otlpAttr(key, v))
+		}
+		out = append(out, span)
+	}
+
+	body, err := json.Marshal(otlpRequest{
+		ResourceSpans: []otlpResourceSpans{{
+			Resource: otlpResource{Attributes: []otlpKeyValue{otlpAttr("service.name", e.serviceName)}},
+			ScopeSpans: []otlpScopeSpans{{
+				Scope: otlpScope{Name: "github.com/nickemp1996/chirpy/internal/tracing"},
+				Spans: out,
+			}},
+		}},
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, v := range e.headers {
+		req.Header.Set(key, v)
+	}
+
+	res, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	io.Copy(io.Discard, res.Body)
+
+	if res.StatusCode >= 300 {
+		return fmt.Errorf("otlp collector returned %s", res.Status)
+	}
+
+	return nil
+}
+
+func (e *OTLPExporter) Shutdown(ctx context.Context) error {
+	e.client.CloseIdleConnections()
+	return nil
+}
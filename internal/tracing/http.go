@@ -0,0 +1,76 @@
+package tracing
+
+import (
+	"net/http"
+	"strings"
+)
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	if r.status == 0 {
+		r.status = code
+	}
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	return r.ResponseWriter.Write(b)
+}
+
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// Middleware starts a server span for every request, continuing the trace
+// from an incoming traceparent header. The ServeMux sets the matched pattern
+// on the request it receives, so anything between this and the mux must pass
+// the request through unchanged or the span won't know its route.
+func (t *Tracer) Middleware(next http.Handler) http.Handler {
+	if t == nil {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		if sc, err := ParseTraceparent(r.Header.Get(TraceparentHeader)); err == nil {
+			ctx = ContextWithRemoteParent(ctx, sc)
+		}
+
+		ctx, span := t.Start(ctx, r.Method, WithKind(KindServer), WithAttributes(
+			"http.request.method", r.Method,
+			"url.path", r.URL.Path,
+			"user_agent.original", r.UserAgent(),
+		))
+		defer span.End()
+
+		// the mux sets Pattern on the request it receives, so hand it ours
+		r = r.WithContext(ctx)
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+
+		if r.Pattern != "" {
+			_, route, found := strings.Cut(r.Pattern, " ")
+			if !found {
+				route = r.Pattern
+			}
+			span.SetAttributes("http.route", route)
+			span.SetName(r.Method + " " + route)
+		}
+
+		span.SetAttributes("http.response.status_code", rec.status)
+		if rec.status >= 500 {
+			span.SetStatus(StatusError, http.StatusText(rec.status))
+		}
+	})
+}
@@ -0,0 +1,65 @@
+package tracing
+
+import (
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+const TraceparentHeader = "traceparent"
+
+var ErrInvalidTraceparent = errors.New("invalid traceparent")
+
+// ParseTraceparent reads a W3C trace context header of the form
+// 00-<trace id>-<parent span id>-<flags>.
+func ParseTraceparent(s string) (SpanContext, error) {
+	parts := strings.Split(strings.TrimSpace(s), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return SpanContext{}, ErrInvalidTraceparent
+	}
+
+	// version ff is forbidden, and version 00 has exactly four fields
+	if parts[0] == "ff" || (parts[0] == "00" && len(parts) != 4) {
+		return SpanContext{}, ErrInvalidTraceparent
+	}
+
+	var sc SpanContext
+	_, err := hex.Decode(sc.TraceID[:], []byte(parts[1]))
+	if err != nil {
+		return SpanContext{}, ErrInvalidTraceparent
+	}
+	_, err = hex.Decode(sc.SpanID[:], []byte(parts[2]))
+	if err != nil {
+		return SpanContext{}, ErrInvalidTraceparent
+	}
+	flags, err := hex.DecodeString(parts[3])
+	if err != nil {
+		return SpanContext{}, ErrInvalidTraceparent
+	}
+
+	if !sc.IsValid() {
+		return SpanContext{}, ErrInvalidTraceparent
+	}
+
+	sc.Sampled = flags[0]&0x01 == 1
+	sc.Remote = true
+
+	return sc, nil
+}
+
+func FormatTraceparent(sc SpanContext) string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return "00-" + sc.TraceID.String() + "-" + sc.SpanID.String() + "-" + flags
+}
+
+// Inject writes the span in ctx into outgoing request headers.
+func Inject(span *Span, h http.Header) {
+	sc := span.SpanContext()
+	if sc.IsValid() {
+		h.Set(TraceparentHeader, FormatTraceparent(sc))
+	}
+}
@@ -0,0 +1,341 @@
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+type TraceID [16]byte
+type SpanID [8]byte
+
+func (t TraceID) String() string { return hex.EncodeToString(t[:]) }
+func (s SpanID) String() string  { return hex.EncodeToString(s[:]) }
+func (t TraceID) IsValid() bool  { return t != TraceID{} }
+func (s SpanID) IsValid() bool   { return s != SpanID{} }
+
+// SpanContext identifies a span, either one of ours or a remote parent
+// received in a traceparent header.
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	Sampled bool
+	Remote  bool
+}
+
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID.IsValid() && sc.SpanID.IsValid()
+}
+
+type SpanKind int
+
+// values match the OTLP SpanKind enum
+const (
+	KindInternal SpanKind = 1
+	KindServer   SpanKind = 2
+	KindClient   SpanKind = 3
+)
+
+type StatusCode int
+
+const (
+	StatusUnset StatusCode = 0
+	StatusOK    StatusCode = 1
+	StatusError StatusCode = 2
+)
+
+// SpanData is the finished, immutable form of a span handed to exporters.
+type SpanData struct {
+	Name          string
+	Kind          SpanKind
+	SpanContext   SpanContext
+	Parent        SpanContext
+	Start         time.Time
+	End           time.Time
+	Attributes    map[string]any
+	Status        StatusCode
+	StatusMessage string
+}
+
+// Span is an operation being timed. A nil *Span is valid and does nothing,
+// which is what callers get when tracing is disabled.
+type Span struct {
+	tracer *Tracer
+	mu     sync.Mutex
+	data   SpanData
+	ended  bool
+}
+
+func (s *Span) SpanContext() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return s.data.SpanContext
+}
+
+func (s *Span) SetAttributes(kv ...any) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := 0; i+1 < len(kv); i += 2 {
+		key, ok := kv[i].(string)
+		if ok {
+			s.data.Attributes[key] = kv[i+1]
+		}
+	}
+}
+
+func (s *Span) SetName(name string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.Name = name
+}
+
+func (s *Span) SetStatus(code StatusCode, msg string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.Status = code
+	s.data.StatusMessage = msg
+}
+
+// RecordError marks the span as failed.
+func (s *Span) RecordError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.SetStatus(StatusError, err.Error())
+}
+
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.data.End = time.Now()
+	data := s.data
+	s.mu.Unlock()
+
+	if !data.SpanContext.Sampled {
+		return
+	}
+	s.tracer.enqueue(data)
+}
+
+type ctxKey struct{}
+
+func ContextWithSpan(ctx context.Context, span *Span) context.Context {
+	return context.WithValue(ctx, ctxKey{}, span)
+}
+
+func SpanFromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(ctxKey{}).(*Span)
+	return span
+}
+
+type remoteKey struct{}
+
+// ContextWithRemoteParent records a parent received from another service so
+// the next span started from ctx joins its trace.
+func ContextWithRemoteParent(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, remoteKey{}, sc)
+}
+
+func parentFromContext(ctx context.Context) SpanContext {
+	if span := SpanFromContext(ctx); span != nil {
+		return span.SpanContext()
+	}
+	sc, _ := ctx.Value(remoteKey{}).(SpanContext)
+	return sc
+}
+
+// Exporter ships finished spans somewhere.
+type Exporter interface {
+	ExportSpans(ctx context.Context, spans []SpanData) error
+	Shutdown(ctx context.Context) error
+}
+
+const (
+	batchSize     = 256
+	queueSize     = 4096
+	flushInterval = 5 * time.Second
+)
+
+// Tracer creates spans and exports them in batches from a background
+// goroutine. A nil *Tracer is valid and creates no spans.
+type Tracer struct {
+	exporter Exporter
+	queue    chan SpanData
+	flush    chan chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+func NewTracer(exporter Exporter) *Tracer {
+	t := &Tracer{
+		exporter: exporter,
+		queue:    make(chan SpanData, queueSize),
+		flush:    make(chan chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go t.run()
+	return t
+}
+
+type startOptions struct {
+	kind       SpanKind
+	onlyChild  bool
+	attributes []any
+}
+
+type StartOption func(*startOptions)
+
+func WithKind(kind SpanKind) StartOption {
+	return func(o *startOptions) { o.kind = kind }
+}
+
+func WithAttributes(kv ...any) StartOption {
+	return func(o *startOptions) { o.attributes = append(o.attributes, kv...) }
+}
+
+// OnlyIfParent skips the span unless ctx already carries one, so low level
+// operations outside any request don't each become a trace of their own.
+func OnlyIfParent() StartOption {
+	return func(o *startOptions) { o.onlyChild = true }
+}
+
+// Start begins a span as a child of whatever span ctx carries.
+func (t *Tracer) Start(ctx context.Context, name string, opts ...StartOption) (context.Context, *Span) {
+	if t == nil {
+		return ctx, nil
+	}
+
+	o := startOptions{kind: KindInternal}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	parent := parentFromContext(ctx)
+	if o.onlyChild && !parent.IsValid() {
+		return ctx, nil
+	}
+
+	// new traces are always sampled, children follow the caller's decision
+	sc := SpanContext{Sampled: true}
+	if parent.IsValid() {
+		sc.TraceID = parent.TraceID
+		sc.Sampled = parent.Sampled
+	} else {
+		rand.Read(sc.TraceID[:])
+	}
+	rand.Read(sc.SpanID[:])
+
+	span := &Span{
+		tracer: t,
+		data: SpanData{
+			Name:        name,
+			Kind:        o.kind,
+			SpanContext: sc,
+			Parent:      parent,
+			Start:       time.Now(),
+			Attributes:  map[string]any{},
+		},
+	}
+	span.SetAttributes(o.attributes...)
+
+	return ContextWithSpan(ctx, span), span
+}
+
+func (t *Tracer) enqueue(data SpanData) {
+	select {
+	case t.queue <- data:
+	default:
+		// dropping spans beats blocking requests when the exporter falls behind
+	}
+}
+
+func (t *Tracer) run() {
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	batch := make([]SpanData, 0, batchSize)
+	export := func() {
+		if len(batch) == 0 {
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		err := t.exporter.ExportSpans(ctx, batch)
+		cancel()
+		if err != nil {
+			slog.Warn("error exporting spans", "count", len(batch), "err", err)
+		}
+		batch = make([]SpanData, 0, batchSize)
+	}
+
+	for {
+		select {
+		case data := <-t.queue:
+			batch = append(batch, data)
+			if len(batch) >= batchSize {
+				export()
+			}
+		case <-ticker.C:
+			export()
+		case ack := <-t.flush:
+			for len(t.queue) > 0 {
+				batch = append(batch, <-t.queue)
+			}
+			export()
+			close(ack)
+		case <-t.done:
+			return
+		}
+	}
+}
+
+// ForceFlush exports every span ended so far.
+func (t *Tracer) ForceFlush(ctx context.Context) error {
+	if t == nil {
+		return nil
+	}
+	ack := make(chan struct{})
+	select {
+	case t.flush <- ack:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case <-ack:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Shutdown flushes pending spans and closes the exporter.
+func (t *Tracer) Shutdown(ctx context.Context) error {
+	if t == nil {
+		return nil
+	}
+	err := t.ForceFlush(ctx)
+	t.stopOnce.Do(func() { close(t.done) })
+	if err != nil {
+		return err
+	}
+	return t.exporter.Shutdown(ctx)
+}
@@ -0,0 +1,234 @@
+package tracing
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type memExporter struct {
+	mu    sync.Mutex
+	spans []SpanData
+}
+
+func (e *memExporter) ExportSpans(ctx context.Context, spans []SpanData) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = append(e.spans, spans...)
+	return nil
+}
+
+func (e *memExporter) Shutdown(ctx context.Context) error { return nil }
+
+func (e *memExporter) byName(name string) (SpanData, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, s := range e.spans {
+		if s.Name == name {
+			return s, true
+		}
+	}
+	return SpanData{}, false
+}
+
+func TestTraceparentRoundTrip(t *testing.T) {
+	header := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+	sc, err := ParseTraceparent(header)
+	if err != nil {
+		t.Fatalf("Error parsing traceparent: %v", err)
+	}
+	if !sc.Sampled || !sc.Remote {
+		t.Errorf("Parsed span context should be sampled and remote: %+v", sc)
+	}
+	if got := FormatTraceparent(sc); got != header {
+		t.Errorf("Round trip should give %q, got %q", header, got)
+	}
+
+	invalid := []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e473z-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+	}
+	for _, h := range invalid {
+		_, err := ParseTraceparent(h)
+		if err == nil {
+			t.Errorf("Traceparent %q should be rejected", h)
+		}
+	}
+}
+
+type fakeResult struct{}
+
+func (fakeResult) LastInsertId() (int64, error) { return 0, nil }
+func (fakeResult) RowsAffected() (int64, error) { return 3, nil }
+
+type fakeDB struct{ ctx context.Context }
+
+func (f *fakeDB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	f.ctx = ctx
+	return driver.Result(fakeResult{}), nil
+}
+
+func (f *fakeDB) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	return nil, nil
+}
+
+func (f *fakeDB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return nil, nil
+}
+
+func (f *fakeDB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return nil
+}
+
+func TestMiddlewareContinuesTraceAndWrapsQueries(t *testing.T) {
+	exporter := &memExporter{}
+	tracer := NewTracer(exporter)
+	db := &fakeDB{}
+	traced := tracer.WrapDB(db)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("DELETE /api/chirps/{chirpID}", func(w http.ResponseWriter, r *http.Request) {
+		traced.ExecContext(r.Context(), "-- name: DeleteChirp :exec\nDELETE FROM chirps WHERE id = $1")
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	req := httptest.NewRequest("DELETE", "/api/chirps/123", nil)
+	req.Header.Set(TraceparentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	tracer.Middleware(mux).ServeHTTP(httptest.NewRecorder(), req)
+	queryCtx := db.ctx
+
+	// outside a request there is no parent, so no span
+	traced.ExecContext(context.Background(), "-- name: ResetUsers :exec\nDELETE FROM users")
+
+	err := tracer.Shutdown(context.Background())
+	if err != nil {
+		t.Fatalf("Error shutting down tracer: %v", err)
+	}
+
+	server, ok := exporter.byName("DELETE /api/chirps/{chirpID}")
+	if !ok {
+		t.Fatalf("Server span should be named after the route, got %+v", exporter.spans)
+	}
+	if server.SpanContext.TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("Server span should continue the incoming trace, got %s", server.SpanContext.TraceID)
+	}
+	if server.Parent.SpanID.String() != "00f067aa0ba902b7" {
+		t.Errorf("Server span parent should be the remote span, got %s", server.Parent.SpanID)
+	}
+	if server.Attributes["http.response.status_code"] != http.StatusNoContent {
+		t.Errorf("Server span should record the status, got %v", server.Attributes["http.response.status_code"])
+	}
+
+	query, ok := exporter.byName("db DeleteChirp")
+	if !ok {
+		t.Fatalf("Query span should be named after the sqlc query, got %+v", exporter.spans)
+	}
+	if query.Parent.SpanID != server.SpanContext.SpanID {
+		t.Errorf("Query span should be a child of the server span")
+	}
+	if query.Attributes["db.rows_affected"] != int64(3) {
+		t.Errorf("Query span should record rows affected, got %v", query.Attributes["db.rows_affected"])
+	}
+	if SpanFromContext(queryCtx) == nil {
+		t.Errorf("The wrapped DBTX should receive a context carrying the query span")
+	}
+
+	if _, ok := exporter.byName("db ResetUsers"); ok {
+		t.Errorf("Queries without a parent span should not be traced")
+	}
+}
+
+func TestUnsampledParentIsNotRecorded(t *testing.T) {
+	exporter := &memExporter{}
+	tracer := NewTracer(exporter)
+
+	var forwarded string
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/healthz", func(w http.ResponseWriter, r *http.Request) {
+		_, span := tracer.Start(r.Context(), "work")
+		forwarded = FormatTraceparent(span.SpanContext())
+		span.End()
+	})
+
+	req := httptest.NewRequest("GET", "/api/healthz", nil)
+	req.Header.Set(TraceparentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+	tracer.Middleware(mux).ServeHTTP(httptest.NewRecorder(), req)
+
+	err := tracer.Shutdown(context.Background())
+	if err != nil {
+		t.Fatalf("Error shutting down tracer: %v", err)
+	}
+
+	if len(exporter.spans) != 0 {
+		t.Errorf("Spans under an unsampled parent should not be exported, got %+v", exporter.spans)
+	}
+	if !strings.HasSuffix(forwarded, "-00") {
+		t.Errorf("The unsampled flag should be forwarded, got %q", forwarded)
+	}
+}
+
+func TestNilTracerIsNoop(t *testing.T) {
+	var tracer *Tracer
+	db := &fakeDB{}
+
+	ctx, span := tracer.Start(context.Background(), "nothing")
+	span.SetAttributes("key", "value")
+	span.End()
+
+	if SpanFromContext(ctx) != nil {
+		t.Errorf("A nil tracer should not put spans in the context")
+	}
+	if tracer.WrapDB(db) != DBTX(db) {
+		t.Errorf("A nil tracer should return the DBTX unwrapped")
+	}
+}
+
+func TestOTLPExporterPostsJSON(t *testing.T) {
+	var body map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("OTLP export should be JSON, got %q", r.Header.Get("Content-Type"))
+		}
+		data, _ := io.ReadAll(r.Body)
+		json.Unmarshal(data, &body)
+	}))
+	defer srv.Close()
+
+	tracer := NewTracer(NewOTLPExporter(srv.URL+"/v1/traces", "chirpy-test", nil))
+	_, span := tracer.Start(context.Background(), "work", WithAttributes("count", 2))
+	span.End()
+
+	err := tracer.Shutdown(context.Background())
+	if err != nil {
+		t.Fatalf("Error shutting down tracer: %v", err)
+	}
+
+	resourceSpans, _ := body["resourceSpans"].([]any)
+	if len(resourceSpans) != 1 {
+		t.Fatalf("Expected one resourceSpans entry, got %v", body)
+	}
+	scopeSpans := resourceSpans[0].(map[string]any)["scopeSpans"].([]any)
+	spans := scopeSpans[0].(map[string]any)["spans"].([]any)
+	got := spans[0].(map[string]any)
+
+	if got["name"] != "work" || len(got["traceId"].(string)) != 32 || len(got["spanId"].(string)) != 16 {
+		t.Errorf("Unexpected span encoding: %v", got)
+	}
+	attr := got["attributes"].([]any)[0].(map[string]any)
+	if attr["value"].(map[string]any)["intValue"] != "2" {
+		t.Errorf("Int attributes should be encoded as strings, got %v", attr)
+	}
+}
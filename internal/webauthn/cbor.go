@@ -0,0 +1,136 @@
+package webauthn
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// maxCBORDepth bounds nesting, so a hostile attestation can't exhaust the
+// stack. Attestation objects and COSE keys are at most three levels deep.
+const maxCBORDepth = 8
+
+var errCBOR = errors.New("malformed cbor")
+
+// decodeCBOR decodes the first CBOR item in data and returns the bytes after
+// it. It covers the subset WebAuthn uses: integers, byte and text strings,
+// arrays, maps and the simple values false, true and null. Integers come
+// back as int64, maps as map[any]any keyed by int64 or string.
+func decodeCBOR(data []byte) (any, []byte, error) {
+	return decodeItem(data, 0)
+}
+
+func decodeItem(data []byte, depth int) (any, []byte, error) {
+	if depth > maxCBORDepth {
+		return nil, nil, fmt.Errorf("%w: nested too deeply", errCBOR)
+	}
+	if len(data) == 0 {
+		return nil, nil, fmt.Errorf("%w: unexpected end", errCBOR)
+	}
+
+	major, info := data[0]>>5, data[0]&0x1f
+	data = data[1:]
+
+	if major == 7 {
+		switch info {
+		case 20:
+			return false, data, nil
+		case 21:
+			return true, data, nil
+		case 22:
+			return nil, data, nil
+		default:
+			return nil, nil, fmt.Errorf("%w: unsupported simple value %d", errCBOR, info)
+		}
+	}
+
+	arg, data, err := decodeArgument(info, data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	switch major {
+	case 0:
+		if arg > 1<<63-1 {
+			return nil, nil, fmt.Errorf("%w: integer overflows", errCBOR)
+		}
+		return int64(arg), data, nil
+	case 1:
+		if arg > 1<<63-1 {
+			return nil, nil, fmt.Errorf("%w: integer overflows", errCBOR)
+		}
+		return -1 - int64(arg), data, nil
+	case 2, 3:
+		if arg > uint64(len(data)) {
+			return nil, nil, fmt.Errorf("%w: string runs past the end", errCBOR)
+		}
+		if major == 2 {
+			return data[:arg], data[arg:], nil
+		}
+		return string(data[:arg]), data[arg:], nil
+	case 4:
+		// every item takes at least a byte, which also bounds allocation
+		if arg > uint64(len(data)) {
+			return nil, nil, fmt.Errorf("%w: array runs past the end", errCBOR)
+		}
+		items := make([]any, 0, arg)
+		for range arg {
+			var item any
+			item, data, err = decodeItem(data, depth+1)
+			if err != nil {
+				return nil, nil, err
+			}
+			items = append(items, item)
+		}
+		return items, data, nil
+	case 5:
+		if arg > uint64(len(data))/2 {
+			return nil, nil, fmt.Errorf("%w: map runs past the end", errCBOR)
+		}
+		m := make(map[any]any, arg)
+		for range arg {
+			var key, value any
+			key, data, err = decodeItem(data, depth+1)
+			if err != nil {
+				return nil, nil, err
+			}
+			switch key.(type) {
+			case int64, string:
+			default:
+				return nil, nil, fmt.Errorf("%w: unsupported map key %T", errCBOR, key)
+			}
+			if _, dup := m[key]; dup {
+				return nil, nil, fmt.Errorf("%w: duplicate map key %v", errCBOR, key)
+			}
+			value, data, err = decodeItem(data, depth+1)
+			if err != nil {
+				return nil, nil, err
+			}
+			m[key] = value
+		}
+		return m, data, nil
+	default:
+		return nil, nil, fmt.Errorf("%w: unsupported major type %d", errCBOR, major)
+	}
+}
+
+// decodeArgument reads the length or value that follows an item's first
+// byte. Indefinite lengths aren't allowed in WebAuthn's canonical CBOR.
+func decodeArgument(info byte, data []byte) (uint64, []byte, error) {
+	switch {
+	case info < 24:
+		return uint64(info), data, nil
+	case info == 24 && len(data) >= 1:
+		return uint64(data[0]), data[1:], nil
+	case info == 25 && len(data) >= 2:
+		return uint64(binary.BigEndian.Uint16(data)), data[2:], nil
+	case info == 26 && len(data) >= 4:
+		return uint64(binary.BigEndian.Uint32(data)), data[4:], nil
+	case info == 27 && len(data) >= 8:
+		return binary.BigEndian.Uint64(data), data[8:], nil
+	case info > 27:
+		return 0, nil, fmt.Errorf("%w: unsupported length encoding %d", errCBOR, info)
+	default:
+		return 0, nil, fmt.Errorf("%w: unexpected end", errCBOR)
+	}
+}
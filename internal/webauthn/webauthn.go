@@ -0,0 +1,358 @@
+// Package webauthn verifies passkey registrations and sign ins. It covers
+// what a relying party needs for passkeys and nothing more: "none"
+// attestation, ES256 and RS256 credential keys, and the signature counter.
+package webauthn
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// COSE algorithm ids for the keys we accept, most preferred first.
+const (
+	AlgES256 = -7
+	AlgRS256 = -257
+)
+
+var Algorithms = []int{AlgES256, AlgRS256}
+
+// authenticator data flags
+const (
+	flagUserPresent  = 0x01
+	flagUserVerified = 0x04
+	flagAttested     = 0x40
+)
+
+var (
+	ErrInvalid = errors.New("invalid webauthn response")
+	// ErrCloned means the signature counter went backwards, so two copies
+	// of the credential exist and one of them isn't the user's.
+	ErrCloned = errors.New("credential signature counter went backwards")
+)
+
+// RelyingParty is the site passkeys are registered to. ID is its domain and
+// Origin the exact origin pages run on, e.g. https://chirpy.example.
+type RelyingParty struct {
+	ID     string
+	Name   string
+	Origin string
+}
+
+// Credential is a newly registered passkey. PublicKey is the COSE key as the
+// authenticator sent it, ready to store and hand back to VerifyAssertion.
+type Credential struct {
+	ID        []byte
+	PublicKey []byte
+	SignCount uint32
+}
+
+type ClientData struct {
+	Type        string `json:"type"`
+	Challenge   string `json:"challenge"`
+	Origin      string `json:"origin"`
+	CrossOrigin bool   `json:"crossOrigin"`
+}
+
+// Base64URL is binary data that travels in JSON as unpadded base64url, the
+// encoding browsers' PublicKeyCredential toJSON() uses.
+type Base64URL []byte
+
+func (b Base64URL) MarshalJSON() ([]byte, error) {
+	return json.Marshal(base64.RawURLEncoding.EncodeToString(b))
+}
+
+func (b *Base64URL) UnmarshalJSON(data []byte) error {
+	var s string
+	err := json.Unmarshal(data, &s)
+	if err != nil {
+		return err
+	}
+	// some libraries pad, which is harmless
+	decoded, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+	if err != nil {
+		return fmt.Errorf("%w: not base64url: %w", ErrInvalid, err)
+	}
+	*b = decoded
+	return nil
+}
+
+// A challenge is 16 random bytes, when it expires as unix seconds, and an
+// HMAC over both and what it was issued for.
+const (
+	challengeNonceSize = 16
+	challengeBodySize  = challengeNonceSize + 8
+	challengeSize      = challengeBodySize + sha256.Size
+)
+
+// SignChallenge returns a random challenge that carries its own expiry and
+// is signed with key for binding, e.g. a ceremony and user, so it needn't be
+// stored when issued. It is base64url encoded as browsers echo it back in
+// the client data.
+func SignChallenge(key []byte, binding string, expiresAt time.Time) (string, error) {
+	b := make([]byte, challengeNonceSize, challengeSize)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	b = binary.BigEndian.AppendUint64(b, uint64(expiresAt.Unix()))
+	b = append(b, challengeMAC(key, binding, b)...)
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// CheckChallenge verifies challenge was made by SignChallenge with the same
+// key and binding and hasn't expired, and returns when it expires. It can't
+// tell whether the challenge was used before; the caller has to record that.
+func CheckChallenge(key []byte, binding, challenge string, now time.Time) (time.Time, error) {
+	b, err := base64.RawURLEncoding.DecodeString(challenge)
+	if err != nil || len(b) != challengeSize {
+		return time.Time{}, fmt.Errorf("%w: malformed challenge", ErrInvalid)
+	}
+	body, sum := b[:challengeBodySize], b[challengeBodySize:]
+	if !hmac.Equal(sum, challengeMAC(key, binding, body)) {
+		return time.Time{}, fmt.Errorf("%w: challenge was not issued for this", ErrInvalid)
+	}
+
+	expiresAt := time.Unix(int64(binary.BigEndian.Uint64(body[challengeNonceSize:])), 0)
+	if !now.Before(expiresAt) {
+		return time.Time{}, fmt.Errorf("%w: challenge expired", ErrInvalid)
+	}
+	return expiresAt, nil
+}
+
+func challengeMAC(key []byte, binding string, body []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(binding))
+	mac.Write([]byte{0})
+	mac.Write(body)
+	return mac.Sum(nil)
+}
+
+// ParseClientData decodes clientDataJSON, mostly so the caller can find the
+// challenge it was answering before verifying anything.
+func ParseClientData(raw []byte) (ClientData, error) {
+	cd := ClientData{}
+	err := json.Unmarshal(raw, &cd)
+	if err != nil {
+		return cd, fmt.Errorf("%w: client data: %w", ErrInvalid, err)
+	}
+	return cd, nil
+}
+
+func (rp RelyingParty) checkClientData(raw []byte, ceremony, challenge string) error {
+	cd, err := ParseClientData(raw)
+	if err != nil {
+		return err
+	}
+	if cd.Type != ceremony {
+		return fmt.Errorf("%w: client data type is %q", ErrInvalid, cd.Type)
+	}
+	if challenge == "" || cd.Challenge != challenge {
+		return fmt.Errorf("%w: challenge does not match", ErrInvalid)
+	}
+	if cd.Origin != rp.Origin || cd.CrossOrigin {
+		return fmt.Errorf("%w: origin %q is not %q", ErrInvalid, cd.Origin, rp.Origin)
+	}
+	return nil
+}
+
+type authenticatorData struct {
+	rpIDHash  []byte
+	flags     byte
+	signCount uint32
+	// set when flagAttested is
+	credentialID []byte
+	publicKey    []byte
+}
+
+func parseAuthenticatorData(data []byte) (authenticatorData, error) {
+	ad := authenticatorData{}
+	if len(data) < 37 {
+		return ad, fmt.Errorf("%w: authenticator data too short", ErrInvalid)
+	}
+	ad.rpIDHash = data[:32]
+	ad.flags = data[32]
+	ad.signCount = binary.BigEndian.Uint32(data[33:37])
+
+	if ad.flags&flagAttested == 0 {
+		return ad, nil
+	}
+
+	rest := data[37:]
+	// 16 byte AAGUID, then the credential id's length
+	if len(rest) < 18 {
+		return ad, fmt.Errorf("%w: attested credential data too short", ErrInvalid)
+	}
+	idLen := int(binary.BigEndian.Uint16(rest[16:18]))
+	rest = rest[18:]
+	if idLen == 0 || idLen > 1023 || len(rest) < idLen {
+		return ad, fmt.Errorf("%w: bad credential id length", ErrInvalid)
+	}
+	ad.credentialID = rest[:idLen]
+	rest = rest[idLen:]
+
+	_, after, err := decodeCBOR(rest)
+	if err != nil {
+		return ad, fmt.Errorf("%w: credential public key: %w", ErrInvalid, err)
+	}
+	ad.publicKey = rest[:len(rest)-len(after)]
+
+	return ad, nil
+}
+
+// checkAuthenticatorData requires the user to have been verified, by PIN or
+// biometrics, since a passkey stands in for the password.
+func (rp RelyingParty) checkAuthenticatorData(ad authenticatorData) error {
+	rpIDHash := sha256.Sum256([]byte(rp.ID))
+	if !bytes.Equal(ad.rpIDHash, rpIDHash[:]) {
+		return fmt.Errorf("%w: credential is for another site", ErrInvalid)
+	}
+	if ad.flags&flagUserPresent == 0 || ad.flags&flagUserVerified == 0 {
+		return fmt.Errorf("%w: user was not verified", ErrInvalid)
+	}
+	return nil
+}
+
+// VerifyRegistration checks the response to navigator.credentials.create().
+// Attestation isn't verified, we ask for none and only need the key.
+func (rp RelyingParty) VerifyRegistration(clientDataJSON, attestationObject []byte, challenge string) (Credential, error) {
+	err := rp.checkClientData(clientDataJSON, "webauthn.create", challenge)
+	if err != nil {
+		return Credential{}, err
+	}
+
+	item, _, err := decodeCBOR(attestationObject)
+	if err != nil {
+		return Credential{}, fmt.Errorf("%w: attestation object: %w", ErrInvalid, err)
+	}
+	obj, ok := item.(map[any]any)
+	if !ok {
+		return Credential{}, fmt.Errorf("%w: attestation object is not a map", ErrInvalid)
+	}
+	rawAuthData, ok := obj["authData"].([]byte)
+	if !ok {
+		return Credential{}, fmt.Errorf("%w: attestation object has no authData", ErrInvalid)
+	}
+
+	ad, err := parseAuthenticatorData(rawAuthData)
+	if err != nil {
+		return Credential{}, err
+	}
+	err = rp.checkAuthenticatorData(ad)
+	if err != nil {
+		return Credential{}, err
+	}
+	if ad.credentialID == nil {
+		return Credential{}, fmt.Errorf("%w: no attested credential", ErrInvalid)
+	}
+
+	_, err = ParsePublicKey(ad.publicKey)
+	if err != nil {
+		return Credential{}, err
+	}
+
+	return Credential{
+		ID:        bytes.Clone(ad.credentialID),
+		PublicKey: bytes.Clone(ad.publicKey),
+		SignCount: ad.signCount,
+	}, nil
+}
+
+// VerifyAssertion checks the response to navigator.credentials.get() against
+// a stored credential and returns the counter to store.
+func (rp RelyingParty) VerifyAssertion(clientDataJSON, authenticatorDataRaw, sig []byte, challenge string, publicKey []byte, storedCount uint32) (uint32, error) {
+	err := rp.checkClientData(clientDataJSON, "webauthn.get", challenge)
+	if err != nil {
+		return 0, err
+	}
+
+	ad, err := parseAuthenticatorData(authenticatorDataRaw)
+	if err != nil {
+		return 0, err
+	}
+	err = rp.checkAuthenticatorData(ad)
+	if err != nil {
+		return 0, err
+	}
+
+	key, err := ParsePublicKey(publicKey)
+	if err != nil {
+		return 0, err
+	}
+
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	digest := sha256.Sum256(append(bytes.Clone(authenticatorDataRaw), clientDataHash[:]...))
+
+	switch key := key.(type) {
+	case *ecdsa.PublicKey:
+		if !ecdsa.VerifyASN1(key, digest[:], sig) {
+			return 0, fmt.Errorf("%w: bad signature", ErrInvalid)
+		}
+	case *rsa.PublicKey:
+		if rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], sig) != nil {
+			return 0, fmt.Errorf("%w: bad signature", ErrInvalid)
+		}
+	}
+
+	// authenticators without a counter always send 0, which is fine; once
+	// one has counted it must keep going up
+	if (ad.signCount != 0 || storedCount != 0) && ad.signCount <= storedCount {
+		return 0, ErrCloned
+	}
+
+	return ad.signCount, nil
+}
+
+// ParsePublicKey decodes a COSE_Key, accepting only the algorithms we
+// advertise.
+func ParsePublicKey(cose []byte) (crypto.PublicKey, error) {
+	item, _, err := decodeCBOR(cose)
+	if err != nil {
+		return nil, fmt.Errorf("%w: public key: %w", ErrInvalid, err)
+	}
+	m, ok := item.(map[any]any)
+	if !ok {
+		return nil, fmt.Errorf("%w: public key is not a map", ErrInvalid)
+	}
+
+	kty, _ := m[int64(1)].(int64)
+	alg, _ := m[int64(3)].(int64)
+
+	switch {
+	case kty == 2 && alg == AlgES256:
+		crv, _ := m[int64(-1)].(int64)
+		x, _ := m[int64(-2)].([]byte)
+		y, _ := m[int64(-3)].([]byte)
+		if crv != 1 || len(x) != 32 || len(y) != 32 {
+			return nil, fmt.Errorf("%w: bad P-256 key", ErrInvalid)
+		}
+		key := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !key.Curve.IsOnCurve(key.X, key.Y) {
+			return nil, fmt.Errorf("%w: point is not on the curve", ErrInvalid)
+		}
+		return key, nil
+	case kty == 3 && alg == AlgRS256:
+		n, _ := m[int64(-1)].([]byte)
+		e, _ := m[int64(-2)].([]byte)
+		if len(n) < 256 || len(e) == 0 || len(e) > 4 {
+			return nil, fmt.Errorf("%w: bad RSA key", ErrInvalid)
+		}
+		exponent := new(big.Int).SetBytes(e)
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}, nil
+	default:
+		return nil, fmt.Errorf("%w: unsupported key type %d with algorithm %d", ErrInvalid, kty, alg)
+	}
+}
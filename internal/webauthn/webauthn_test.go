@@ -0,0 +1,328 @@
+package webauthn
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+// cborMap keeps its pairs in order, so test encodings are deterministic.
+type cborMap [][2]any
+
+func encodeHead(major byte, n uint64) []byte {
+	switch {
+	case n < 24:
+		return []byte{major<<5 | byte(n)}
+	case n < 1<<8:
+		return []byte{major<<5 | 24, byte(n)}
+	case n < 1<<16:
+		return binary.BigEndian.AppendUint16([]byte{major<<5 | 25}, uint16(n))
+	default:
+		return binary.BigEndian.AppendUint32([]byte{major<<5 | 26}, uint32(n))
+	}
+}
+
+func encodeCBOR(v any) []byte {
+	switch v := v.(type) {
+	case int:
+		if v < 0 {
+			return encodeHead(1, uint64(-1-v))
+		}
+		return encodeHead(0, uint64(v))
+	case []byte:
+		return append(encodeHead(2, uint64(len(v))), v...)
+	case string:
+		return append(encodeHead(3, uint64(len(v))), v...)
+	case bool:
+		if v {
+			return []byte{0xf5}
+		}
+		return []byte{0xf4}
+	case []any:
+		out := encodeHead(4, uint64(len(v)))
+		for _, item := range v {
+			out = append(out, encodeCBOR(item)...)
+		}
+		return out
+	case cborMap:
+		out := encodeHead(5, uint64(len(v)))
+		for _, pair := range v {
+			out = append(out, encodeCBOR(pair[0])...)
+			out = append(out, encodeCBOR(pair[1])...)
+		}
+		return out
+	}
+	panic("unsupported type")
+}
+
+func TestDecodeCBOR(t *testing.T) {
+	data := encodeCBOR(cborMap{
+		{1, 2},
+		{-7, "text"},
+		{"bytes", []byte{1, 2, 3}},
+		{"list", []any{500, -70000, true}},
+	})
+
+	item, rest, err := decodeCBOR(append(data, 0xff))
+	if err != nil {
+		t.Fatalf("Error decoding: %v", err)
+	}
+	if len(rest) != 1 || rest[0] != 0xff {
+		t.Errorf("Expected the trailing byte back, got %x", rest)
+	}
+
+	m := item.(map[any]any)
+	if m[int64(1)] != int64(2) || m[int64(-7)] != "text" || string(m["bytes"].([]byte)) != "\x01\x02\x03" {
+		t.Errorf("Unexpected map %v", m)
+	}
+	list := m["list"].([]any)
+	if list[0] != int64(500) || list[1] != int64(-70000) || list[2] != true {
+		t.Errorf("Unexpected list %v", list)
+	}
+
+	bad := map[string][]byte{
+		"truncated string":  {0x45, 1, 2},
+		"huge array":        {0x9b, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff},
+		"indefinite length": {0x5f},
+		"float":             {0xfa, 0, 0, 0, 0},
+		"duplicate key":     encodeCBOR(cborMap{{1, 1}, {1, 2}}),
+		"too deep":          {0x81, 0x81, 0x81, 0x81, 0x81, 0x81, 0x81, 0x81, 0x81, 0x81, 0},
+	}
+	for name, data := range bad {
+		_, _, err := decodeCBOR(data)
+		if !errors.Is(err, errCBOR) {
+			t.Errorf("%s: expected errCBOR, got %v", name, err)
+		}
+	}
+}
+
+// authenticator plays a passkey with an ES256 key.
+type authenticator struct {
+	t     *testing.T
+	key   *ecdsa.PrivateKey
+	id    []byte
+	count uint32
+	flags byte
+}
+
+func newAuthenticator(t *testing.T) *authenticator {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Error generating key: %v", err)
+	}
+	return &authenticator{t: t, key: key, id: []byte("credential-1"), flags: flagUserPresent | flagUserVerified}
+}
+
+func (a *authenticator) coseKey() []byte {
+	x := a.key.X.FillBytes(make([]byte, 32))
+	y := a.key.Y.FillBytes(make([]byte, 32))
+	return encodeCBOR(cborMap{{1, 2}, {3, AlgES256}, {-1, 1}, {-2, x}, {-3, y}})
+}
+
+func (a *authenticator) authData(rpID string, attested bool) []byte {
+	hash := sha256.Sum256([]byte(rpID))
+	out := append(hash[:], a.flags)
+	out = binary.BigEndian.AppendUint32(out, a.count)
+	if attested {
+		out[32] |= flagAttested
+		out = append(out, make([]byte, 16)...)
+		out = binary.BigEndian.AppendUint16(out, uint16(len(a.id)))
+		out = append(out, a.id...)
+		out = append(out, a.coseKey()...)
+	}
+	return out
+}
+
+func clientData(typ, challenge, origin string) []byte {
+	data, _ := json.Marshal(ClientData{Type: typ, Challenge: challenge, Origin: origin})
+	return data
+}
+
+func (a *authenticator) create(rpID, challenge, origin string) ([]byte, []byte) {
+	attestation := encodeCBOR(cborMap{
+		{"fmt", "none"},
+		{"attStmt", cborMap{}},
+		{"authData", a.authData(rpID, true)},
+	})
+	return clientData("webauthn.create", challenge, origin), attestation
+}
+
+func (a *authenticator) get(rpID, challenge, origin string) ([]byte, []byte, []byte) {
+	cd := clientData("webauthn.get", challenge, origin)
+	ad := a.authData(rpID, false)
+
+	cdHash := sha256.Sum256(cd)
+	digest := sha256.Sum256(append(append([]byte{}, ad...), cdHash[:]...))
+	sig, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	if err != nil {
+		a.t.Fatalf("Error signing: %v", err)
+	}
+	return cd, ad, sig
+}
+
+var testRP = RelyingParty{ID: "chirpy.example", Name: "Chirpy", Origin: "https://chirpy.example"}
+
+func TestRegistration(t *testing.T) {
+	a := newAuthenticator(t)
+
+	cd, att := a.create("chirpy.example", "challenge-1", "https://chirpy.example")
+	cred, err := testRP.VerifyRegistration(cd, att, "challenge-1")
+	if err != nil {
+		t.Fatalf("Error verifying registration: %v", err)
+	}
+	if string(cred.ID) != "credential-1" || string(cred.PublicKey) != string(a.coseKey()) {
+		t.Errorf("Unexpected credential %+v", cred)
+	}
+
+	cases := map[string]func() ([]byte, []byte){
+		"wrong challenge": func() ([]byte, []byte) { return a.create("chirpy.example", "challenge-2", "https://chirpy.example") },
+		"wrong origin":    func() ([]byte, []byte) { return a.create("chirpy.example", "challenge-1", "https://evil.example") },
+		"wrong rp":        func() ([]byte, []byte) { return a.create("evil.example", "challenge-1", "https://chirpy.example") },
+		"not verified": func() ([]byte, []byte) {
+			a.flags = flagUserPresent
+			defer func() { a.flags = flagUserPresent | flagUserVerified }()
+			return a.create("chirpy.example", "challenge-1", "https://chirpy.example")
+		},
+		"assertion type": func() ([]byte, []byte) {
+			_, att := a.create("chirpy.example", "challenge-1", "https://chirpy.example")
+			return clientData("webauthn.get", "challenge-1", "https://chirpy.example"), att
+		},
+	}
+	for name, build := range cases {
+		cd, att := build()
+		_, err := testRP.VerifyRegistration(cd, att, "challenge-1")
+		if !errors.Is(err, ErrInvalid) {
+			t.Errorf("%s: expected ErrInvalid, got %v", name, err)
+		}
+	}
+}
+
+func TestAssertion(t *testing.T) {
+	a := newAuthenticator(t)
+	a.count = 5
+
+	cd, ad, sig := a.get("chirpy.example", "challenge-1", "https://chirpy.example")
+	count, err := testRP.VerifyAssertion(cd, ad, sig, "challenge-1", a.coseKey(), 4)
+	if err != nil {
+		t.Fatalf("Error verifying assertion: %v", err)
+	}
+	if count != 5 {
+		t.Errorf("Expected counter 5, got %d", count)
+	}
+
+	_, err = testRP.VerifyAssertion(cd, ad, sig, "challenge-1", a.coseKey(), 5)
+	if !errors.Is(err, ErrCloned) {
+		t.Errorf("A counter that didn't go up should be refused, got %v", err)
+	}
+
+	sig[len(sig)-1] ^= 1
+	_, err = testRP.VerifyAssertion(cd, ad, sig, "challenge-1", a.coseKey(), 4)
+	if !errors.Is(err, ErrInvalid) {
+		t.Errorf("A bad signature should be refused, got %v", err)
+	}
+
+	other := newAuthenticator(t)
+	cd, ad, sig = other.get("chirpy.example", "challenge-1", "https://chirpy.example")
+	_, err = testRP.VerifyAssertion(cd, ad, sig, "challenge-1", a.coseKey(), 0)
+	if !errors.Is(err, ErrInvalid) {
+		t.Errorf("Another key's signature should be refused, got %v", err)
+	}
+
+	// authenticators without a counter always send 0
+	a.count = 0
+	cd, ad, sig = a.get("chirpy.example", "challenge-1", "https://chirpy.example")
+	_, err = testRP.VerifyAssertion(cd, ad, sig, "challenge-1", a.coseKey(), 0)
+	if err != nil {
+		t.Errorf("A zero counter should be accepted: %v", err)
+	}
+}
+
+func TestParsePublicKeyRejectsUnknownAlgorithms(t *testing.T) {
+	// an Ed25519 OKP key, which we don't advertise
+	key := encodeCBOR(cborMap{{1, 1}, {3, -8}, {-1, 6}, {-2, make([]byte, 32)}})
+	_, err := ParsePublicKey(key)
+	if !errors.Is(err, ErrInvalid) {
+		t.Errorf("Expected ErrInvalid, got %v", err)
+	}
+
+	// a P-256 key whose point is off the curve
+	key = encodeCBOR(cborMap{{1, 2}, {3, AlgES256}, {-1, 1}, {-2, make([]byte, 32)}, {-3, make([]byte, 32)}})
+	_, err = ParsePublicKey(key)
+	if !errors.Is(err, ErrInvalid) {
+		t.Errorf("Expected ErrInvalid, got %v", err)
+	}
+}
+
+func TestBase64URL(t *testing.T) {
+	var v struct {
+		ID Base64URL `json:"id"`
+	}
+	for _, in := range []string{`{"id":"-_8"}`, `{"id":"-_8="}`} {
+		err := json.Unmarshal([]byte(in), &v)
+		if err != nil || string(v.ID) != "\xfb\xff" {
+			t.Errorf("Unexpected decoding of %s: %x, %v", in, v.ID, err)
+		}
+	}
+
+	out, _ := json.Marshal(v)
+	if string(out) != `{"id":"-_8"}` {
+		t.Errorf("Unexpected encoding %s", out)
+	}
+
+	if json.Unmarshal([]byte(`{"id":"a+b/"}`), &v) == nil {
+		t.Errorf("Standard base64 should be refused")
+	}
+}
+
+func TestChallenge(t *testing.T) {
+	key := []byte("challenge-key")
+	now := time.Now()
+
+	challenge, err := SignChallenge(key, "registration:alice", now.Add(time.Minute))
+	if err != nil {
+		t.Fatalf("Error signing challenge: %v", err)
+	}
+
+	expiresAt, err := CheckChallenge(key, "registration:alice", challenge, now)
+	if err != nil {
+		t.Fatalf("Error checking challenge: %v", err)
+	}
+	if expiresAt.Unix() != now.Add(time.Minute).Unix() {
+		t.Errorf("Unexpected expiry %v", expiresAt)
+	}
+
+	other, _ := SignChallenge(key, "registration:alice", now.Add(time.Minute))
+	if other == challenge {
+		t.Errorf("Challenges should be random")
+	}
+
+	cases := map[string]func() error{
+		"other binding": func() error {
+			_, err := CheckChallenge(key, "registration:bob", challenge, now)
+			return err
+		},
+		"other key": func() error {
+			_, err := CheckChallenge([]byte("other-key"), "registration:alice", challenge, now)
+			return err
+		},
+		"expired": func() error {
+			_, err := CheckChallenge(key, "registration:alice", challenge, now.Add(time.Minute))
+			return err
+		},
+		"malformed": func() error {
+			_, err := CheckChallenge(key, "registration:alice", challenge[:20], now)
+			return err
+		},
+	}
+	for name, check := range cases {
+		if err := check(); !errors.Is(err, ErrInvalid) {
+			t.Errorf("%s: expected ErrInvalid, got %v", name, err)
+		}
+	}
+}
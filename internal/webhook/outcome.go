@@ -0,0 +1,59 @@
+package webhook
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Delivery statuses recorded for each attempt. Retrying means an attempt
+// failed and another is scheduled.
+const (
+	StatusSucceeded = "succeeded"
+	StatusRetrying  = "retrying"
+	StatusFailed    = "failed"
+)
+
+// Outcome is what one delivery attempt means for the delivery and for the
+// endpoint it was sent to.
+type Outcome struct {
+	Status string
+	// Final is set when the delivery won't be tried again.
+	Final bool
+	// ResetFailures is set on success, which ends any run of failed
+	// deliveries.
+	ResetFailures bool
+	// CountFailure is set when the delivery ran out of attempts, which
+	// counts toward disabling the endpoint.
+	CountFailure bool
+	// DisableReason, when set, disables the endpoint straight away.
+	DisableReason string
+}
+
+// Decide works out the Outcome of attempt (counting from 1) out of
+// maxAttempts, given the error Sender.Send returned. A 410 Gone is final
+// and disables the endpoint, since the receiver is telling us to stop.
+func Decide(sendErr error, attempt, maxAttempts int) Outcome {
+	if sendErr == nil {
+		return Outcome{Status: StatusSucceeded, Final: true, ResetFailures: true}
+	}
+
+	var statusErr *StatusError
+	if errors.As(sendErr, &statusErr) && statusErr.StatusCode == http.StatusGone {
+		return Outcome{Status: StatusFailed, Final: true, DisableReason: "endpoint responded 410 Gone"}
+	}
+
+	if attempt < maxAttempts {
+		return Outcome{Status: StatusRetrying}
+	}
+	return Outcome{Status: StatusFailed, Final: true, CountFailure: true}
+}
+
+// FailureDisableReason says why an endpoint with failures deliveries in a
+// row should be disabled, or returns "" while it's under limit.
+func FailureDisableReason(failures, limit int) string {
+	if failures < limit {
+		return ""
+	}
+	return fmt.Sprintf("%d deliveries in a row failed", failures)
+}
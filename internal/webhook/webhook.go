@@ -0,0 +1,152 @@
+// Package webhook sends signed event notifications to endpoints registered
+// by third parties. Payloads are signed with package signature, so receivers
+// verify them the same way chirpy verifies Polka.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+	"time"
+
+	"github.com/nickemp1996/chirpy/internal/signature"
+)
+
+const (
+	SignatureHeader = "Chirpy-Signature"
+	EventHeader     = "Chirpy-Event"
+	DeliveryHeader  = "Chirpy-Delivery"
+
+	userAgent = "Chirpy-Webhooks/1.0"
+
+	DefaultTimeout = 10 * time.Second
+
+	// maxResponseBody is how much of a receiver's response is kept for the
+	// delivery log.
+	maxResponseBody = 1 << 10
+)
+
+var (
+	ErrPrivateAddress = errors.New("webhook endpoint resolves to a private address")
+	ErrInvalidURL     = errors.New("webhook url must be an absolute https url")
+)
+
+// StatusError is a delivery the receiver answered with a non-2xx status.
+type StatusError struct {
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("endpoint responded with status %d", e.StatusCode)
+}
+
+// Result describes one delivery attempt, successful or not.
+type Result struct {
+	StatusCode int
+	Body       string
+	Duration   time.Duration
+}
+
+type Sender struct {
+	client *http.Client
+	now    func() time.Time
+}
+
+// NewSender returns a Sender that refuses loopback, private and link local
+// addresses unless allowPrivate is set, so endpoints can't be used to probe
+// the network chirpy runs in. The check runs at dial time, after DNS, so a
+// public name pointing at a private address is refused too.
+func NewSender(allowPrivate bool) *Sender {
+	dialer := &net.Dialer{Timeout: 5 * time.Second}
+	if !allowPrivate {
+		dialer.Control = func(network, address string, c syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			ip := net.ParseIP(host)
+			if ip == nil || isPrivate(ip) {
+				return ErrPrivateAddress
+			}
+			return nil
+		}
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	transport.Proxy = nil
+
+	return &Sender{
+		client: &http.Client{
+			Transport: transport,
+			Timeout:   DefaultTimeout,
+			// a redirect could lead anywhere, treat it as a failed delivery
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		now: time.Now,
+	}
+}
+
+func isPrivate(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified()
+}
+
+// ValidateURL checks an endpoint url when it is registered. Plain http is
+// only accepted when allowInsecure is set, for local development.
+func ValidateURL(raw string, allowInsecure bool) error {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" || u.User != nil {
+		return ErrInvalidURL
+	}
+	if u.Scheme != "https" && !(allowInsecure && u.Scheme == "http") {
+		return ErrInvalidURL
+	}
+	return nil
+}
+
+// Send posts payload to endpoint, signed with secret. deliveryID is sent
+// along so receivers can drop retries of a delivery they already handled.
+// Any status outside 2xx is returned as a *StatusError.
+func (s *Sender) Send(ctx context.Context, endpoint, secret, eventType, deliveryID string, payload []byte) (Result, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return Result{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set(EventHeader, eventType)
+	req.Header.Set(DeliveryHeader, deliveryID)
+	req.Header.Set(SignatureHeader, signature.Header(secret, s.now(), payload))
+
+	start := time.Now()
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return Result{Duration: time.Since(start)}, err
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxResponseBody))
+	// drain the rest so the connection can be reused
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	result := Result{
+		StatusCode: resp.StatusCode,
+		Body:       string(body),
+		Duration:   time.Since(start),
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return result, &StatusError{StatusCode: resp.StatusCode}
+	}
+
+	return result, nil
+}
@@ -1,61 +1,239 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
+	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 
-	"github.com/joho/godotenv"
+	"github.com/nickemp1996/chirpy/internal/billing"
+	"github.com/nickemp1996/chirpy/internal/config"
 	"github.com/nickemp1996/chirpy/internal/database"
+	"github.com/nickemp1996/chirpy/internal/entitlements"
+	"github.com/nickemp1996/chirpy/internal/jobs"
+	"github.com/nickemp1996/chirpy/internal/logging"
+	"github.com/nickemp1996/chirpy/internal/migrate"
+	"github.com/nickemp1996/chirpy/internal/ratelimit"
+	"github.com/nickemp1996/chirpy/internal/storage"
+	"github.com/nickemp1996/chirpy/internal/webhook"
 
 	_ "github.com/lib/pq"
 )
 
+const usage = `usage: chirpy [command]
+
+commands:
+  serve                    run the HTTP server (default)
+  migrate up|down|status   manage the database schema
+  user <command> <user>    look up and manage an account
+  chirp takedown <id>      delete a chirp
+  seed                     create test users and chirps
+  reset                    delete every user and their data
+`
+
+var commands = map[string]bool{
+	"serve":   true,
+	"migrate": true,
+	"user":    true,
+	"chirp":   true,
+	"seed":    true,
+	"reset":   true,
+}
+
 func main() {
-	godotenv.Load()
-	dbURL := os.Getenv("DB_URL")
-	platform := os.Getenv("PLATFORM")
-	secret := os.Getenv("SECRET")
-	polkaKey := os.Getenv("POLKA_KEY")
-	db, err := sql.Open("postgres", dbURL)
+	cmd, args := "serve", os.Args[1:]
+	if len(args) > 0 {
+		cmd, args = args[0], args[1:]
+	}
+	if !commands[cmd] {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	cfg, err := config.Load(os.Getenv("CONFIG_FILE"))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	slog.SetDefault(logging.New(os.Stdout, cfg.LogLevel))
+
+	db, err := sql.Open("postgres", cfg.DBURL)
+	if err != nil {
+		slog.Error("failed to open connection to database", "err", err)
+		os.Exit(1)
+	}
+
+	migrator, err := newMigrator(db)
+	if err != nil {
+		slog.Error("failed to load migrations", "err", err)
+		os.Exit(1)
+	}
+
+	if cmd == "serve" {
+		runServer(cfg, db, migrator)
+		return
+	}
+
+	ctx := context.Background()
+	if cmd == "migrate" {
+		err = runMigrate(ctx, migrator, args)
+	} else {
+		err = migrator.Check(ctx)
+		if err == nil {
+			cli := &adminCLI{cfg: cfg, db: db, queries: database.New(db), out: os.Stdout}
+			err = cli.run(ctx, cmd, args)
+		}
+	}
+	db.Close()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func runServer(cfg *config.Config, db *sql.DB, migrator *migrate.Migrator) {
+	err := prepareSchema(context.Background(), migrator, cfg.AutoMigrate)
+	if err != nil {
+		slog.Error("refusing to start", "err", err)
+		os.Exit(1)
+	}
+
+	tracer, err := newTracer(cfg)
+	if err != nil {
+		slog.Error("failed to start tracing", "err", err)
+		os.Exit(1)
+	}
+	dbQueries := database.New(tracer.WrapDB(db))
+
+	plans, err := entitlements.Load(cfg.EntitlementsFile)
 	if err != nil {
-		fmt.Printf("Failed to open connection to database: %v\n", err)
+		slog.Error("failed to load entitlements", "err", err)
+		os.Exit(1)
+	}
+
+	blobs, err := storage.NewLocalStore(cfg.MediaDir)
+	if err != nil {
+		slog.Error("failed to open media store", "err", err)
 		os.Exit(1)
 	}
-	dbQueries := database.New(db)
 
 	mux := http.NewServeMux()
 	apiCfg := &apiConfig{}
+	apiCfg.db = db
+	apiCfg.metrics = newAppMetrics(db)
 	apiCfg.queries = dbQueries
-	apiCfg.platform = platform
-	apiCfg.secret = secret
-	apiCfg.polkaKey = polkaKey
+	apiCfg.blobs = blobs
+	apiCfg.jobs = jobs.New(dbQueries)
+	apiCfg.tracer = tracer
+	apiCfg.migrator = migrator
+	apiCfg.plans = plans
+	apiCfg.limiter = ratelimit.New()
+	// local receivers are fine while developing, never in production
+	apiCfg.webhookSender = webhook.NewSender(cfg.IsDev())
+	apiCfg.dev = cfg.IsDev()
+	apiCfg.secret = cfg.Secret
+	apiCfg.billingProviders = newBillingProviders(cfg)
+	apiCfg.oidcProviders = newOIDCProviders(cfg)
+	apiCfg.relyingParty = newRelyingParty(cfg)
+	apiCfg.accessTokenTTL = cfg.AccessTokenTTL
+	apiCfg.refreshTokenTTL = cfg.RefreshTokenTTL
 
-	server := &http.Server{
-		Addr:    ":8080",
-		Handler: mux,
-	}
+	jobs.Register(apiCfg.jobs, jobMediaVariants, apiCfg.generateMediaVariants)
+	jobs.Register(apiCfg.jobs, jobExpireSubscription, apiCfg.expireSubscription)
+	jobs.Register(apiCfg.jobs, jobDeliverWebhook, apiCfg.deliverWebhook)
+
+	server := newServer(cfg, logging.Middleware(tracer.Middleware(apiCfg.metrics.middleware(mux))))
 
 	mux.Handle("/app/", apiCfg.middlewareMetricsInc(http.StripPrefix("/app/", http.FileServer(http.Dir(".")))))
 	mux.HandleFunc("GET /api/healthz", readinessEndpoint)
+	mux.HandleFunc("GET /api/livez", apiCfg.livez)
+	mux.HandleFunc("GET /api/readyz", apiCfg.readyz)
 	mux.HandleFunc("GET /admin/metrics", apiCfg.getFileserverHits)
+	mux.Handle("GET /metrics", apiCfg.metrics.registry)
 	mux.HandleFunc("POST /admin/reset", apiCfg.reset)
+	mux.HandleFunc("GET /admin/webhooks", apiCfg.listWebhookDeliveries)
+	mux.HandleFunc("GET /admin/webhooks/{deliveryID}", apiCfg.getWebhookDelivery)
+	mux.HandleFunc("POST /admin/webhooks/{deliveryID}/replay", apiCfg.replayWebhookDelivery)
 	mux.HandleFunc("POST /api/chirps", apiCfg.createChirp)
 	mux.HandleFunc("GET /api/chirps", apiCfg.getChirps)
 	mux.HandleFunc("GET /api/chirps/{chirpID}", apiCfg.getChirp)
+	mux.HandleFunc("PUT /api/chirps/{chirpID}", apiCfg.editChirp)
 	mux.HandleFunc("DELETE /api/chirps/{chirpID}", apiCfg.deleteChirp)
 	mux.HandleFunc("POST /api/users", apiCfg.addUser)
 	mux.HandleFunc("PUT /api/users", apiCfg.updateUserLogin)
+	mux.HandleFunc("PATCH /api/users/me", apiCfg.updateUserProfile)
+	mux.HandleFunc("GET /api/users/{userID}", apiCfg.getUserProfile)
+	mux.HandleFunc("GET /api/users/by-handle/{handle}", apiCfg.getUserProfileByHandle)
+	mux.HandleFunc("POST /api/users/me/avatar", apiCfg.uploadAvatar)
+	mux.HandleFunc("POST /api/media", apiCfg.uploadChirpMedia)
+	mux.HandleFunc("GET /media/{key...}", apiCfg.serveMedia)
 	mux.HandleFunc("POST /api/login", apiCfg.userLogin)
+	mux.HandleFunc("GET /api/auth/oidc/{provider}/login", apiCfg.startOIDCLogin)
+	mux.HandleFunc("GET /api/auth/oidc/{provider}/callback", apiCfg.oidcCallback)
+	mux.HandleFunc("POST /api/passkeys/register/begin", apiCfg.beginPasskeyRegistration)
+	mux.HandleFunc("POST /api/passkeys/register/finish", apiCfg.finishPasskeyRegistration)
+	mux.HandleFunc("POST /api/passkeys/login/begin", apiCfg.beginPasskeyLogin)
+	mux.HandleFunc("POST /api/passkeys/login/finish", apiCfg.finishPasskeyLogin)
+	mux.HandleFunc("GET /api/passkeys", apiCfg.getPasskeys)
+	mux.HandleFunc("DELETE /api/passkeys/{passkeyID}", apiCfg.deletePasskey)
+	mux.HandleFunc("DELETE /api/users/me/password", apiCfg.removePassword)
+	mux.HandleFunc("GET /api/users/me/identities", apiCfg.getUserIdentities)
+	mux.HandleFunc("POST /api/users/me/identities/{provider}", apiCfg.startIdentityLink)
+	mux.HandleFunc("DELETE /api/users/me/identities/{identityID}", apiCfg.unlinkUserIdentity)
 	mux.HandleFunc("POST /api/refresh", apiCfg.refresh)
 	mux.HandleFunc("POST /api/revoke", apiCfg.revoke)
-	mux.HandleFunc("POST /api/polka/webhooks", apiCfg.upgradeUser)
+	mux.HandleFunc("POST /api/billing/{provider}/webhooks", apiCfg.billingWebhook)
+	mux.HandleFunc("POST /api/polka/webhooks", apiCfg.polkaWebhook)
+	mux.HandleFunc("POST /api/keys", apiCfg.createAPIKey)
+	mux.HandleFunc("GET /api/keys", apiCfg.getAPIKeys)
+	mux.HandleFunc("DELETE /api/keys/{keyID}", apiCfg.revokeAPIKey)
+	mux.HandleFunc("POST /api/oauth/clients", apiCfg.createOAuthClient)
+	mux.HandleFunc("GET /api/oauth/clients", apiCfg.getOAuthClients)
+	mux.HandleFunc("DELETE /api/oauth/clients/{clientID}", apiCfg.deleteOAuthClient)
+	mux.HandleFunc("GET /oauth/authorize", apiCfg.authorize)
+	mux.HandleFunc("POST /oauth/authorize", apiCfg.approveAuthorize)
+	mux.HandleFunc("POST /oauth/token", apiCfg.oauthToken)
+	mux.HandleFunc("POST /oauth/introspect", apiCfg.introspectOAuthToken)
+	mux.HandleFunc("POST /oauth/revoke", apiCfg.revokeOAuthToken)
+	mux.HandleFunc("POST /api/webhooks", apiCfg.createWebhookEndpoint)
+	mux.HandleFunc("GET /api/webhooks", apiCfg.getWebhookEndpoints)
+	mux.HandleFunc("PATCH /api/webhooks/{endpointID}", apiCfg.updateWebhookEndpoint)
+	mux.HandleFunc("DELETE /api/webhooks/{endpointID}", apiCfg.deleteWebhookEndpoint)
+	mux.HandleFunc("GET /api/webhooks/{endpointID}/deliveries", apiCfg.getWebhookEndpointDeliveries)
 
-	fmt.Println("Starting server on ", server.Addr)
-	err = server.ListenAndServe()
+	// the first SIGINT/SIGTERM starts a graceful shutdown, a second one kills the process
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
+	go apiCfg.jobs.Run(ctx)
+
+	err = apiCfg.serve(ctx, server, cfg.ShutdownDelay, cfg.ShutdownTimeout)
+	closeErr := db.Close()
+	if closeErr != nil {
+		slog.Error("error closing database", "err", closeErr)
+	}
 	if err != nil && err != http.ErrServerClosed {
-		fmt.Printf("Server failed: %v\n", err)
+		slog.Error("server failed", "err", err)
 		os.Exit(1)
 	}
 }
+
+// newBillingProviders lists the payment providers that can send webhooks,
+// keyed by the name in their webhook url.
+func newBillingProviders(cfg *config.Config) map[string]billing.Provider {
+	providers := map[string]billing.Provider{}
+	for _, p := range []billing.Provider{
+		billing.NewPolka(cfg.PolkaKey, cfg.PolkaWebhookSecret, cfg.WebhookTolerance),
+	} {
+		providers[p.Name()] = p
+	}
+	return providers
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nickemp1996/chirpy/internal/metrics"
+)
+
+type appMetrics struct {
+	registry *metrics.Registry
+
+	fileserverHits *metrics.Counter
+	httpRequests   *metrics.CounterVec
+	httpDuration   *metrics.HistogramVec
+	httpInFlight   *metrics.Gauge
+
+	signups       *metrics.Counter
+	chirpsCreated *metrics.Counter
+	loginsFailed  *metrics.Counter
+	rateLimited   *metrics.Counter
+}
+
+func newAppMetrics(db *sql.DB) *appMetrics {
+	r := metrics.NewRegistry()
+	m := &appMetrics{
+		registry: r,
+
+		fileserverHits: r.NewCounter("chirpy_fileserver_hits_total", "Requests served by the /app/ file server."),
+		httpRequests:   r.NewCounterVec("chirpy_http_requests_total", "HTTP requests by route and status.", "method", "route", "status"),
+		httpDuration:   r.NewHistogramVec("chirpy_http_request_duration_seconds", "HTTP request latency by route.", metrics.DefBuckets, "method", "route"),
+		httpInFlight:   r.NewGauge("chirpy_http_requests_in_flight", "HTTP requests currently being served."),
+
+		signups:       r.NewCounter("chirpy_signups_total", "Users created."),
+		chirpsCreated: r.NewCounter("chirpy_chirps_created_total", "Chirps created."),
+		loginsFailed:  r.NewCounter("chirpy_logins_failed_total", "Login attempts rejected for a bad email or password."),
+		rateLimited:   r.NewCounter("chirpy_rate_limited_total", "Requests rejected by a plan's rate limit."),
+	}
+
+	r.NewGaugeFunc("chirpy_db_open_connections", "Established database connections, in use and idle.", func() float64 {
+		return float64(db.Stats().OpenConnections)
+	})
+	r.NewGaugeFunc("chirpy_db_in_use_connections", "Database connections currently in use.", func() float64 {
+		return float64(db.Stats().InUse)
+	})
+	r.NewGaugeFunc("chirpy_db_idle_connections", "Idle database connections.", func() float64 {
+		return float64(db.Stats().Idle)
+	})
+	r.NewGaugeFunc("chirpy_db_max_open_connections", "Maximum number of open database connections.", func() float64 {
+		return float64(db.Stats().MaxOpenConnections)
+	})
+	r.NewCounterFunc("chirpy_db_wait_count_total", "Connections waited for because the pool was exhausted.", func() float64 {
+		return float64(db.Stats().WaitCount)
+	})
+	r.NewCounterFunc("chirpy_db_wait_duration_seconds_total", "Time spent waiting for a free connection.", func() float64 {
+		return db.Stats().WaitDuration.Seconds()
+	})
+
+	return m
+}
+
+type metricsRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *metricsRecorder) WriteHeader(code int) {
+	if r.status == 0 {
+		r.status = code
+	}
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *metricsRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	return r.ResponseWriter.Write(b)
+}
+
+func (r *metricsRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// middleware records request counts and latency. It must wrap the ServeMux
+// directly: the route label is the matched pattern, which the mux sets on the
+// request it is handed, so raw paths with ids never become label values.
+func (m *appMetrics) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		m.httpInFlight.Inc()
+		defer m.httpInFlight.Dec()
+
+		rec := &metricsRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+
+		route := "unmatched"
+		if r.Pattern != "" {
+			// patterns look like "GET /api/chirps/{chirpID}", the method is its own label
+			_, path, found := strings.Cut(r.Pattern, " ")
+			if !found {
+				path = r.Pattern
+			}
+			route = path
+		}
+
+		method := metrics.Method(r.Method)
+		m.httpRequests.Inc(method, route, strconv.Itoa(rec.status))
+		m.httpDuration.Observe(time.Since(start).Seconds(), method, route)
+	})
+}
+
+func (cfg *apiConfig) middlewareMetricsInc(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cfg.metrics.fileserverHits.Inc()
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/nickemp1996/chirpy/internal/migrate"
+)
+
+//go:embed sql/schema/*.sql
+var schemaFiles embed.FS
+
+func newMigrator(db *sql.DB) (*migrate.Migrator, error) {
+	schema, err := fs.Sub(schemaFiles, "sql/schema")
+	if err != nil {
+		return nil, err
+	}
+	return migrate.New(db, schema)
+}
+
+// prepareSchema runs before the server starts. It applies pending migrations
+// when auto-migrate is on and refuses to run against a schema from a newer
+// release, where our queries could silently misbehave.
+func prepareSchema(ctx context.Context, migrator *migrate.Migrator, autoMigrate bool) error {
+	if autoMigrate {
+		ran, err := migrator.Up(ctx)
+		if err != nil {
+			return fmt.Errorf("migrating database: %w", err)
+		}
+		for _, mig := range ran {
+			slog.Info("applied migration", "version", mig.Version, "name", mig.Name)
+		}
+	}
+
+	err := migrator.Check(ctx)
+	if err != nil {
+		return err
+	}
+
+	current, err := migrator.Current(ctx)
+	if err != nil {
+		return err
+	}
+	if current < migrator.Latest() {
+		slog.Warn("database has pending migrations, run chirpy migrate up", "version", current, "latest", migrator.Latest())
+	}
+
+	return nil
+}
+
+func runMigrate(ctx context.Context, migrator *migrate.Migrator, args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: chirpy migrate up|down|status")
+	}
+
+	switch args[0] {
+	case "up":
+		ran, err := migrator.Up(ctx)
+		for _, mig := range ran {
+			fmt.Printf("applied %d_%s\n", mig.Version, mig.Name)
+		}
+		if err != nil {
+			return err
+		}
+		if len(ran) == 0 {
+			fmt.Println("no pending migrations")
+		}
+		return nil
+
+	case "down":
+		mig, err := migrator.Down(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("rolled back %d_%s\n", mig.Version, mig.Name)
+		return nil
+
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "VERSION\tNAME\tAPPLIED AT")
+		for _, st := range statuses {
+			appliedAt := "pending"
+			if st.Applied {
+				appliedAt = st.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Fprintf(tw, "%d\t%s\t%s\n", st.Version, st.Name, appliedAt)
+		}
+		tw.Flush()
+
+		return migrator.Check(ctx)
+
+	default:
+		return fmt.Errorf("unknown migrate command %q, expected up, down or status", args[0])
+	}
+}
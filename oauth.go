@@ -0,0 +1,872 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/nickemp1996/chirpy/internal/apierror"
+	"github.com/nickemp1996/chirpy/internal/auth"
+	"github.com/nickemp1996/chirpy/internal/database"
+	"github.com/nickemp1996/chirpy/internal/httpjson"
+	"github.com/nickemp1996/chirpy/internal/logging"
+	"github.com/nickemp1996/chirpy/internal/oauth"
+)
+
+const (
+	oauthCodeTTL                = 10 * time.Minute
+	maxOAuthClients             = 10
+	maxOAuthClientNameLength    = 50
+	maxOAuthRedirectURIs        = 5
+	maxOAuthFormSize            = 8 << 10
+	oauthChallengeMethodS256    = "S256"
+	oauthGrantAuthorizationCode = "authorization_code"
+	oauthGrantRefreshToken      = "refresh_token"
+)
+
+// oauthScopeDescriptions is what the consent page tells users a scope allows.
+// Clients can ask for the same scopes as personal API keys.
+var oauthScopeDescriptions = map[string]string{
+	scopeChirpsWrite: "Post, edit and delete chirps as you",
+	scopeMediaWrite:  "Upload images for your chirps",
+}
+
+func oauthClientFromDB(dbClient database.OauthClient) OAuthClient {
+	return OAuthClient{
+		ID:           dbClient.ID,
+		CreatedAt:    dbClient.CreatedAt,
+		ClientID:     dbClient.ClientID,
+		Name:         dbClient.Name,
+		RedirectURIs: dbClient.RedirectUris,
+		Scopes:       dbClient.Scopes,
+		Public:       !dbClient.SecretHash.Valid,
+	}
+}
+
+func (cfg *apiConfig) createOAuthClient(w http.ResponseWriter, r *http.Request) {
+	// public clients, like mobile and single page apps, can't keep a secret
+	type parameters struct {
+		Name         string   `json:"name"`
+		RedirectURIs []string `json:"redirect_uris"`
+		Scopes       []string `json:"scopes"`
+		Public       bool     `json:"public"`
+	}
+
+	params := parameters{}
+	err := httpjson.Decode(w, r, &params, maxUserBodySize)
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	tokenString, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, r, apierror.Unauthorized("token missing", err))
+		return
+	}
+
+	validUser, err := auth.ValidateJWT(tokenString, cfg.secret)
+	if err != nil {
+		respondWithError(w, r, apierror.Unauthorized("invalid or expired token", err))
+		return
+	}
+
+	logging.SetUserID(r.Context(), validUser)
+
+	var fields []apierror.FieldError
+
+	name := strings.TrimSpace(params.Name)
+	if name == "" || utf8.RuneCountInString(name) > maxOAuthClientNameLength {
+		fields = append(fields, apierror.FieldError{Field: "name", Message: fmt.Sprintf("must be between 1 and %d characters", maxOAuthClientNameLength)})
+	}
+
+	if len(params.RedirectURIs) == 0 || len(params.RedirectURIs) > maxOAuthRedirectURIs {
+		fields = append(fields, apierror.FieldError{Field: "redirect_uris", Message: fmt.Sprintf("must list between 1 and %d urls", maxOAuthRedirectURIs)})
+	}
+	for _, redirectURI := range params.RedirectURIs {
+		if !oauth.ValidRedirectURI(redirectURI) {
+			fields = append(fields, apierror.FieldError{Field: "redirect_uris", Message: fmt.Sprintf("%q must be an https url, or http on localhost, without a fragment", redirectURI)})
+			break
+		}
+	}
+
+	var scopes []string
+	if len(params.Scopes) == 0 {
+		fields = append(fields, apierror.FieldError{Field: "scopes", Message: "must list at least one scope"})
+	}
+	for _, scope := range params.Scopes {
+		if !slices.Contains(apiKeyScopes, scope) {
+			fields = append(fields, apierror.FieldError{Field: "scopes", Message: fmt.Sprintf("unknown scope %q, must be chirps:write or media:write", scope)})
+			break
+		}
+		if !slices.Contains(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+
+	if len(fields) > 0 {
+		respondWithError(w, r, apierror.Validation(fields...))
+		return
+	}
+
+	existing, err := cfg.queries.GetUserOAuthClients(r.Context(), validUser)
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+	if len(existing) >= maxOAuthClients {
+		respondWithError(w, r, apierror.Conflict(fmt.Sprintf("an account can register at most %d oauth clients", maxOAuthClients), nil))
+		return
+	}
+
+	var secret string
+	var secretHash sql.NullString
+	if !params.Public {
+		secret, err = oauth.NewToken("chirpy_secret_")
+		if err != nil {
+			respondWithError(w, r, err)
+			return
+		}
+		secretHash = sql.NullString{String: oauth.Hash(secret), Valid: true}
+	}
+
+	dbClient, err := cfg.queries.CreateOAuthClient(r.Context(), database.CreateOAuthClientParams{
+		OwnerID:      validUser,
+		ClientID:     uuid.NewString(),
+		SecretHash:   secretHash,
+		Name:         name,
+		RedirectUris: params.RedirectURIs,
+		Scopes:       scopes,
+	})
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	// the secret is only ever shown here
+	client := oauthClientFromDB(dbClient)
+	client.ClientSecret = secret
+
+	respondWithJSON(w, 201, client)
+}
+
+func (cfg *apiConfig) getOAuthClients(w http.ResponseWriter, r *http.Request) {
+	tokenString, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, r, apierror.Unauthorized("token missing", err))
+		return
+	}
+
+	validUser, err := auth.ValidateJWT(tokenString, cfg.secret)
+	if err != nil {
+		respondWithError(w, r, apierror.Unauthorized("invalid or expired token", err))
+		return
+	}
+
+	logging.SetUserID(r.Context(), validUser)
+
+	dbClients, err := cfg.queries.GetUserOAuthClients(r.Context(), validUser)
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	clients := make([]OAuthClient, len(dbClients))
+	for i, dbClient := range dbClients {
+		clients[i] = oauthClientFromDB(dbClient)
+	}
+
+	respondWithJSON(w, 200, clients)
+}
+
+// deleteOAuthClient removes a client along with every grant users gave it,
+// so its tokens stop working straight away.
+func (cfg *apiConfig) deleteOAuthClient(w http.ResponseWriter, r *http.Request) {
+	tokenString, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, r, apierror.Unauthorized("token missing", err))
+		return
+	}
+
+	validUser, err := auth.ValidateJWT(tokenString, cfg.secret)
+	if err != nil {
+		respondWithError(w, r, apierror.Unauthorized("invalid or expired token", err))
+		return
+	}
+
+	logging.SetUserID(r.Context(), validUser)
+
+	deleted, err := cfg.queries.DeleteOAuthClient(r.Context(), database.DeleteOAuthClientParams{
+		ClientID: r.PathValue("clientID"),
+		OwnerID:  validUser,
+	})
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+	if deleted == 0 {
+		respondWithError(w, r, apierror.NotFound("oauth client not found", nil))
+		return
+	}
+
+	w.WriteHeader(204)
+}
+
+// authorizeRequest is a checked authorization request. RedirectURI is only
+// set once the client and redirect uri are known to be good; until then
+// errors are shown to the user, since the uri could belong to anyone.
+type authorizeRequest struct {
+	Client        database.OauthClient
+	RedirectURI   string
+	State         string
+	Scopes        []string
+	CodeChallenge string
+}
+
+func (cfg *apiConfig) parseAuthorizeRequest(ctx context.Context, form url.Values) (authorizeRequest, error) {
+	req := authorizeRequest{}
+
+	client, err := cfg.queries.GetOAuthClient(ctx, form.Get("client_id"))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return req, oauth.NewError(oauth.ErrInvalidClient, "This application is not registered with Chirpy.")
+		}
+		return req, err
+	}
+	req.Client = client
+
+	redirectURI := form.Get("redirect_uri")
+	if !slices.Contains(client.RedirectUris, redirectURI) {
+		return req, oauth.NewError(oauth.ErrInvalidRequest, "The redirect_uri is not registered for this application.")
+	}
+	req.RedirectURI = redirectURI
+	req.State = form.Get("state")
+
+	if form.Get("response_type") != "code" {
+		return req, oauth.NewError(oauth.ErrUnsupportedResponseType, "response_type must be code")
+	}
+
+	req.Scopes = oauth.ParseScope(form.Get("scope"))
+	if len(req.Scopes) == 0 {
+		req.Scopes = client.Scopes
+	}
+	if !oauth.Subset(req.Scopes, client.Scopes) {
+		return req, oauth.NewError(oauth.ErrInvalidScope, "scope must be a subset of "+oauth.FormatScope(client.Scopes))
+	}
+
+	if form.Get("code_challenge_method") != oauthChallengeMethodS256 || !oauth.ValidChallenge(form.Get("code_challenge")) {
+		return req, oauth.NewError(oauth.ErrInvalidRequest, "a code_challenge with code_challenge_method S256 is required")
+	}
+	req.CodeChallenge = form.Get("code_challenge")
+
+	return req, nil
+}
+
+// Params are the fields the consent form posts back, so the POST sees the
+// same request the user was shown.
+func (req authorizeRequest) Params() map[string]string {
+	return map[string]string{
+		"client_id":             req.Client.ClientID,
+		"redirect_uri":          req.RedirectURI,
+		"response_type":         "code",
+		"scope":                 oauth.FormatScope(req.Scopes),
+		"state":                 req.State,
+		"code_challenge":        req.CodeChallenge,
+		"code_challenge_method": oauthChallengeMethodS256,
+	}
+}
+
+var authorizePage = template.Must(template.New("authorize").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Authorize - Chirpy</title>
+</head>
+<body>
+{{if .Params}}
+<h1>{{.ClientName}} wants to use your Chirpy account</h1>
+<p>If you allow it, {{.ClientName}} will be able to:</p>
+<ul>
+{{range .Scopes}}<li>{{.}}</li>
+{{end}}</ul>
+<p>It will never see your password.</p>
+{{if .Error}}<p role="alert">{{.Error}}</p>{{end}}
+<form method="post" action="/oauth/authorize">
+{{range $name, $value := .Params}}<input type="hidden" name="{{$name}}" value="{{$value}}">
+{{end}}<label>Email <input type="email" name="email" value="{{.Email}}" autocomplete="username" required></label>
+<label>Password <input type="password" name="password" autocomplete="current-password" required></label>
+<button type="submit" name="action" value="approve">Allow</button>
+<button type="submit" name="action" value="deny" formnovalidate>Deny</button>
+</form>
+{{else}}
+<h1>This authorization request can't be completed</h1>
+<p role="alert">{{.Error}}</p>
+{{end}}
+</body>
+</html>
+`))
+
+type authorizePageData struct {
+	ClientName string
+	Scopes     []string
+	Params     map[string]string
+	Email      string
+	Error      string
+}
+
+func renderAuthorizePage(w http.ResponseWriter, r *http.Request, status int, data authorizePageData) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	// the page takes a password, so it must never be framed by the client
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; frame-ancestors 'none'")
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.WriteHeader(status)
+
+	err := authorizePage.Execute(w, data)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("error rendering authorization page", "err", err)
+	}
+}
+
+func renderConsent(w http.ResponseWriter, r *http.Request, status int, req authorizeRequest, email, message string) {
+	scopes := make([]string, len(req.Scopes))
+	for i, scope := range req.Scopes {
+		scopes[i] = oauthScopeDescriptions[scope]
+	}
+
+	renderAuthorizePage(w, r, status, authorizePageData{
+		ClientName: req.Client.Name,
+		Scopes:     scopes,
+		Params:     req.Params(),
+		Email:      email,
+		Error:      message,
+	})
+}
+
+// authorizeFailed sends err back to the client, or shows it to the user when
+// the redirect uri can't be trusted.
+func authorizeFailed(w http.ResponseWriter, r *http.Request, req authorizeRequest, err error) {
+	var oauthErr *oauth.Error
+	if !errors.As(err, &oauthErr) {
+		logging.FromContext(r.Context()).Error("error handling authorization request", "err", err)
+		oauthErr = oauth.NewError(oauth.ErrServerError, "Something went wrong, please try again.")
+	}
+
+	if req.RedirectURI == "" {
+		logging.FromContext(r.Context()).Info("refusing authorization request", "code", oauthErr.Code, "err", oauthErr.Description)
+		renderAuthorizePage(w, r, oauthErr.Status(), authorizePageData{Error: oauthErr.Description})
+		return
+	}
+
+	redirectAuthorize(w, r, req, url.Values{
+		"error":             {oauthErr.Code},
+		"error_description": {oauthErr.Description},
+	})
+}
+
+func redirectAuthorize(w http.ResponseWriter, r *http.Request, req authorizeRequest, params url.Values) {
+	if req.State != "" {
+		params.Set("state", req.State)
+	}
+
+	// registered uris may carry a query of their own, which is kept
+	u, err := url.Parse(req.RedirectURI)
+	if err != nil {
+		renderAuthorizePage(w, r, http.StatusBadRequest, authorizePageData{Error: "The redirect_uri is invalid."})
+		return
+	}
+	query := u.Query()
+	for name, values := range params {
+		query[name] = values
+	}
+	u.RawQuery = query.Encode()
+
+	http.Redirect(w, r, u.String(), http.StatusFound)
+}
+
+// authorize shows the consent page for an authorization code request.
+func (cfg *apiConfig) authorize(w http.ResponseWriter, r *http.Request) {
+	req, err := cfg.parseAuthorizeRequest(r.Context(), r.URL.Query())
+	if err != nil {
+		authorizeFailed(w, r, req, err)
+		return
+	}
+
+	renderConsent(w, r, http.StatusOK, req, "", "")
+}
+
+// approveAuthorize handles the consent form. Users sign in on the form
+// itself, so a client only ever sees the code it is redirected with.
+func (cfg *apiConfig) approveAuthorize(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxOAuthFormSize)
+	err := r.ParseForm()
+	if err != nil {
+		renderAuthorizePage(w, r, http.StatusBadRequest, authorizePageData{Error: "The form could not be read."})
+		return
+	}
+
+	req, err := cfg.parseAuthorizeRequest(r.Context(), r.PostForm)
+	if err != nil {
+		authorizeFailed(w, r, req, err)
+		return
+	}
+
+	if r.PostForm.Get("action") != "approve" {
+		redirectAuthorize(w, r, req, url.Values{"error": {oauth.ErrAccessDenied}})
+		return
+	}
+
+	email := strings.ToLower(strings.TrimSpace(r.PostForm.Get("email")))
+	dbUser, err := cfg.queries.GetPassword(r.Context(), email)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		authorizeFailed(w, r, req, err)
+		return
+	}
+
+	valid := false
+	if err == nil {
+		valid, err = checkPassword(dbUser, r.PostForm.Get("password"))
+		if err != nil {
+			authorizeFailed(w, r, req, err)
+			return
+		}
+	}
+	if !valid {
+		cfg.metrics.loginsFailed.Inc()
+		renderConsent(w, r, http.StatusUnauthorized, req, email, "Incorrect email or password.")
+		return
+	}
+
+	logging.SetUserID(r.Context(), dbUser.ID)
+
+	code, err := oauth.NewToken("chirpy_code_")
+	if err != nil {
+		authorizeFailed(w, r, req, err)
+		return
+	}
+
+	err = cfg.queries.CreateOAuthCode(r.Context(), database.CreateOAuthCodeParams{
+		CodeHash:            oauth.Hash(code),
+		ExpiresAt:           time.Now().Add(oauthCodeTTL),
+		ClientID:            req.Client.ID,
+		UserID:              dbUser.ID,
+		RedirectUri:         req.RedirectURI,
+		Scopes:              req.Scopes,
+		CodeChallenge:       req.CodeChallenge,
+		CodeChallengeMethod: oauthChallengeMethodS256,
+	})
+	if err != nil {
+		authorizeFailed(w, r, req, err)
+		return
+	}
+
+	logging.FromContext(r.Context()).Info("oauth client authorized", "client_id", req.Client.ClientID, "scope", oauth.FormatScope(req.Scopes))
+
+	redirectAuthorize(w, r, req, url.Values{"code": {code}})
+}
+
+// respondWithOAuthError answers the token endpoints in RFC 6749's format
+// rather than problem+json, since that is what client libraries parse.
+func respondWithOAuthError(w http.ResponseWriter, r *http.Request, err error) {
+	logger := logging.FromContext(r.Context())
+
+	var oauthErr *oauth.Error
+	if !errors.As(err, &oauthErr) {
+		logger.Error("error handling oauth request", "err", err)
+		oauthErr = oauth.NewError(oauth.ErrServerError, "")
+	} else {
+		logger.Info("refusing oauth request", "code", oauthErr.Code, "err", oauthErr.Description)
+	}
+
+	if oauthErr.Code == oauth.ErrInvalidClient {
+		w.Header().Set("WWW-Authenticate", `Basic realm="chirpy"`)
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	respondWithJSON(w, oauthErr.Status(), oauthErr)
+}
+
+// parseOAuthForm reads a token endpoint's form and authenticates the client,
+// by HTTP Basic or client_id and client_secret fields. Public clients only
+// send their client_id.
+func (cfg *apiConfig) parseOAuthForm(w http.ResponseWriter, r *http.Request) (database.OauthClient, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxOAuthFormSize)
+	err := r.ParseForm()
+	if err != nil {
+		return database.OauthClient{}, oauth.NewError(oauth.ErrInvalidRequest, "body must be a url encoded form")
+	}
+
+	clientID, secret, ok := r.BasicAuth()
+	if !ok {
+		clientID = r.PostForm.Get("client_id")
+		secret = r.PostForm.Get("client_secret")
+	}
+
+	client, err := cfg.queries.GetOAuthClient(r.Context(), clientID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return client, oauth.NewError(oauth.ErrInvalidClient, "unknown client")
+		}
+		return client, err
+	}
+
+	if client.SecretHash.Valid != (secret != "") || (client.SecretHash.Valid && !oauth.Equal(secret, client.SecretHash.String)) {
+		return client, oauth.NewError(oauth.ErrInvalidClient, "client authentication failed")
+	}
+
+	return client, nil
+}
+
+func (cfg *apiConfig) oauthToken(w http.ResponseWriter, r *http.Request) {
+	client, err := cfg.parseOAuthForm(w, r)
+	if err != nil {
+		respondWithOAuthError(w, r, err)
+		return
+	}
+
+	switch r.PostForm.Get("grant_type") {
+	case oauthGrantAuthorizationCode:
+		err = cfg.exchangeOAuthCode(w, r, client)
+	case oauthGrantRefreshToken:
+		err = cfg.refreshOAuthGrant(w, r, client)
+	default:
+		err = oauth.NewError(oauth.ErrUnsupportedGrantType, "grant_type must be authorization_code or refresh_token")
+	}
+	if err != nil {
+		respondWithOAuthError(w, r, err)
+	}
+}
+
+func (cfg *apiConfig) exchangeOAuthCode(w http.ResponseWriter, r *http.Request, client database.OauthClient) error {
+	form := r.PostForm
+	codeHash := oauth.Hash(form.Get("code"))
+
+	// the code is consumed and its grant recorded together, so a replay
+	// racing the first exchange still finds the grant to revoke
+	tx, err := cfg.db.BeginTx(r.Context(), nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	qtx := cfg.withTx(tx)
+
+	code, err := qtx.ConsumeOAuthCode(r.Context(), codeHash)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			tx.Rollback()
+			return cfg.oauthCodeReplayed(r.Context(), codeHash)
+		}
+		return err
+	}
+
+	err = checkOAuthCode(code, client, form)
+	if err != nil {
+		// the code is spent even if the rest of the request is wrong, so a
+		// stolen code can't be retried against the verifier
+		commitErr := tx.Commit()
+		if commitErr != nil {
+			return commitErr
+		}
+		return err
+	}
+
+	refreshToken, err := oauth.NewToken("chirpy_rt_")
+	if err != nil {
+		return err
+	}
+
+	grant, err := qtx.CreateOAuthGrant(r.Context(), database.CreateOAuthGrantParams{
+		ClientID:         client.ID,
+		UserID:           code.UserID,
+		Scopes:           code.Scopes,
+		RefreshTokenHash: oauth.Hash(refreshToken),
+		RefreshExpiresAt: time.Now().Add(cfg.refreshTokenTTL),
+	})
+	if err != nil {
+		return err
+	}
+
+	err = qtx.SetOAuthCodeGrant(r.Context(), database.SetOAuthCodeGrantParams{
+		CodeHash: codeHash,
+		GrantID:  uuid.NullUUID{UUID: grant.ID, Valid: true},
+	})
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	logging.SetUserID(r.Context(), grant.UserID)
+
+	return cfg.respondWithOAuthToken(w, client, grant, grant.Scopes, refreshToken)
+}
+
+func checkOAuthCode(code database.OauthCode, client database.OauthClient, form url.Values) error {
+	if code.ClientID != client.ID {
+		return oauth.NewError(oauth.ErrInvalidGrant, "authorization code was issued to another client")
+	}
+	if form.Get("redirect_uri") != code.RedirectUri {
+		return oauth.NewError(oauth.ErrInvalidGrant, "redirect_uri does not match the authorization request")
+	}
+	if !oauth.VerifyPKCE(form.Get("code_verifier"), code.CodeChallenge, code.CodeChallengeMethod) {
+		return oauth.NewError(oauth.ErrInvalidGrant, "code_verifier does not match the code_challenge")
+	}
+	return nil
+}
+
+// oauthCodeReplayed answers a code that can't be exchanged. One that was
+// already exchanged has leaked, so the grant it was exchanged for is revoked
+// along with every token issued under it (RFC 6749 section 4.1.2).
+func (cfg *apiConfig) oauthCodeReplayed(ctx context.Context, codeHash string) error {
+	invalid := oauth.NewError(oauth.ErrInvalidGrant, "authorization code is invalid, expired or already used")
+
+	code, err := cfg.queries.GetSpentOAuthCode(ctx, codeHash)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return invalid
+		}
+		return err
+	}
+	if !code.GrantID.Valid {
+		return invalid
+	}
+
+	err = cfg.queries.RevokeOAuthGrant(ctx, code.GrantID.UUID)
+	if err != nil {
+		return err
+	}
+	logging.FromContext(ctx).Warn("authorization code reused, revoked its grant", "grant_id", code.GrantID.UUID, "user_id", code.UserID)
+
+	return invalid
+}
+
+// oauthRefreshReplayed answers a refresh token that isn't current. One that
+// was already rotated away has leaked, or the client is being impersonated,
+// so the grant is revoked and both parties have to start over.
+func (cfg *apiConfig) oauthRefreshReplayed(ctx context.Context, tokenHash string) error {
+	invalid := oauth.NewError(oauth.ErrInvalidGrant, "refresh token is invalid")
+
+	grant, err := cfg.queries.GetOAuthGrantByPreviousRefreshToken(ctx, sql.NullString{String: tokenHash, Valid: true})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return invalid
+		}
+		return err
+	}
+
+	err = cfg.queries.RevokeOAuthGrant(ctx, grant.ID)
+	if err != nil {
+		return err
+	}
+	logging.FromContext(ctx).Warn("refresh token reused, revoked its grant", "grant_id", grant.ID, "user_id", grant.UserID)
+
+	return invalid
+}
+
+// refreshOAuthGrant swaps a refresh token for a new access token and a new
+// refresh token; the old one stops working.
+func (cfg *apiConfig) refreshOAuthGrant(w http.ResponseWriter, r *http.Request, client database.OauthClient) error {
+	form := r.PostForm
+
+	tokenHash := oauth.Hash(form.Get("refresh_token"))
+	grant, err := cfg.queries.GetOAuthGrantByRefreshToken(r.Context(), tokenHash)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return cfg.oauthRefreshReplayed(r.Context(), tokenHash)
+		}
+		return err
+	}
+
+	if grant.ClientID != client.ID {
+		return oauth.NewError(oauth.ErrInvalidGrant, "refresh token is invalid")
+	}
+	if grant.RevokedAt.Valid {
+		return oauth.NewError(oauth.ErrInvalidGrant, "access has been revoked")
+	}
+	if time.Now().After(grant.RefreshExpiresAt) {
+		return oauth.NewError(oauth.ErrInvalidGrant, "refresh token has expired")
+	}
+
+	logging.SetUserID(r.Context(), grant.UserID)
+
+	// a client may ask for less than it was granted, never more
+	scopes := grant.Scopes
+	if form.Get("scope") != "" {
+		scopes = oauth.ParseScope(form.Get("scope"))
+		if !oauth.Subset(scopes, grant.Scopes) {
+			return oauth.NewError(oauth.ErrInvalidScope, "scope must be a subset of "+oauth.FormatScope(grant.Scopes))
+		}
+	}
+
+	refreshToken, err := oauth.NewToken("chirpy_rt_")
+	if err != nil {
+		return err
+	}
+
+	grant, err = cfg.queries.RotateOAuthRefreshToken(r.Context(), database.RotateOAuthRefreshTokenParams{
+		NewHash:          oauth.Hash(refreshToken),
+		RefreshExpiresAt: time.Now().Add(cfg.refreshTokenTTL),
+		ID:               grant.ID,
+		OldHash:          grant.RefreshTokenHash,
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			// another request rotated it first, which is a replay too
+			return cfg.oauthRefreshReplayed(r.Context(), tokenHash)
+		}
+		return err
+	}
+
+	return cfg.respondWithOAuthToken(w, client, grant, scopes, refreshToken)
+}
+
+func (cfg *apiConfig) respondWithOAuthToken(w http.ResponseWriter, client database.OauthClient, grant database.OauthGrant, scopes []string, refreshToken string) error {
+	scope := oauth.FormatScope(scopes)
+
+	accessToken, err := auth.MakeScopedJWT(grant.UserID, cfg.secret, cfg.accessTokenTTL, grant.ID, client.ClientID, scope)
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	respondWithJSON(w, 200, OAuthToken{
+		AccessToken:  accessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(cfg.accessTokenTTL.Seconds()),
+		RefreshToken: refreshToken,
+		Scope:        scope,
+	})
+	return nil
+}
+
+// lookupOAuthToken finds the grant behind an access or refresh token. claims
+// is nil for refresh tokens.
+func (cfg *apiConfig) lookupOAuthToken(ctx context.Context, token string) (database.OauthGrant, *auth.Claims, error) {
+	claims, err := auth.ParseJWT(token, cfg.secret)
+	if err != nil {
+		grant, err := cfg.queries.GetOAuthGrantByRefreshToken(ctx, oauth.Hash(token))
+		return grant, nil, err
+	}
+
+	// a user's own access tokens are not the client's to inspect
+	if !claims.Scoped() {
+		return database.OauthGrant{}, nil, sql.ErrNoRows
+	}
+
+	grantID, err := uuid.Parse(claims.ID)
+	if err != nil {
+		return database.OauthGrant{}, nil, sql.ErrNoRows
+	}
+
+	grant, err := cfg.queries.GetOAuthGrant(ctx, grantID)
+	return grant, claims, err
+}
+
+// introspectOAuthToken implements RFC 7662. Clients can only inspect their
+// own tokens; anything else is reported inactive.
+func (cfg *apiConfig) introspectOAuthToken(w http.ResponseWriter, r *http.Request) {
+	client, err := cfg.parseOAuthForm(w, r)
+	if err != nil {
+		respondWithOAuthError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+
+	grant, claims, err := cfg.lookupOAuthToken(r.Context(), r.PostForm.Get("token"))
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		respondWithOAuthError(w, r, err)
+		return
+	}
+	if err != nil || grant.ClientID != client.ID || grant.RevokedAt.Valid {
+		respondWithJSON(w, 200, OAuthIntrospection{Active: false})
+		return
+	}
+
+	introspection := OAuthIntrospection{
+		Active:   true,
+		ClientID: client.ClientID,
+		Subject:  grant.UserID.String(),
+	}
+	if claims != nil {
+		introspection.Scope = claims.Scope
+		introspection.TokenType = "Bearer"
+		introspection.ExpiresAt = claims.ExpiresAt.Unix()
+		introspection.IssuedAt = claims.IssuedAt.Unix()
+	} else {
+		if time.Now().After(grant.RefreshExpiresAt) {
+			respondWithJSON(w, 200, OAuthIntrospection{Active: false})
+			return
+		}
+		introspection.Scope = oauth.FormatScope(grant.Scopes)
+		introspection.ExpiresAt = grant.RefreshExpiresAt.Unix()
+		introspection.IssuedAt = grant.UpdatedAt.Unix()
+	}
+
+	respondWithJSON(w, 200, introspection)
+}
+
+// revokeOAuthToken implements RFC 7009. Either token revokes the whole
+// grant, so the user has to consent again. Unknown tokens are not an error.
+func (cfg *apiConfig) revokeOAuthToken(w http.ResponseWriter, r *http.Request) {
+	client, err := cfg.parseOAuthForm(w, r)
+	if err != nil {
+		respondWithOAuthError(w, r, err)
+		return
+	}
+
+	grant, _, err := cfg.lookupOAuthToken(r.Context(), r.PostForm.Get("token"))
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		respondWithOAuthError(w, r, err)
+		return
+	}
+
+	if err == nil && grant.ClientID == client.ID {
+		err = cfg.queries.RevokeOAuthGrant(r.Context(), grant.ID)
+		if err != nil {
+			respondWithOAuthError(w, r, err)
+			return
+		}
+		logging.FromContext(r.Context()).Info("oauth grant revoked", "client_id", client.ClientID, "grant_id", grant.ID)
+	}
+
+	w.WriteHeader(200)
+}
+
+// checkOAuthGrant lets a client's access token through only while its grant
+// stands and only for the scopes it carries.
+func (cfg *apiConfig) checkOAuthGrant(ctx context.Context, claims *auth.Claims, scope string) error {
+	grantID, err := uuid.Parse(claims.ID)
+	if err != nil {
+		return apierror.Unauthorized("invalid or expired token", err)
+	}
+
+	grant, err := cfg.queries.GetOAuthGrant(ctx, grantID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return apierror.Unauthorized("access has been revoked", err)
+		}
+		return err
+	}
+	if grant.RevokedAt.Valid {
+		return apierror.Unauthorized("access has been revoked", nil)
+	}
+
+	if !slices.Contains(oauth.ParseScope(claims.Scope), scope) {
+		return apierror.Forbidden("token lacks the "+scope+" scope", nil)
+	}
+
+	return nil
+}
@@ -0,0 +1,482 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nickemp1996/chirpy/internal/apierror"
+	"github.com/nickemp1996/chirpy/internal/auth"
+	"github.com/nickemp1996/chirpy/internal/config"
+	"github.com/nickemp1996/chirpy/internal/database"
+	"github.com/nickemp1996/chirpy/internal/logging"
+	"github.com/nickemp1996/chirpy/internal/oauth"
+	"github.com/nickemp1996/chirpy/internal/oidc"
+	"github.com/nickemp1996/chirpy/internal/signature"
+)
+
+const (
+	oidcCookieName = "chirpy_oidc"
+	oidcCookiePath = "/api/auth/oidc/"
+	// oidcLoginTTL is how long a user has to sign in at the provider.
+	oidcLoginTTL = 10 * time.Minute
+)
+
+// newOIDCProviders sets up the OpenID Connect providers users can sign in
+// with, keyed by the name in their urls.
+func newOIDCProviders(cfg *config.Config) map[string]*oidc.Provider {
+	providers := map[string]*oidc.Provider{}
+	for _, p := range cfg.OIDCProviders {
+		providers[p.Name] = oidc.New(oidc.Config{
+			Name:         p.Name,
+			Issuer:       p.Issuer,
+			ClientID:     p.ClientID,
+			ClientSecret: p.ClientSecret,
+			RedirectURL:  cfg.PublicURL + oidcCookiePath + p.Name + "/callback",
+		}, nil)
+	}
+	return providers
+}
+
+// oidcLogin is a sign in in progress. It lives in a signed cookie, which
+// ties the callback to the browser that started it.
+type oidcLogin struct {
+	Provider string `json:"provider"`
+	State    string `json:"state"`
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+	// LinkUserID is set when a signed in user is adding the identity to
+	// their account rather than signing in with it.
+	LinkUserID uuid.UUID `json:"link_user_id"`
+}
+
+// oidcCookieKey signs login cookies. It is derived from the secret rather
+// than being the JWT signing key itself, so neither format can pass for the
+// other.
+func (cfg *apiConfig) oidcCookieKey() string {
+	mac := hmac.New(sha256.New, []byte(cfg.secret))
+	mac.Write([]byte("oidc-cookie"))
+	return string(mac.Sum(nil))
+}
+
+func (cfg *apiConfig) setOIDCCookie(w http.ResponseWriter, login oidcLogin) error {
+	body, err := json.Marshal(login)
+	if err != nil {
+		return err
+	}
+	header := signature.Header(cfg.oidcCookieKey(), time.Now(), body)
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcCookieName,
+		Value:    base64.RawURLEncoding.EncodeToString(body) + "." + base64.RawURLEncoding.EncodeToString([]byte(header)),
+		Path:     oidcCookiePath,
+		MaxAge:   int(oidcLoginTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   !cfg.dev,
+		// Lax, so the cookie comes back on the provider's redirect
+		SameSite: http.SameSiteLaxMode,
+	})
+	return nil
+}
+
+func (cfg *apiConfig) readOIDCCookie(r *http.Request) (oidcLogin, error) {
+	login := oidcLogin{}
+
+	cookie, err := r.Cookie(oidcCookieName)
+	if err != nil {
+		return login, err
+	}
+
+	encodedBody, encodedHeader, ok := strings.Cut(cookie.Value, ".")
+	if !ok {
+		return login, signature.ErrMalformed
+	}
+	body, err := base64.RawURLEncoding.DecodeString(encodedBody)
+	if err != nil {
+		return login, signature.ErrMalformed
+	}
+	header, err := base64.RawURLEncoding.DecodeString(encodedHeader)
+	if err != nil {
+		return login, signature.ErrMalformed
+	}
+
+	err = signature.Verify(string(header), body, cfg.oidcCookieKey(), oidcLoginTTL, time.Now())
+	if err != nil {
+		return login, err
+	}
+
+	err = json.Unmarshal(body, &login)
+	return login, err
+}
+
+func (cfg *apiConfig) clearOIDCCookie(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcCookieName,
+		Path:     oidcCookiePath,
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   !cfg.dev,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// beginOIDCLogin stores a new login in the cookie and returns the url to
+// send the user to at the provider.
+func (cfg *apiConfig) beginOIDCLogin(ctx context.Context, w http.ResponseWriter, provider *oidc.Provider, linkUserID uuid.UUID) (string, error) {
+	login := oidcLogin{Provider: provider.Name(), LinkUserID: linkUserID}
+	for _, value := range []*string{&login.State, &login.Nonce, &login.Verifier} {
+		token, err := oauth.NewToken("")
+		if err != nil {
+			return "", err
+		}
+		*value = token
+	}
+
+	authURL, err := provider.AuthCodeURL(ctx, login.State, login.Nonce, oauth.S256Challenge(login.Verifier))
+	if err != nil {
+		return "", err
+	}
+
+	err = cfg.setOIDCCookie(w, login)
+	if err != nil {
+		return "", err
+	}
+
+	return authURL, nil
+}
+
+// startOIDCLogin sends the user to the provider to sign in.
+func (cfg *apiConfig) startOIDCLogin(w http.ResponseWriter, r *http.Request) {
+	provider, ok := cfg.oidcProviders[r.PathValue("provider")]
+	if !ok {
+		respondWithError(w, r, apierror.NotFound("unknown sign in provider", nil))
+		return
+	}
+
+	authURL, err := cfg.beginOIDCLogin(r.Context(), w, provider, uuid.Nil)
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// startIdentityLink begins adding an identity at the provider to the signed
+// in user's account. The page navigates to the returned url; the callback
+// then links the identity instead of signing in with it.
+func (cfg *apiConfig) startIdentityLink(w http.ResponseWriter, r *http.Request) {
+	provider, ok := cfg.oidcProviders[r.PathValue("provider")]
+	if !ok {
+		respondWithError(w, r, apierror.NotFound("unknown sign in provider", nil))
+		return
+	}
+
+	tokenString, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, r, apierror.Unauthorized("token missing", err))
+		return
+	}
+
+	validUser, err := auth.ValidateJWT(tokenString, cfg.secret)
+	if err != nil {
+		respondWithError(w, r, apierror.Unauthorized("invalid or expired token", err))
+		return
+	}
+
+	logging.SetUserID(r.Context(), validUser)
+
+	authURL, err := cfg.beginOIDCLogin(r.Context(), w, provider, validUser)
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	respondWithJSON(w, 200, IdentityLink{URL: authURL})
+}
+
+// oidcCallback finishes a sign in: it checks the provider's answer belongs to
+// the login this browser started, then logs in the user the identity
+// belongs to, creating or linking an account on first use.
+func (cfg *apiConfig) oidcCallback(w http.ResponseWriter, r *http.Request) {
+	provider, ok := cfg.oidcProviders[r.PathValue("provider")]
+	if !ok {
+		respondWithError(w, r, apierror.NotFound("unknown sign in provider", nil))
+		return
+	}
+
+	login, err := cfg.readOIDCCookie(r)
+	cfg.clearOIDCCookie(w)
+	if err != nil || login.Provider != provider.Name() {
+		respondWithError(w, r, apierror.Unauthorized("sign in expired or was started in another browser, please try again", err))
+		return
+	}
+
+	query := r.URL.Query()
+	if subtle.ConstantTimeCompare([]byte(query.Get("state")), []byte(login.State)) != 1 {
+		respondWithError(w, r, apierror.Unauthorized("sign in state does not match", nil))
+		return
+	}
+	if query.Get("error") != "" {
+		respondWithError(w, r, apierror.Unauthorized("sign in was canceled or refused by "+provider.Name(), errors.New(query.Get("error"))))
+		return
+	}
+
+	identity, err := provider.Exchange(r.Context(), query.Get("code"), login.Verifier, login.Nonce)
+	if err != nil {
+		respondWithError(w, r, apierror.Unauthorized("sign in with "+provider.Name()+" could not be verified", err))
+		return
+	}
+
+	if login.LinkUserID != uuid.Nil {
+		dbIdentity, err := cfg.linkIdentity(r.Context(), login.LinkUserID, provider.Name(), identity)
+		if err != nil {
+			respondWithError(w, r, err)
+			return
+		}
+		respondWithJSON(w, 201, identityFromDB(dbIdentity))
+		return
+	}
+
+	dbUser, err := cfg.userForIdentity(r.Context(), provider.Name(), identity)
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	cfg.respondWithLogin(w, r, dbUser)
+}
+
+// linkIdentity adds an identity to the account that asked for it. The user
+// proved they own both, so unlike signing in the emails don't have to match.
+func (cfg *apiConfig) linkIdentity(ctx context.Context, userID uuid.UUID, provider string, identity oidc.Identity) (database.UserIdentity, error) {
+	logging.SetUserID(ctx, userID)
+
+	dbIdentity, err := cfg.queries.CreateUserIdentity(ctx, database.CreateUserIdentityParams{
+		UserID:   userID,
+		Provider: provider,
+		Subject:  identity.Subject,
+		Email:    identity.Email,
+	})
+	if err != nil {
+		if _, ok := apierror.UniqueViolation(err); ok {
+			err = apierror.Conflict("this "+provider+" account is already linked to a Chirpy account", err)
+		}
+		return database.UserIdentity{}, err
+	}
+
+	logging.FromContext(ctx).Info("linked external identity", "provider", provider, "user_id", userID)
+
+	return dbIdentity, nil
+}
+
+// userForIdentity finds the user an external identity signs in as. An
+// identity seen for the first time gets a new account without a password,
+// or is linked to the account with its verified email if that account only
+// signs in through providers too. Chirpy doesn't verify emails at signup, so
+// an account with a password or passkey may not belong to the email's owner;
+// its user has to sign in and link the identity themselves.
+func (cfg *apiConfig) userForIdentity(ctx context.Context, provider string, identity oidc.Identity) (database.User, error) {
+	dbIdentity, err := cfg.queries.GetUserIdentity(ctx, database.GetUserIdentityParams{
+		Provider: provider,
+		Subject:  identity.Subject,
+	})
+	if err == nil {
+		err = cfg.queries.TouchUserIdentity(ctx, database.TouchUserIdentityParams{
+			ID:    dbIdentity.ID,
+			Email: identity.Email,
+		})
+		if err != nil {
+			return database.User{}, err
+		}
+		return cfg.queries.GetUser(ctx, dbIdentity.UserID)
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return database.User{}, err
+	}
+
+	// an unverified email could be anyone's, so it must not reach an account
+	if !identity.EmailVerified {
+		return database.User{}, apierror.Forbidden(provider+" did not share a verified email address", nil)
+	}
+	email, err := normalizeEmail(identity.Email)
+	if err != nil {
+		return database.User{}, apierror.Forbidden(provider+" did not share a usable email address", err)
+	}
+
+	tx, err := cfg.db.BeginTx(ctx, nil)
+	if err != nil {
+		return database.User{}, err
+	}
+	defer tx.Rollback()
+	qtx := cfg.withTx(tx)
+
+	created := false
+	dbUser, err := qtx.GetPassword(ctx, email)
+	if errors.Is(err, sql.ErrNoRows) {
+		// no password until they set one
+		dbUser, err = qtx.CreateUser(ctx, database.CreateUserParams{
+			Email: email,
+		})
+		created = true
+	}
+	if err != nil {
+		return database.User{}, err
+	}
+
+	if !created {
+		passkeys, err := qtx.CountUserWebAuthnCredentials(ctx, dbUser.ID)
+		if err != nil {
+			return database.User{}, err
+		}
+		if dbUser.HashedPassword.Valid || passkeys > 0 {
+			return database.User{}, apierror.Conflict("an account already uses this email address, sign in to it and link "+provider+" from your settings", nil)
+		}
+	}
+
+	_, err = qtx.CreateUserIdentity(ctx, database.CreateUserIdentityParams{
+		UserID:   dbUser.ID,
+		Provider: provider,
+		Subject:  identity.Subject,
+		Email:    identity.Email,
+	})
+	if err != nil {
+		if _, ok := apierror.UniqueViolation(err); ok {
+			err = apierror.Conflict("this account is already being linked, please try again", err)
+		}
+		return database.User{}, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return database.User{}, err
+	}
+
+	logging.FromContext(ctx).Info("linked external identity", "provider", provider, "user_id", dbUser.ID, "new_user", created)
+
+	if created {
+		cfg.metrics.signups.Inc()
+		cfg.publishEvent(ctx, eventUserCreated, struct {
+			ID        uuid.UUID `json:"id"`
+			CreatedAt time.Time `json:"created_at"`
+		}{dbUser.ID, dbUser.CreatedAt})
+	}
+
+	return dbUser, nil
+}
+
+func identityFromDB(dbIdentity database.UserIdentity) Identity {
+	identity := Identity{
+		ID:        dbIdentity.ID,
+		CreatedAt: dbIdentity.CreatedAt,
+		Provider:  dbIdentity.Provider,
+		Email:     dbIdentity.Email,
+	}
+	if dbIdentity.LastLoginAt.Valid {
+		identity.LastLoginAt = &dbIdentity.LastLoginAt.Time
+	}
+	return identity
+}
+
+func (cfg *apiConfig) getUserIdentities(w http.ResponseWriter, r *http.Request) {
+	tokenString, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, r, apierror.Unauthorized("token missing", err))
+		return
+	}
+
+	validUser, err := auth.ValidateJWT(tokenString, cfg.secret)
+	if err != nil {
+		respondWithError(w, r, apierror.Unauthorized("invalid or expired token", err))
+		return
+	}
+
+	logging.SetUserID(r.Context(), validUser)
+
+	dbIdentities, err := cfg.queries.GetUserIdentities(r.Context(), validUser)
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	identities := make([]Identity, len(dbIdentities))
+	for i, dbIdentity := range dbIdentities {
+		identities[i] = identityFromDB(dbIdentity)
+	}
+
+	respondWithJSON(w, 200, identities)
+}
+
+// unlinkUserIdentity stops an external identity signing in as the user. The
+// last way into an account can't be removed.
+func (cfg *apiConfig) unlinkUserIdentity(w http.ResponseWriter, r *http.Request) {
+	identityID, err := uuid.Parse(r.PathValue("identityID"))
+	if err != nil {
+		respondWithError(w, r, apierror.InvalidID("identityID must be a UUID", err))
+		return
+	}
+
+	tokenString, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, r, apierror.Unauthorized("token missing", err))
+		return
+	}
+
+	validUser, err := auth.ValidateJWT(tokenString, cfg.secret)
+	if err != nil {
+		respondWithError(w, r, apierror.Unauthorized("invalid or expired token", err))
+		return
+	}
+
+	logging.SetUserID(r.Context(), validUser)
+
+	tx, err := cfg.db.BeginTx(r.Context(), nil)
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.withTx(tx)
+
+	dbUser, err := lockUser(r.Context(), qtx, validUser)
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	err = requireOtherSignIn(r.Context(), qtx, dbUser)
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	deleted, err := qtx.DeleteUserIdentity(r.Context(), database.DeleteUserIdentityParams{
+		ID:     identityID,
+		UserID: validUser,
+	})
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+	if deleted == 0 {
+		respondWithError(w, r, apierror.NotFound("identity not found", nil))
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(204)
+}
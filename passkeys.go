@@ -0,0 +1,599 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/nickemp1996/chirpy/internal/apierror"
+	"github.com/nickemp1996/chirpy/internal/auth"
+	"github.com/nickemp1996/chirpy/internal/config"
+	"github.com/nickemp1996/chirpy/internal/database"
+	"github.com/nickemp1996/chirpy/internal/httpjson"
+	"github.com/nickemp1996/chirpy/internal/logging"
+	"github.com/nickemp1996/chirpy/internal/webauthn"
+)
+
+const (
+	ceremonyRegistration   = "registration"
+	ceremonyAuthentication = "authentication"
+
+	// webauthnTimeout is how long the browser gives the user, and how long
+	// the challenge stays good.
+	webauthnTimeout          = 5 * time.Minute
+	maxPasskeys              = 10
+	maxPasskeyNameLength     = 50
+	maxPasskeyBodySize       = 16 << 10
+	defaultPasskeyName       = "Passkey"
+	userVerificationRequired = "required"
+)
+
+// newRelyingParty registers passkeys to the host users reach the server on.
+func newRelyingParty(cfg *config.Config) webauthn.RelyingParty {
+	// PUBLIC_URL is validated as an http(s) url when the config loads
+	u, _ := url.Parse(cfg.PublicURL)
+	return webauthn.RelyingParty{
+		ID:     u.Hostname(),
+		Name:   "Chirpy",
+		Origin: u.Scheme + "://" + u.Host,
+	}
+}
+
+func passkeyFromDB(dbCredential database.WebauthnCredential) Passkey {
+	passkey := Passkey{
+		ID:         dbCredential.ID,
+		CreatedAt:  dbCredential.CreatedAt,
+		Name:       dbCredential.Name,
+		Transports: dbCredential.Transports,
+	}
+	if dbCredential.LastUsedAt.Valid {
+		passkey.LastUsedAt = &dbCredential.LastUsedAt.Time
+	}
+	return passkey
+}
+
+// webauthnChallengeKey signs challenges. It is derived from the secret for
+// the same reason as oidcCookieKey.
+func (cfg *apiConfig) webauthnChallengeKey() []byte {
+	mac := hmac.New(sha256.New, []byte(cfg.secret))
+	mac.Write([]byte("webauthn-challenge"))
+	return mac.Sum(nil)
+}
+
+// webauthnChallengeBinding is what a challenge is issued for. userID is
+// only set for registration, sign ins find the user from the passkey.
+func webauthnChallengeBinding(ceremony string, userID uuid.NullUUID) string {
+	if !userID.Valid {
+		return ceremony
+	}
+	return ceremony + ":" + userID.UUID.String()
+}
+
+// newWebAuthnChallenge issues a signed challenge for one ceremony. Nothing is
+// stored until it is used, so asking for challenges costs the server nothing.
+func (cfg *apiConfig) newWebAuthnChallenge(ceremony string, userID uuid.NullUUID) (string, error) {
+	return webauthn.SignChallenge(cfg.webauthnChallengeKey(), webauthnChallengeBinding(ceremony, userID), time.Now().Add(webauthnTimeout))
+}
+
+// checkWebAuthnChallenge finds the challenge clientDataJSON answers and
+// checks it was issued for this ceremony and user and is still good.
+func (cfg *apiConfig) checkWebAuthnChallenge(clientDataJSON []byte, ceremony string, userID uuid.NullUUID) (string, time.Time, error) {
+	clientData, err := webauthn.ParseClientData(clientDataJSON)
+	if err != nil {
+		return "", time.Time{}, apierror.BadRequest("clientDataJSON could not be read", err)
+	}
+
+	expiresAt, err := webauthn.CheckChallenge(cfg.webauthnChallengeKey(), webauthnChallengeBinding(ceremony, userID), clientData.Challenge, time.Now())
+	if err != nil {
+		return "", time.Time{}, apierror.Unauthorized("challenge expired or was issued for something else, please try again", err)
+	}
+	return clientData.Challenge, expiresAt, nil
+}
+
+// useWebAuthnChallenge spends a challenge whose response has been verified,
+// so the response can't be replayed. Only verified responses get this far,
+// which keeps the table to real registrations and sign ins.
+func (cfg *apiConfig) useWebAuthnChallenge(ctx context.Context, challenge string, expiresAt time.Time, ceremony string, userID uuid.NullUUID) error {
+	// a spent challenge only needs remembering until it would have expired
+	err := cfg.queries.DeleteExpiredWebAuthnChallenges(ctx)
+	if err != nil {
+		return err
+	}
+
+	used, err := cfg.queries.UseWebAuthnChallenge(ctx, database.UseWebAuthnChallengeParams{
+		Challenge: challenge,
+		ExpiresAt: expiresAt,
+		Ceremony:  ceremony,
+		UserID:    userID,
+	})
+	if err != nil {
+		return err
+	}
+	if used == 0 {
+		return apierror.Unauthorized("challenge already used, please try again", nil)
+	}
+	return nil
+}
+
+// beginPasskeyRegistration returns the options for navigator.credentials.create().
+func (cfg *apiConfig) beginPasskeyRegistration(w http.ResponseWriter, r *http.Request) {
+	tokenString, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, r, apierror.Unauthorized("token missing", err))
+		return
+	}
+
+	validUser, err := auth.ValidateJWT(tokenString, cfg.secret)
+	if err != nil {
+		respondWithError(w, r, apierror.Unauthorized("invalid or expired token", err))
+		return
+	}
+
+	logging.SetUserID(r.Context(), validUser)
+
+	dbUser, err := cfg.queries.GetUser(r.Context(), validUser)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, r, apierror.NotFound("user not found", err))
+			return
+		}
+		respondWithError(w, r, err)
+		return
+	}
+
+	dbCredentials, err := cfg.queries.GetUserWebAuthnCredentials(r.Context(), validUser)
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+	if len(dbCredentials) >= maxPasskeys {
+		respondWithError(w, r, apierror.Conflict(fmt.Sprintf("an account can have at most %d passkeys", maxPasskeys), nil))
+		return
+	}
+
+	challenge, err := cfg.newWebAuthnChallenge(ceremonyRegistration, uuid.NullUUID{UUID: validUser, Valid: true})
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	options := PasskeyCreationOptions{
+		Challenge: challenge,
+		RelyingParty: PasskeyRelyingParty{
+			ID:   cfg.relyingParty.ID,
+			Name: cfg.relyingParty.Name,
+		},
+		User: PasskeyUser{
+			ID:          webauthn.Base64URL(validUser[:]),
+			Name:        dbUser.Email,
+			DisplayName: dbUser.DisplayName,
+		},
+		Timeout:     webauthnTimeout.Milliseconds(),
+		Attestation: "none",
+		AuthenticatorSelection: PasskeyAuthenticatorSelection{
+			ResidentKey:      "required",
+			UserVerification: userVerificationRequired,
+		},
+		ExcludeCredentials: []PasskeyDescriptor{},
+	}
+	if options.User.DisplayName == "" {
+		options.User.DisplayName = dbUser.Email
+	}
+	for _, alg := range webauthn.Algorithms {
+		options.PubKeyCredParams = append(options.PubKeyCredParams, PasskeyCredentialParameter{Type: "public-key", Alg: alg})
+	}
+	// the authenticator refuses to register a second passkey for the same account
+	for _, dbCredential := range dbCredentials {
+		options.ExcludeCredentials = append(options.ExcludeCredentials, PasskeyDescriptor{
+			Type:       "public-key",
+			ID:         dbCredential.CredentialID,
+			Transports: dbCredential.Transports,
+		})
+	}
+
+	respondWithJSON(w, 200, PasskeyOptions{PublicKey: options})
+}
+
+// finishPasskeyRegistration stores the passkey navigator.credentials.create()
+// made. The body is the PublicKeyCredential's toJSON(), plus a name.
+func (cfg *apiConfig) finishPasskeyRegistration(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Name     string             `json:"name"`
+		RawID    webauthn.Base64URL `json:"rawId"`
+		Response struct {
+			ClientDataJSON    webauthn.Base64URL `json:"clientDataJSON"`
+			AttestationObject webauthn.Base64URL `json:"attestationObject"`
+			Transports        []string           `json:"transports"`
+		} `json:"response"`
+	}
+
+	params := parameters{}
+	err := httpjson.Decode(w, r, &params, maxPasskeyBodySize)
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	tokenString, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, r, apierror.Unauthorized("token missing", err))
+		return
+	}
+
+	validUser, err := auth.ValidateJWT(tokenString, cfg.secret)
+	if err != nil {
+		respondWithError(w, r, apierror.Unauthorized("invalid or expired token", err))
+		return
+	}
+
+	logging.SetUserID(r.Context(), validUser)
+
+	name := strings.TrimSpace(params.Name)
+	if name == "" {
+		name = defaultPasskeyName
+	}
+	if utf8.RuneCountInString(name) > maxPasskeyNameLength {
+		respondWithError(w, r, apierror.Field("name", fmt.Sprintf("must be at most %d characters", maxPasskeyNameLength)))
+		return
+	}
+
+	userID := uuid.NullUUID{UUID: validUser, Valid: true}
+	challenge, expiresAt, err := cfg.checkWebAuthnChallenge(params.Response.ClientDataJSON, ceremonyRegistration, userID)
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	credential, err := cfg.relyingParty.VerifyRegistration(params.Response.ClientDataJSON, params.Response.AttestationObject, challenge)
+	if err != nil {
+		respondWithError(w, r, apierror.BadRequest("passkey could not be verified", err))
+		return
+	}
+
+	err = cfg.useWebAuthnChallenge(r.Context(), challenge, expiresAt, ceremonyRegistration, userID)
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	count, err := cfg.queries.CountUserWebAuthnCredentials(r.Context(), validUser)
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+	if count >= maxPasskeys {
+		respondWithError(w, r, apierror.Conflict(fmt.Sprintf("an account can have at most %d passkeys", maxPasskeys), nil))
+		return
+	}
+
+	transports := params.Response.Transports
+	if transports == nil {
+		transports = []string{}
+	}
+
+	dbCredential, err := cfg.queries.CreateWebAuthnCredential(r.Context(), database.CreateWebAuthnCredentialParams{
+		UserID:       validUser,
+		Name:         name,
+		CredentialID: credential.ID,
+		PublicKey:    credential.PublicKey,
+		SignCount:    int64(credential.SignCount),
+		Transports:   transports,
+	})
+	if err != nil {
+		if _, ok := apierror.UniqueViolation(err); ok {
+			err = apierror.Conflict("this passkey is already registered", err)
+		}
+		respondWithError(w, r, err)
+		return
+	}
+
+	respondWithJSON(w, 201, passkeyFromDB(dbCredential))
+}
+
+// beginPasskeyLogin returns the options for navigator.credentials.get().
+// Passkeys are discoverable, so the user picks theirs without typing an
+// email first.
+func (cfg *apiConfig) beginPasskeyLogin(w http.ResponseWriter, r *http.Request) {
+	challenge, err := cfg.newWebAuthnChallenge(ceremonyAuthentication, uuid.NullUUID{})
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	respondWithJSON(w, 200, PasskeyOptions{PublicKey: PasskeyRequestOptions{
+		Challenge:        challenge,
+		RelyingPartyID:   cfg.relyingParty.ID,
+		Timeout:          webauthnTimeout.Milliseconds(),
+		UserVerification: userVerificationRequired,
+		AllowCredentials: []PasskeyDescriptor{},
+	}})
+}
+
+// finishPasskeyLogin checks the assertion navigator.credentials.get() made
+// and logs the user in, just like a password would.
+func (cfg *apiConfig) finishPasskeyLogin(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		RawID    webauthn.Base64URL `json:"rawId"`
+		Response struct {
+			ClientDataJSON    webauthn.Base64URL `json:"clientDataJSON"`
+			AuthenticatorData webauthn.Base64URL `json:"authenticatorData"`
+			Signature         webauthn.Base64URL `json:"signature"`
+			UserHandle        webauthn.Base64URL `json:"userHandle"`
+		} `json:"response"`
+	}
+
+	params := parameters{}
+	err := httpjson.Decode(w, r, &params, maxPasskeyBodySize)
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	challenge, expiresAt, err := cfg.checkWebAuthnChallenge(params.Response.ClientDataJSON, ceremonyAuthentication, uuid.NullUUID{})
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	dbCredential, err := cfg.queries.GetWebAuthnCredential(r.Context(), params.RawID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			cfg.metrics.loginsFailed.Inc()
+			respondWithError(w, r, apierror.New(http.StatusUnauthorized, apierror.CodeInvalidCredentials, "passkey not recognised", err))
+			return
+		}
+		respondWithError(w, r, err)
+		return
+	}
+
+	// the user handle is the user id we registered the passkey under
+	if len(params.Response.UserHandle) > 0 && string(params.Response.UserHandle) != string(dbCredential.UserID[:]) {
+		cfg.metrics.loginsFailed.Inc()
+		respondWithError(w, r, apierror.New(http.StatusUnauthorized, apierror.CodeInvalidCredentials, "passkey not recognised", nil))
+		return
+	}
+
+	signCount, err := cfg.relyingParty.VerifyAssertion(
+		params.Response.ClientDataJSON,
+		params.Response.AuthenticatorData,
+		params.Response.Signature,
+		challenge,
+		dbCredential.PublicKey,
+		uint32(dbCredential.SignCount),
+	)
+	if err != nil {
+		cfg.metrics.loginsFailed.Inc()
+		if errors.Is(err, webauthn.ErrCloned) {
+			logging.FromContext(r.Context()).Warn("passkey may have been cloned", "user_id", dbCredential.UserID, "passkey_id", dbCredential.ID)
+		}
+		respondWithError(w, r, apierror.New(http.StatusUnauthorized, apierror.CodeInvalidCredentials, "passkey could not be verified", err))
+		return
+	}
+
+	err = cfg.useWebAuthnChallenge(r.Context(), challenge, expiresAt, ceremonyAuthentication, uuid.NullUUID{})
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	updated, err := cfg.queries.UpdateWebAuthnSignCount(r.Context(), database.UpdateWebAuthnSignCountParams{
+		NewSignCount: int64(signCount),
+		ID:           dbCredential.ID,
+		OldSignCount: dbCredential.SignCount,
+	})
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+	// another sign in moved the counter since we read it, so this one's
+	// count can't be trusted to have gone up
+	if updated == 0 {
+		cfg.metrics.loginsFailed.Inc()
+		logging.FromContext(r.Context()).Warn("passkey may have been cloned", "user_id", dbCredential.UserID, "passkey_id", dbCredential.ID)
+		respondWithError(w, r, apierror.New(http.StatusUnauthorized, apierror.CodeInvalidCredentials, "passkey could not be verified", webauthn.ErrCloned))
+		return
+	}
+
+	dbUser, err := cfg.queries.GetUser(r.Context(), dbCredential.UserID)
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	cfg.respondWithLogin(w, r, dbUser)
+}
+
+func (cfg *apiConfig) getPasskeys(w http.ResponseWriter, r *http.Request) {
+	tokenString, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, r, apierror.Unauthorized("token missing", err))
+		return
+	}
+
+	validUser, err := auth.ValidateJWT(tokenString, cfg.secret)
+	if err != nil {
+		respondWithError(w, r, apierror.Unauthorized("invalid or expired token", err))
+		return
+	}
+
+	logging.SetUserID(r.Context(), validUser)
+
+	dbCredentials, err := cfg.queries.GetUserWebAuthnCredentials(r.Context(), validUser)
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	passkeys := make([]Passkey, len(dbCredentials))
+	for i, dbCredential := range dbCredentials {
+		passkeys[i] = passkeyFromDB(dbCredential)
+	}
+
+	respondWithJSON(w, 200, passkeys)
+}
+
+func (cfg *apiConfig) deletePasskey(w http.ResponseWriter, r *http.Request) {
+	passkeyID, err := uuid.Parse(r.PathValue("passkeyID"))
+	if err != nil {
+		respondWithError(w, r, apierror.InvalidID("passkeyID must be a UUID", err))
+		return
+	}
+
+	tokenString, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, r, apierror.Unauthorized("token missing", err))
+		return
+	}
+
+	validUser, err := auth.ValidateJWT(tokenString, cfg.secret)
+	if err != nil {
+		respondWithError(w, r, apierror.Unauthorized("invalid or expired token", err))
+		return
+	}
+
+	logging.SetUserID(r.Context(), validUser)
+
+	tx, err := cfg.db.BeginTx(r.Context(), nil)
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.withTx(tx)
+
+	dbUser, err := lockUser(r.Context(), qtx, validUser)
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	err = requireOtherSignIn(r.Context(), qtx, dbUser)
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	deleted, err := qtx.DeleteWebAuthnCredential(r.Context(), database.DeleteWebAuthnCredentialParams{
+		ID:     passkeyID,
+		UserID: validUser,
+	})
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+	if deleted == 0 {
+		respondWithError(w, r, apierror.NotFound("passkey not found", nil))
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(204)
+}
+
+// removePassword leaves the account to its passkeys and sign in providers.
+func (cfg *apiConfig) removePassword(w http.ResponseWriter, r *http.Request) {
+	tokenString, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, r, apierror.Unauthorized("token missing", err))
+		return
+	}
+
+	validUser, err := auth.ValidateJWT(tokenString, cfg.secret)
+	if err != nil {
+		respondWithError(w, r, apierror.Unauthorized("invalid or expired token", err))
+		return
+	}
+
+	logging.SetUserID(r.Context(), validUser)
+
+	tx, err := cfg.db.BeginTx(r.Context(), nil)
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.withTx(tx)
+
+	dbUser, err := lockUser(r.Context(), qtx, validUser)
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+	if !dbUser.HashedPassword.Valid {
+		respondWithError(w, r, apierror.Conflict("this account has no password", nil))
+		return
+	}
+
+	err = requireOtherSignIn(r.Context(), qtx, dbUser)
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	dbUser, err = qtx.RemoveUserPassword(r.Context(), validUser)
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	respondWithJSON(w, 200, userFromDB(dbUser))
+}
+
+// lockUser locks the user's row for the rest of the transaction. Removing a
+// way to sign in takes the lock first, so two removals can't each count the
+// other's method as still there.
+func lockUser(ctx context.Context, qtx *database.Queries, userID uuid.UUID) (database.User, error) {
+	dbUser, err := qtx.GetUserForUpdate(ctx, userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return dbUser, apierror.NotFound("user not found", err)
+		}
+		return dbUser, err
+	}
+	return dbUser, nil
+}
+
+// requireOtherSignIn is checked before removing one of the user's ways to
+// sign in, so an account is never left with none. dbUser must be locked by
+// lockUser in the same transaction.
+func requireOtherSignIn(ctx context.Context, qtx *database.Queries, dbUser database.User) error {
+	identities, err := qtx.CountUserIdentities(ctx, dbUser.ID)
+	if err != nil {
+		return err
+	}
+
+	passkeys, err := qtx.CountUserWebAuthnCredentials(ctx, dbUser.ID)
+	if err != nil {
+		return err
+	}
+
+	methods := identities + passkeys
+	if dbUser.HashedPassword.Valid {
+		methods++
+	}
+	if methods <= 1 {
+		return apierror.Conflict("this is your last way to sign in, add a password, passkey or sign in provider first", nil)
+	}
+
+	return nil
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/nickemp1996/chirpy/internal/apierror"
+	"github.com/nickemp1996/chirpy/internal/auth"
+	"github.com/nickemp1996/chirpy/internal/database"
+	"github.com/nickemp1996/chirpy/internal/httpjson"
+	"github.com/nickemp1996/chirpy/internal/logging"
+)
+
+const (
+	maxDisplayNameLength = 50
+	maxBioLength         = 160
+)
+
+var handlePattern = regexp.MustCompile(`^[a-z0-9_]{3,30}$`)
+
+func userFromDB(dbUser database.User) User {
+	return User{
+		ID:          dbUser.ID,
+		CreatedAt:   dbUser.CreatedAt,
+		UpdatedAt:   dbUser.UpdatedAt,
+		Email:       dbUser.Email,
+		IsChirpyRed: dbUser.IsChirpyRed,
+		Handle:      dbUser.Handle.String,
+		DisplayName: dbUser.DisplayName,
+		Bio:         dbUser.Bio,
+		AvatarURL:   dbUser.AvatarUrl,
+		HasPassword: dbUser.HashedPassword.Valid,
+	}
+}
+
+func (cfg *apiConfig) profileFromDB(r *http.Request, dbUser database.User) (Profile, error) {
+	stats, err := cfg.queries.GetUserStats(r.Context(), dbUser.ID)
+	if err != nil {
+		return Profile{}, err
+	}
+
+	profile := Profile{
+		ID:             dbUser.ID,
+		CreatedAt:      dbUser.CreatedAt,
+		Handle:         dbUser.Handle.String,
+		DisplayName:    dbUser.DisplayName,
+		Bio:            dbUser.Bio,
+		AvatarURL:      dbUser.AvatarUrl,
+		IsChirpyRed:    dbUser.IsChirpyRed,
+		Badge:          cfg.entitlements(dbUser).Badge,
+		ChirpCount:     stats.ChirpCount,
+		FollowerCount:  stats.FollowerCount,
+		FollowingCount: stats.FollowingCount,
+	}
+
+	return profile, nil
+}
+
+func (cfg *apiConfig) respondWithProfile(w http.ResponseWriter, r *http.Request, dbUser database.User) {
+	profile, err := cfg.profileFromDB(r, dbUser)
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	respondWithJSON(w, 200, profile)
+}
+
+func (cfg *apiConfig) getUserProfile(w http.ResponseWriter, r *http.Request) {
+	userID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, r, apierror.InvalidID("userID must be a UUID", err))
+		return
+	}
+
+	dbUser, err := cfg.queries.GetUser(r.Context(), userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, r, apierror.NotFound("user not found", err))
+			return
+		} else {
+			respondWithError(w, r, err)
+			return
+		}
+	}
+
+	cfg.respondWithProfile(w, r, dbUser)
+}
+
+func (cfg *apiConfig) getUserProfileByHandle(w http.ResponseWriter, r *http.Request) {
+	handle := strings.ToLower(r.PathValue("handle"))
+	if !handlePattern.MatchString(handle) {
+		respondWithError(w, r, apierror.NotFound("user not found", nil))
+		return
+	}
+
+	dbUser, err := cfg.queries.GetUserByHandle(r.Context(), sql.NullString{String: handle, Valid: true})
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, r, apierror.NotFound("user not found", err))
+			return
+		} else {
+			respondWithError(w, r, err)
+			return
+		}
+	}
+
+	cfg.respondWithProfile(w, r, dbUser)
+}
+
+func (cfg *apiConfig) updateUserProfile(w http.ResponseWriter, r *http.Request) {
+	tokenString, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, r, apierror.Unauthorized("token missing", err))
+		return
+	}
+
+	validUser, err := auth.ValidateJWT(tokenString, cfg.secret)
+	if err != nil {
+		respondWithError(w, r, apierror.Unauthorized("invalid or expired token", err))
+		return
+	}
+
+	logging.SetUserID(r.Context(), validUser)
+
+	// nil fields are left untouched, so clients only send what they change
+	type parameters struct {
+		Handle      *string `json:"handle"`
+		DisplayName *string `json:"display_name"`
+		Bio         *string `json:"bio"`
+		AvatarURL   *string `json:"avatar_url"`
+	}
+
+	params := parameters{}
+	err = httpjson.Decode(w, r, &params, maxProfileBodySize)
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	dbUser, err := cfg.queries.GetUser(r.Context(), validUser)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, r, apierror.NotFound("user not found", err))
+			return
+		} else {
+			respondWithError(w, r, err)
+			return
+		}
+	}
+
+	profileParams := database.UpdateUserProfileParams{
+		ID:          dbUser.ID,
+		Handle:      dbUser.Handle,
+		DisplayName: dbUser.DisplayName,
+		Bio:         dbUser.Bio,
+		AvatarUrl:   dbUser.AvatarUrl,
+	}
+
+	if params.Handle != nil {
+		handle := strings.ToLower(strings.TrimSpace(*params.Handle))
+		if handle == "" {
+			profileParams.Handle = sql.NullString{}
+		} else if !handlePattern.MatchString(handle) {
+			respondWithError(w, r, apierror.Field("handle", "must be 3-30 characters of a-z, 0-9 or _"))
+			return
+		} else {
+			profileParams.Handle = sql.NullString{String: handle, Valid: true}
+		}
+	}
+
+	if params.DisplayName != nil {
+		displayName := strings.TrimSpace(*params.DisplayName)
+		if utf8.RuneCountInString(displayName) > maxDisplayNameLength {
+			respondWithError(w, r, apierror.Field("display_name", fmt.Sprintf("must be at most %d characters", maxDisplayNameLength)))
+			return
+		}
+		profileParams.DisplayName = displayName
+	}
+
+	if params.Bio != nil {
+		bio := strings.TrimSpace(*params.Bio)
+		if utf8.RuneCountInString(bio) > maxBioLength {
+			respondWithError(w, r, apierror.Field("bio", fmt.Sprintf("must be at most %d characters", maxBioLength)))
+			return
+		}
+		profileParams.Bio = bio
+	}
+
+	if params.AvatarURL != nil {
+		avatarURL := strings.TrimSpace(*params.AvatarURL)
+		if avatarURL != "" && !strings.HasPrefix(avatarURL, mediaURL("avatars/")) {
+			u, err := url.Parse(avatarURL)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				respondWithError(w, r, apierror.Field("avatar_url", "must be an absolute http(s) url"))
+				return
+			}
+		}
+		profileParams.AvatarUrl = avatarURL
+	}
+
+	dbUser, err = cfg.queries.UpdateUserProfile(r.Context(), profileParams)
+	if err != nil {
+		if _, ok := apierror.UniqueViolation(err); ok {
+			respondWithError(w, r, apierror.Conflict("handle already taken", err))
+			return
+		}
+		respondWithError(w, r, err)
+		return
+	}
+
+	cfg.respondWithProfile(w, r, dbUser)
+}
@@ -1,18 +1,120 @@
 package main
 
 import (
-	"log"
+	"context"
+	"database/sql"
+	"fmt"
 	"net/http"
+	"time"
 
 	_ "github.com/lib/pq"
+	"github.com/nickemp1996/chirpy/internal/logging"
+	"github.com/nickemp1996/chirpy/internal/migrate"
 )
 
+const readinessTimeout = 2 * time.Second
+
+type dependencyStatus struct {
+	Status    string  `json:"status"`
+	LatencyMS float64 `json:"latency_ms,omitempty"`
+	Version   *int64  `json:"version,omitempty"`
+	Expected  int64   `json:"expected,omitempty"`
+	// Error is logged, not returned, since it can name hosts and users
+	Error string `json:"-"`
+}
+
+type readinessReport struct {
+	Status string                      `json:"status"`
+	Checks map[string]dependencyStatus `json:"checks,omitempty"`
+}
+
 func readinessEndpoint(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
 	w.WriteHeader(http.StatusOK)
 	message := "OK"
 	_, err := w.Write([]byte(message))
 	if err != nil {
-		log.Printf("Error writing response: %v", err)
+		logging.FromContext(r.Context()).Error("error writing response", "err", err)
 	}
 }
+
+// livez only says the process is up and serving; it never touches
+// dependencies, so a database outage doesn't get every instance restarted.
+func (cfg *apiConfig) livez(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+	respondWithJSON(w, http.StatusOK, readinessReport{Status: "ok"})
+}
+
+// readyz reports whether this instance should receive traffic: the database
+// answers, its schema matches this build, and we aren't shutting down.
+func (cfg *apiConfig) readyz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+
+	if cfg.shuttingDown.Load() {
+		respondWithJSON(w, http.StatusServiceUnavailable, readinessReport{Status: "shutting_down"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), readinessTimeout)
+	defer cancel()
+
+	report := readinessReport{Status: "ok", Checks: map[string]dependencyStatus{}}
+
+	dbStatus := checkDatabase(ctx, cfg.db)
+	report.Checks["database"] = dbStatus
+
+	// the version query would only fail the same way again
+	if dbStatus.Status == "ok" {
+		report.Checks["migrations"] = checkMigrations(ctx, cfg.migrator)
+	} else {
+		report.Checks["migrations"] = dependencyStatus{Status: "unknown", Expected: cfg.migrator.Latest()}
+	}
+
+	code := http.StatusOK
+	for name, check := range report.Checks {
+		if check.Status != "ok" {
+			report.Status = "unavailable"
+			code = http.StatusServiceUnavailable
+			logging.FromContext(r.Context()).Warn("readiness check failed", "check", name, "status", check.Status, "err", check.Error)
+		}
+	}
+
+	respondWithJSON(w, code, report)
+}
+
+func checkDatabase(ctx context.Context, db *sql.DB) dependencyStatus {
+	start := time.Now()
+	err := db.PingContext(ctx)
+	latency := float64(time.Since(start).Microseconds()) / 1000
+
+	if err != nil {
+		return dependencyStatus{Status: "down", LatencyMS: latency, Error: err.Error()}
+	}
+
+	return dependencyStatus{Status: "ok", LatencyMS: latency}
+}
+
+func checkMigrations(ctx context.Context, migrator *migrate.Migrator) dependencyStatus {
+	status := dependencyStatus{Expected: migrator.Latest()}
+
+	version, err := migrator.Current(ctx)
+	if err != nil {
+		status.Status = "error"
+		status.Error = err.Error()
+		return status
+	}
+	status.Version = &version
+
+	switch {
+	case version < status.Expected:
+		status.Status = "pending"
+		status.Error = fmt.Sprintf("database is at version %d, this build expects %d", version, status.Expected)
+	case version > status.Expected:
+		status.Status = "ahead"
+		status.Error = fmt.Sprintf("database is at version %d, newer than this build's %d", version, status.Expected)
+	default:
+		status.Status = "ok"
+	}
+
+	return status
+}
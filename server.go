@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/nickemp1996/chirpy/internal/config"
+)
+
+func newServer(cfg *config.Config, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              cfg.Addr(),
+		Handler:           handler,
+		ReadTimeout:       cfg.ReadTimeout,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+		MaxHeaderBytes:    cfg.MaxHeaderBytes,
+	}
+}
+
+// serve runs the server until ctx is cancelled. It then fails readiness for
+// shutdownDelay while still serving, stops accepting new connections and
+// waits up to shutdownTimeout for in-flight requests and background jobs to
+// finish before flushing any buffered spans.
+func (apiCfg *apiConfig) serve(ctx context.Context, server *http.Server, shutdownDelay, shutdownTimeout time.Duration) error {
+	errCh := make(chan error, 1)
+	go func() {
+		slog.Info("starting server", "addr", server.Addr)
+		errCh <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+	}
+
+	// fail readiness first and keep serving until load balancers have
+	// polled it and stopped routing here
+	apiCfg.shuttingDown.Store(true)
+
+	slog.Info("shutting down, waiting for load balancers to stop routing here", "delay", shutdownDelay.String())
+	select {
+	case err := <-errCh:
+		return err
+	case <-time.After(shutdownDelay):
+	}
+
+	slog.Info("shutting down, draining in-flight requests", "timeout", shutdownTimeout.String())
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	err := server.Shutdown(shutdownCtx)
+	if err != nil {
+		slog.Error("error shutting down server", "err", err)
+	}
+
+	err = apiCfg.jobs.Drain(shutdownCtx)
+	if err != nil {
+		slog.Warn("jobs still running at shutdown deadline", "err", err)
+	}
+
+	err = apiCfg.tracer.Shutdown(shutdownCtx)
+	if err != nil {
+		slog.Warn("error flushing spans", "err", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,37 @@
+-- name: CreateAPIKey :one
+INSERT INTO api_keys (id, created_at, user_id, name, prefix, key_hash, scopes, rate_limit)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    $1,
+    $2,
+    $3,
+    $4,
+    $5,
+    $6
+)
+RETURNING *;
+
+-- name: CountUserAPIKeys :one
+SELECT COUNT(*) FROM api_keys
+WHERE user_id = $1 AND revoked_at IS NULL;
+
+-- name: GetAPIKeyByPrefix :one
+SELECT * FROM api_keys
+WHERE prefix = $1 LIMIT 1;
+
+-- name: GetUserAPIKeys :many
+SELECT * FROM api_keys
+WHERE user_id = $1
+ORDER BY created_at;
+
+-- name: RevokeAPIKey :execrows
+UPDATE api_keys
+SET revoked_at = NOW()
+WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL;
+
+-- name: TouchAPIKey :exec
+-- at most one write a minute per key, however busy it is
+UPDATE api_keys
+SET last_used_at = NOW()
+WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < NOW() - INTERVAL '1 minute');
@@ -0,0 +1,34 @@
+-- name: CreateEndpointDelivery :one
+INSERT INTO endpoint_deliveries (id, created_at, updated_at, endpoint_id, event_type, payload)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    NOW(),
+    $1,
+    $2,
+    $3
+)
+RETURNING *;
+
+-- name: GetEndpointDelivery :one
+SELECT * FROM endpoint_deliveries
+WHERE id = $1 LIMIT 1;
+
+-- name: GetEndpointDeliveries :many
+SELECT * FROM endpoint_deliveries
+WHERE endpoint_id = $1
+ORDER BY created_at DESC
+LIMIT $2;
+
+-- name: RecordEndpointDeliveryAttempt :one
+UPDATE endpoint_deliveries
+SET updated_at = NOW(),
+    attempts = attempts + 1,
+    status = $2,
+    response_status = $3,
+    response_body = $4,
+    error = $5,
+    duration_ms = $6,
+    delivered_at = CASE WHEN $2 = 'succeeded' THEN NOW() ELSE delivered_at END
+WHERE id = $1
+RETURNING *;
@@ -0,0 +1,55 @@
+-- name: EnqueueJob :one
+INSERT INTO jobs (id, created_at, updated_at, kind, payload, status, attempts, max_attempts, run_at)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    NOW(),
+    $1,
+    $2,
+    'pending',
+    0,
+    $3,
+    $4
+)
+RETURNING *;
+
+-- name: ClaimJobs :many
+UPDATE jobs
+SET updated_at = NOW(), status = 'running', attempts = attempts + 1, locked_until = $1
+WHERE id IN (
+    SELECT id FROM jobs
+    WHERE (status = 'pending' AND run_at <= NOW())
+       OR (status = 'running' AND locked_until < NOW() AND attempts < max_attempts)
+    ORDER BY run_at
+    LIMIT $2
+    FOR UPDATE SKIP LOCKED
+)
+RETURNING *;
+
+-- name: KillLapsedJobs :execrows
+-- a job whose lock lapsed on its last attempt has nothing left to retry with
+UPDATE jobs
+SET updated_at = NOW(), status = 'dead', locked_until = NULL, last_error = 'lock expired during the final attempt'
+WHERE status = 'running' AND locked_until < NOW() AND attempts >= max_attempts;
+
+-- name: CompleteJob :execrows
+-- outcomes match on the attempt, so a worker whose lock lapsed can't
+-- overwrite the job another worker has since claimed
+UPDATE jobs
+SET updated_at = NOW(), status = 'succeeded', locked_until = NULL, last_error = NULL
+WHERE id = $1 AND status = 'running' AND attempts = $2;
+
+-- name: RetryJob :execrows
+UPDATE jobs
+SET updated_at = NOW(), status = 'pending', locked_until = NULL, run_at = $2, last_error = $3
+WHERE id = $1 AND status = 'running' AND attempts = $4;
+
+-- name: KillJob :execrows
+UPDATE jobs
+SET updated_at = NOW(), status = 'dead', locked_until = NULL, last_error = $2
+WHERE id = $1 AND status = 'running' AND attempts = $3;
+
+-- name: GetDeadJobs :many
+SELECT * FROM jobs
+WHERE status = 'dead'
+ORDER BY updated_at DESC;
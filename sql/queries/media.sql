@@ -0,0 +1,53 @@
+-- name: CreateMediaFile :one
+INSERT INTO media_files (id, created_at, user_id, kind, storage_key, content_type, size_bytes)
+VALUES (
+    $1,
+    NOW(),
+    $2,
+    $3,
+    $4,
+    $5,
+    $6
+)
+RETURNING *;
+
+-- name: GetMediaFile :one
+SELECT * FROM media_files
+WHERE id = $1 LIMIT 1;
+
+-- name: AddChirpAttachment :exec
+INSERT INTO chirp_attachments (chirp_id, media_id, position)
+VALUES (
+    $1,
+    $2,
+    $3
+);
+
+-- name: GetChirpAttachments :many
+SELECT media_files.*, chirp_attachments.chirp_id FROM chirp_attachments
+JOIN media_files ON media_files.id = chirp_attachments.media_id
+WHERE chirp_attachments.chirp_id = ANY(sqlc.arg(chirp_ids)::uuid[])
+ORDER BY chirp_attachments.chirp_id, chirp_attachments.position;
+
+-- name: GetMediaFileByKey :one
+SELECT * FROM media_files
+WHERE storage_key = $1 LIMIT 1;
+
+-- name: AddMediaVariant :exec
+INSERT INTO media_variants (media_id, width, format, created_at, height, storage_key, content_type, size_bytes)
+VALUES (
+    $1,
+    $2,
+    $3,
+    NOW(),
+    $4,
+    $5,
+    $6,
+    $7
+)
+ON CONFLICT (media_id, width, format) DO NOTHING;
+
+-- name: GetMediaVariants :many
+SELECT * FROM media_variants
+WHERE media_id = $1
+ORDER BY width, format;
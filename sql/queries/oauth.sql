@@ -0,0 +1,100 @@
+-- name: CreateOAuthClient :one
+INSERT INTO oauth_clients (id, created_at, owner_id, client_id, secret_hash, name, redirect_uris, scopes)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    $1,
+    $2,
+    $3,
+    $4,
+    $5,
+    $6
+)
+RETURNING *;
+
+-- name: GetOAuthClient :one
+SELECT * FROM oauth_clients
+WHERE client_id = $1 LIMIT 1;
+
+-- name: GetUserOAuthClients :many
+SELECT * FROM oauth_clients
+WHERE owner_id = $1
+ORDER BY created_at;
+
+-- name: DeleteOAuthClient :execrows
+DELETE FROM oauth_clients
+WHERE client_id = $1 AND owner_id = $2;
+
+-- name: CreateOAuthCode :exec
+INSERT INTO oauth_codes (code_hash, created_at, expires_at, client_id, user_id, redirect_uri, scopes, code_challenge, code_challenge_method)
+VALUES (
+    $1,
+    NOW(),
+    $2,
+    $3,
+    $4,
+    $5,
+    $6,
+    $7,
+    $8
+);
+
+-- name: ConsumeOAuthCode :one
+-- a code works once, and only until it expires
+UPDATE oauth_codes
+SET used_at = NOW()
+WHERE code_hash = $1 AND used_at IS NULL AND expires_at > NOW()
+RETURNING *;
+
+-- name: GetSpentOAuthCode :one
+SELECT * FROM oauth_codes
+WHERE code_hash = $1 AND used_at IS NOT NULL LIMIT 1;
+
+-- name: SetOAuthCodeGrant :exec
+UPDATE oauth_codes
+SET grant_id = $2
+WHERE code_hash = $1;
+
+-- name: CreateOAuthGrant :one
+INSERT INTO oauth_grants (id, created_at, updated_at, client_id, user_id, scopes, refresh_token_hash, refresh_expires_at)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    NOW(),
+    $1,
+    $2,
+    $3,
+    $4,
+    $5
+)
+RETURNING *;
+
+-- name: GetOAuthGrant :one
+SELECT * FROM oauth_grants
+WHERE id = $1 LIMIT 1;
+
+-- name: GetOAuthGrantByRefreshToken :one
+SELECT * FROM oauth_grants
+WHERE refresh_token_hash = $1 LIMIT 1;
+
+-- name: GetOAuthGrantByPreviousRefreshToken :one
+SELECT * FROM oauth_grants
+WHERE previous_refresh_token_hash = $1 LIMIT 1;
+
+-- name: RotateOAuthRefreshToken :one
+-- matching on the old hash makes two concurrent refreshes with the same
+-- token yield one winner
+UPDATE oauth_grants
+SET updated_at = NOW(), previous_refresh_token_hash = refresh_token_hash, refresh_token_hash = sqlc.arg('new_hash'), refresh_expires_at = sqlc.arg('refresh_expires_at')
+WHERE id = sqlc.arg('id') AND refresh_token_hash = sqlc.arg('old_hash') AND revoked_at IS NULL
+RETURNING *;
+
+-- name: RevokeOAuthGrant :exec
+UPDATE oauth_grants
+SET updated_at = NOW(), revoked_at = NOW()
+WHERE id = $1 AND revoked_at IS NULL;
+
+-- name: RevokeUserOAuthGrants :execrows
+UPDATE oauth_grants
+SET updated_at = NOW(), revoked_at = NOW()
+WHERE user_id = $1 AND revoked_at IS NULL;
@@ -21,4 +21,9 @@ WHERE token = $1 LIMIT 1;
 -- name: RevokeRefreshToken :exec
 UPDATE refresh_tokens
 SET updated_at = NOW(), revoked_at = NOW()
-WHERE token = $1;
\ No newline at end of file
+WHERE token = $1;
+
+-- name: RevokeUserRefreshTokens :execrows
+UPDATE refresh_tokens
+SET updated_at = NOW(), revoked_at = NOW()
+WHERE user_id = $1 AND revoked_at IS NULL;
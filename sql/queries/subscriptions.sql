@@ -0,0 +1,60 @@
+-- name: UpsertSubscription :one
+INSERT INTO subscriptions (id, created_at, updated_at, user_id, provider, external_id, status, current_period_end)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    NOW(),
+    $1,
+    $2,
+    $3,
+    $4,
+    $5
+)
+ON CONFLICT (user_id, provider) DO UPDATE
+SET updated_at = NOW(),
+    external_id = COALESCE(EXCLUDED.external_id, subscriptions.external_id),
+    status = EXCLUDED.status,
+    current_period_end = EXCLUDED.current_period_end
+RETURNING *;
+
+-- name: GetSubscription :one
+SELECT * FROM subscriptions
+WHERE user_id = $1 AND provider = $2 LIMIT 1;
+
+-- name: GetUserSubscriptions :many
+SELECT * FROM subscriptions
+WHERE user_id = $1
+ORDER BY created_at;
+
+-- name: AddSubscriptionEvent :exec
+INSERT INTO subscription_events (id, created_at, subscription_id, event_type, status, current_period_end)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    $1,
+    $2,
+    $3,
+    $4
+);
+
+-- name: GetSubscriptionEvents :many
+SELECT * FROM subscription_events
+WHERE subscription_id = $1
+ORDER BY created_at;
+
+-- name: ExpireLapsedSubscription :one
+UPDATE subscriptions
+SET updated_at = NOW(), status = 'expired'
+WHERE id = $1 AND status <> 'expired' AND current_period_end <= NOW()
+RETURNING *;
+
+-- name: RefreshUserChirpyRed :one
+UPDATE users
+SET is_chirpy_red = EXISTS (
+    SELECT 1 FROM subscriptions
+    WHERE subscriptions.user_id = users.id
+      AND subscriptions.status <> 'expired'
+      AND (subscriptions.current_period_end IS NULL OR subscriptions.current_period_end > NOW())
+)
+WHERE id = $1
+RETURNING is_chirpy_red;
@@ -0,0 +1,34 @@
+-- name: CreateUserIdentity :one
+INSERT INTO user_identities (id, created_at, user_id, provider, subject, email, last_login_at)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    $1,
+    $2,
+    $3,
+    $4,
+    NOW()
+)
+RETURNING *;
+
+-- name: GetUserIdentity :one
+SELECT * FROM user_identities
+WHERE provider = $1 AND subject = $2 LIMIT 1;
+
+-- name: GetUserIdentities :many
+SELECT * FROM user_identities
+WHERE user_id = $1
+ORDER BY created_at;
+
+-- name: CountUserIdentities :one
+SELECT COUNT(*) FROM user_identities
+WHERE user_id = $1;
+
+-- name: TouchUserIdentity :exec
+UPDATE user_identities
+SET last_login_at = NOW(), email = $2
+WHERE id = $1;
+
+-- name: DeleteUserIdentity :execrows
+DELETE FROM user_identities
+WHERE id = $1 AND user_id = $2;
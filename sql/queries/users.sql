@@ -14,7 +14,7 @@ DELETE FROM users;
 
 -- name: GetPassword :one
 SELECT * FROM users
-WHERE email = $1 LIMIT 1;
+WHERE lower(email) = lower($1) LIMIT 1;
 
 -- name: UpdateUser :one
 UPDATE users
@@ -22,8 +22,40 @@ SET updated_at = NOW(), email = $1, hashed_password = $2
 WHERE id = $3
 RETURNING *;
 
--- name: UpgradeUser :one
+-- name: RemoveUserPassword :one
 UPDATE users
-SET updated_at = NOW(), is_chirpy_red = true
+SET updated_at = NOW(), hashed_password = NULL
+WHERE id = $1
+RETURNING *;
+
+-- name: GetUser :one
+SELECT * FROM users
+WHERE id = $1 LIMIT 1;
+
+-- name: GetUserForUpdate :one
+-- locks the user until the transaction ends
+SELECT * FROM users
+WHERE id = $1 LIMIT 1
+FOR UPDATE;
+
+-- name: GetUserByHandle :one
+SELECT * FROM users
+WHERE handle = $1 LIMIT 1;
+
+-- name: UpdateUserProfile :one
+UPDATE users
+SET updated_at = NOW(), handle = $2, display_name = $3, bio = $4, avatar_url = $5
+WHERE id = $1
+RETURNING *;
+
+-- name: GetUserStats :one
+SELECT
+    (SELECT COUNT(*) FROM chirps WHERE chirps.user_id = $1) AS chirp_count,
+    (SELECT COUNT(*) FROM follows WHERE follows.followee_id = $1) AS follower_count,
+    (SELECT COUNT(*) FROM follows WHERE follows.follower_id = $1) AS following_count;
+
+-- name: SetUserRole :one
+UPDATE users
+SET updated_at = NOW(), role = $2
 WHERE id = $1
 RETURNING *;
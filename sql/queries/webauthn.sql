@@ -0,0 +1,54 @@
+-- name: UseWebAuthnChallenge :execrows
+-- challenges are recorded once the response to them checks out, so using
+-- one again finds it already there
+INSERT INTO webauthn_challenges (challenge, created_at, expires_at, ceremony, user_id)
+VALUES (
+    $1,
+    NOW(),
+    $2,
+    $3,
+    $4
+)
+ON CONFLICT (challenge) DO NOTHING;
+
+-- name: DeleteExpiredWebAuthnChallenges :exec
+DELETE FROM webauthn_challenges
+WHERE expires_at <= NOW();
+
+-- name: CreateWebAuthnCredential :one
+INSERT INTO webauthn_credentials (id, created_at, user_id, name, credential_id, public_key, sign_count, transports)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    $1,
+    $2,
+    $3,
+    $4,
+    $5,
+    $6
+)
+RETURNING *;
+
+-- name: GetWebAuthnCredential :one
+SELECT * FROM webauthn_credentials
+WHERE credential_id = $1 LIMIT 1;
+
+-- name: GetUserWebAuthnCredentials :many
+SELECT * FROM webauthn_credentials
+WHERE user_id = $1
+ORDER BY created_at;
+
+-- name: CountUserWebAuthnCredentials :one
+SELECT COUNT(*) FROM webauthn_credentials
+WHERE user_id = $1;
+
+-- name: UpdateWebAuthnSignCount :execrows
+-- matching on the old count makes two concurrent sign ins with the same
+-- counter yield one winner
+UPDATE webauthn_credentials
+SET sign_count = sqlc.arg('new_sign_count'), last_used_at = NOW()
+WHERE id = sqlc.arg('id') AND sign_count = sqlc.arg('old_sign_count');
+
+-- name: DeleteWebAuthnCredential :execrows
+DELETE FROM webauthn_credentials
+WHERE id = $1 AND user_id = $2;
@@ -0,0 +1,35 @@
+-- name: CreateWebhookDelivery :one
+INSERT INTO webhook_deliveries (id, received_at, provider, headers, body)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    $1,
+    $2,
+    $3
+)
+RETURNING *;
+
+-- name: FinishWebhookDelivery :one
+UPDATE webhook_deliveries
+SET event_id = COALESCE(sqlc.narg('event_id'), event_id),
+    event_type = COALESCE(sqlc.narg('event_type'), event_type),
+    status = sqlc.arg('status'),
+    response_status = sqlc.narg('response_status'),
+    error = sqlc.narg('error'),
+    attempts = attempts + 1,
+    processed_at = NOW()
+WHERE id = sqlc.arg('id')
+RETURNING *;
+
+-- name: GetWebhookDelivery :one
+SELECT * FROM webhook_deliveries
+WHERE id = $1 LIMIT 1;
+
+-- name: ListWebhookDeliveries :many
+SELECT id, received_at, provider, event_id, event_type, status, response_status, error, attempts, processed_at
+FROM webhook_deliveries
+WHERE (sqlc.narg('provider')::text IS NULL OR provider = sqlc.narg('provider'))
+  AND (sqlc.narg('status')::text IS NULL OR status = sqlc.narg('status'))
+  AND (sqlc.narg('before')::timestamptz IS NULL OR received_at < sqlc.narg('before'))
+ORDER BY received_at DESC
+LIMIT sqlc.arg('max_rows');
@@ -0,0 +1,62 @@
+-- name: CreateWebhookEndpoint :one
+INSERT INTO webhook_endpoints (id, created_at, updated_at, user_id, url, secret, event_types)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    NOW(),
+    $1,
+    $2,
+    $3,
+    $4
+)
+RETURNING *;
+
+-- name: CountUserWebhookEndpoints :one
+SELECT COUNT(*) FROM webhook_endpoints
+WHERE user_id = $1;
+
+-- name: GetUserWebhookEndpoints :many
+SELECT * FROM webhook_endpoints
+WHERE user_id = $1
+ORDER BY created_at;
+
+-- name: GetWebhookEndpoint :one
+SELECT * FROM webhook_endpoints
+WHERE id = $1 LIMIT 1;
+
+-- name: GetWebhookEndpointsForEvent :many
+SELECT * FROM webhook_endpoints
+WHERE enabled AND sqlc.arg('event_type')::text = ANY(event_types);
+
+-- name: UpdateWebhookEndpoint :one
+-- re-enabling an endpoint gives it a clean slate
+UPDATE webhook_endpoints
+SET updated_at = NOW(),
+    url = $2,
+    event_types = $3,
+    consecutive_failures = CASE WHEN $4 AND NOT enabled THEN 0 ELSE consecutive_failures END,
+    disabled_at = CASE WHEN $4 THEN NULL ELSE disabled_at END,
+    disabled_reason = CASE WHEN $4 THEN NULL ELSE disabled_reason END,
+    enabled = $4
+WHERE id = $1
+RETURNING *;
+
+-- name: DeleteWebhookEndpoint :execrows
+DELETE FROM webhook_endpoints
+WHERE id = $1 AND user_id = $2;
+
+-- name: RecordWebhookEndpointSuccess :exec
+UPDATE webhook_endpoints
+SET consecutive_failures = 0
+WHERE id = $1 AND consecutive_failures <> 0;
+
+-- name: RecordWebhookEndpointFailure :one
+UPDATE webhook_endpoints
+SET consecutive_failures = consecutive_failures + 1
+WHERE id = $1
+RETURNING consecutive_failures;
+
+-- name: DisableWebhookEndpoint :exec
+UPDATE webhook_endpoints
+SET updated_at = NOW(), enabled = false, disabled_at = NOW(), disabled_reason = $2
+WHERE id = $1 AND enabled;
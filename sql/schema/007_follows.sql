@@ -0,0 +1,14 @@
+-- +goose Up
+CREATE TABLE follows (
+	follower_id uuid NOT NULL,
+	followee_id uuid NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (follower_id, followee_id),
+    FOREIGN KEY (follower_id) REFERENCES users(id)
+        ON DELETE CASCADE,
+    FOREIGN KEY (followee_id) REFERENCES users(id)
+        ON DELETE CASCADE
+);
+
+-- +goose Down
+DROP TABLE follows;
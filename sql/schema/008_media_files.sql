@@ -0,0 +1,15 @@
+-- +goose Up
+CREATE TABLE media_files (
+	id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+	created_at TIMESTAMPTZ NOT NULL,
+    user_id uuid NOT NULL,
+    kind TEXT NOT NULL,
+    storage_key TEXT UNIQUE NOT NULL,
+    content_type TEXT NOT NULL,
+    size_bytes BIGINT NOT NULL,
+    FOREIGN KEY (user_id) REFERENCES users(id)
+        ON DELETE CASCADE
+);
+
+-- +goose Down
+DROP TABLE media_files;
@@ -0,0 +1,14 @@
+-- +goose Up
+CREATE TABLE chirp_attachments (
+	chirp_id uuid NOT NULL,
+	media_id uuid NOT NULL,
+	position INTEGER NOT NULL,
+    PRIMARY KEY (chirp_id, media_id),
+    FOREIGN KEY (chirp_id) REFERENCES chirps(id)
+        ON DELETE CASCADE,
+    FOREIGN KEY (media_id) REFERENCES media_files(id)
+        ON DELETE CASCADE
+);
+
+-- +goose Down
+DROP TABLE chirp_attachments;
@@ -0,0 +1,17 @@
+-- +goose Up
+CREATE TABLE media_variants (
+	media_id uuid NOT NULL,
+	width INTEGER NOT NULL,
+	format TEXT NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL,
+    height INTEGER NOT NULL,
+    storage_key TEXT UNIQUE NOT NULL,
+    content_type TEXT NOT NULL,
+    size_bytes BIGINT NOT NULL,
+    PRIMARY KEY (media_id, width, format),
+    FOREIGN KEY (media_id) REFERENCES media_files(id)
+        ON DELETE CASCADE
+);
+
+-- +goose Down
+DROP TABLE media_variants;
@@ -0,0 +1,18 @@
+-- +goose Up
+CREATE TABLE jobs (
+	id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+	created_at TIMESTAMPTZ NOT NULL,
+	updated_at TIMESTAMPTZ NOT NULL,
+	kind TEXT NOT NULL,
+	payload JSONB NOT NULL,
+	status TEXT NOT NULL DEFAULT 'pending',
+	attempts INTEGER NOT NULL DEFAULT 0,
+	max_attempts INTEGER NOT NULL,
+	run_at TIMESTAMPTZ NOT NULL,
+	locked_until TIMESTAMPTZ,
+	last_error TEXT
+);
+CREATE INDEX jobs_runnable_idx ON jobs (run_at) WHERE status IN ('pending', 'running');
+
+-- +goose Down
+DROP TABLE jobs;
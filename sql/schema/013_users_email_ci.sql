@@ -0,0 +1,8 @@
+-- +goose Up
+-- fails if two accounts differ only by case; merge or rename them first
+CREATE UNIQUE INDEX users_email_lower_idx ON users (lower(email));
+ALTER TABLE users DROP CONSTRAINT users_email_key;
+
+-- +goose Down
+ALTER TABLE users ADD CONSTRAINT users_email_key UNIQUE (email);
+DROP INDEX users_email_lower_idx;
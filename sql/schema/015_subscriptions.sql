@@ -0,0 +1,31 @@
+-- +goose Up
+CREATE TABLE subscriptions (
+	id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+	created_at TIMESTAMPTZ NOT NULL,
+	updated_at TIMESTAMPTZ NOT NULL,
+	user_id uuid NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	provider TEXT NOT NULL,
+	external_id TEXT,
+	plan TEXT NOT NULL DEFAULT 'chirpy_red',
+	status TEXT NOT NULL CHECK (status IN ('active', 'past_due', 'canceled', 'expired')),
+	current_period_end TIMESTAMPTZ,
+	UNIQUE (user_id, provider)
+);
+
+CREATE TABLE subscription_events (
+	id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+	created_at TIMESTAMPTZ NOT NULL,
+	subscription_id uuid NOT NULL REFERENCES subscriptions(id) ON DELETE CASCADE,
+	event_type TEXT NOT NULL,
+	status TEXT NOT NULL,
+	current_period_end TIMESTAMPTZ
+);
+CREATE INDEX subscription_events_subscription_idx ON subscription_events (subscription_id, created_at);
+
+-- everyone upgraded before subscriptions existed keeps an open ended one
+INSERT INTO subscriptions (created_at, updated_at, user_id, provider, status)
+SELECT NOW(), NOW(), id, 'polka', 'active' FROM users WHERE is_chirpy_red;
+
+-- +goose Down
+DROP TABLE subscription_events;
+DROP TABLE subscriptions;
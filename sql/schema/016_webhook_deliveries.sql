@@ -0,0 +1,19 @@
+-- +goose Up
+CREATE TABLE webhook_deliveries (
+	id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+	received_at TIMESTAMPTZ NOT NULL,
+	provider TEXT NOT NULL,
+	headers JSONB NOT NULL,
+	body BYTEA NOT NULL,
+	event_id TEXT,
+	event_type TEXT,
+	status TEXT NOT NULL DEFAULT 'received' CHECK (status IN ('received', 'processed', 'ignored', 'duplicate', 'failed')),
+	response_status INTEGER,
+	error TEXT,
+	attempts INTEGER NOT NULL DEFAULT 0,
+	processed_at TIMESTAMPTZ
+);
+CREATE INDEX webhook_deliveries_received_idx ON webhook_deliveries (received_at DESC);
+
+-- +goose Down
+DROP TABLE webhook_deliveries;
@@ -0,0 +1,36 @@
+-- +goose Up
+CREATE TABLE webhook_endpoints (
+	id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+	created_at TIMESTAMPTZ NOT NULL,
+	updated_at TIMESTAMPTZ NOT NULL,
+	user_id uuid NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	url TEXT NOT NULL,
+	secret TEXT NOT NULL,
+	event_types TEXT[] NOT NULL,
+	enabled BOOLEAN NOT NULL DEFAULT true,
+	consecutive_failures INTEGER NOT NULL DEFAULT 0,
+	disabled_at TIMESTAMPTZ,
+	disabled_reason TEXT
+);
+CREATE INDEX webhook_endpoints_user_idx ON webhook_endpoints (user_id);
+
+CREATE TABLE endpoint_deliveries (
+	id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+	created_at TIMESTAMPTZ NOT NULL,
+	updated_at TIMESTAMPTZ NOT NULL,
+	endpoint_id uuid NOT NULL REFERENCES webhook_endpoints(id) ON DELETE CASCADE,
+	event_type TEXT NOT NULL,
+	payload JSONB NOT NULL,
+	status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'retrying', 'succeeded', 'failed')),
+	attempts INTEGER NOT NULL DEFAULT 0,
+	response_status INTEGER,
+	response_body TEXT,
+	error TEXT,
+	duration_ms INTEGER,
+	delivered_at TIMESTAMPTZ
+);
+CREATE INDEX endpoint_deliveries_endpoint_idx ON endpoint_deliveries (endpoint_id, created_at DESC);
+
+-- +goose Down
+DROP TABLE endpoint_deliveries;
+DROP TABLE webhook_endpoints;
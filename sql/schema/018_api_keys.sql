@@ -0,0 +1,18 @@
+-- +goose Up
+CREATE TABLE api_keys (
+	id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+	created_at TIMESTAMPTZ NOT NULL,
+	user_id uuid NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	name TEXT NOT NULL,
+	prefix TEXT NOT NULL UNIQUE,
+	key_hash TEXT NOT NULL,
+	scopes TEXT[] NOT NULL,
+	-- requests per minute, capped by the owner's plan; NULL uses the plan's
+	rate_limit INTEGER CHECK (rate_limit > 0),
+	last_used_at TIMESTAMPTZ,
+	revoked_at TIMESTAMPTZ
+);
+CREATE INDEX api_keys_user_idx ON api_keys (user_id);
+
+-- +goose Down
+DROP TABLE api_keys;
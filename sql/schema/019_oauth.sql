@@ -0,0 +1,45 @@
+-- +goose Up
+CREATE TABLE oauth_clients (
+	id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+	created_at TIMESTAMPTZ NOT NULL,
+	owner_id uuid NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	client_id TEXT NOT NULL UNIQUE,
+	-- NULL for public clients, which can't keep a secret and rely on PKCE
+	secret_hash TEXT,
+	name TEXT NOT NULL,
+	redirect_uris TEXT[] NOT NULL,
+	scopes TEXT[] NOT NULL
+);
+CREATE INDEX oauth_clients_owner_idx ON oauth_clients (owner_id);
+
+CREATE TABLE oauth_codes (
+	code_hash TEXT PRIMARY KEY,
+	created_at TIMESTAMPTZ NOT NULL,
+	expires_at TIMESTAMPTZ NOT NULL,
+	client_id uuid NOT NULL REFERENCES oauth_clients(id) ON DELETE CASCADE,
+	user_id uuid NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	redirect_uri TEXT NOT NULL,
+	scopes TEXT[] NOT NULL,
+	code_challenge TEXT NOT NULL,
+	code_challenge_method TEXT NOT NULL,
+	used_at TIMESTAMPTZ
+);
+
+-- a grant is one consent: its id is the jti of every access token issued
+-- under it, so revoking the grant revokes them all
+CREATE TABLE oauth_grants (
+	id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+	created_at TIMESTAMPTZ NOT NULL,
+	updated_at TIMESTAMPTZ NOT NULL,
+	client_id uuid NOT NULL REFERENCES oauth_clients(id) ON DELETE CASCADE,
+	user_id uuid NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	scopes TEXT[] NOT NULL,
+	refresh_token_hash TEXT NOT NULL UNIQUE,
+	refresh_expires_at TIMESTAMPTZ NOT NULL,
+	revoked_at TIMESTAMPTZ
+);
+
+-- +goose Down
+DROP TABLE oauth_grants;
+DROP TABLE oauth_codes;
+DROP TABLE oauth_clients;
@@ -0,0 +1,17 @@
+-- +goose Up
+-- accounts at external OpenID Connect providers that sign in as a user
+CREATE TABLE user_identities (
+	id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+	created_at TIMESTAMPTZ NOT NULL,
+	user_id uuid NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	provider TEXT NOT NULL,
+	-- the provider's stable id for the account; emails can change hands
+	subject TEXT NOT NULL,
+	email TEXT NOT NULL,
+	last_login_at TIMESTAMPTZ,
+	UNIQUE (provider, subject)
+);
+CREATE INDEX user_identities_user_idx ON user_identities (user_id);
+
+-- +goose Down
+DROP TABLE user_identities;
@@ -0,0 +1,39 @@
+-- +goose Up
+-- accounts can now go without a password, signing in with a passkey or an
+-- external provider instead; NULL means there is no password
+ALTER TABLE users ALTER COLUMN hashed_password DROP NOT NULL;
+ALTER TABLE users ALTER COLUMN hashed_password DROP DEFAULT;
+UPDATE users SET hashed_password = NULL WHERE hashed_password = 'unset';
+
+CREATE TABLE webauthn_credentials (
+	id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+	created_at TIMESTAMPTZ NOT NULL,
+	user_id uuid NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	name TEXT NOT NULL,
+	credential_id BYTEA NOT NULL UNIQUE,
+	-- the COSE_Key exactly as the authenticator sent it
+	public_key BYTEA NOT NULL,
+	-- the authenticator's signature counter; one that goes backwards
+	-- means the credential was cloned
+	sign_count BIGINT NOT NULL DEFAULT 0,
+	transports TEXT[] NOT NULL DEFAULT '{}',
+	last_used_at TIMESTAMPTZ
+);
+CREATE INDEX webauthn_credentials_user_idx ON webauthn_credentials (user_id);
+
+-- a challenge is good for one ceremony; user_id is NULL when signing in,
+-- since the passkey says who the user is
+CREATE TABLE webauthn_challenges (
+	challenge TEXT PRIMARY KEY,
+	created_at TIMESTAMPTZ NOT NULL,
+	expires_at TIMESTAMPTZ NOT NULL,
+	ceremony TEXT NOT NULL CHECK (ceremony IN ('registration', 'authentication')),
+	user_id uuid REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- +goose Down
+DROP TABLE webauthn_challenges;
+DROP TABLE webauthn_credentials;
+UPDATE users SET hashed_password = 'unset' WHERE hashed_password IS NULL;
+ALTER TABLE users ALTER COLUMN hashed_password SET DEFAULT 'unset';
+ALTER TABLE users ALTER COLUMN hashed_password SET NOT NULL;
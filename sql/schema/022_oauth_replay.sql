@@ -0,0 +1,11 @@
+-- +goose Up
+-- remember what spent codes and rotated refresh tokens led to, so a replay
+-- of either can revoke the grant it was stolen from
+ALTER TABLE oauth_codes ADD COLUMN grant_id uuid REFERENCES oauth_grants(id) ON DELETE SET NULL;
+ALTER TABLE oauth_grants ADD COLUMN previous_refresh_token_hash TEXT;
+CREATE INDEX oauth_grants_previous_refresh_token_idx ON oauth_grants (previous_refresh_token_hash);
+
+-- +goose Down
+DROP INDEX oauth_grants_previous_refresh_token_idx;
+ALTER TABLE oauth_grants DROP COLUMN previous_refresh_token_hash;
+ALTER TABLE oauth_codes DROP COLUMN grant_id;
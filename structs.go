@@ -1,11 +1,23 @@
 package main
 
 import (
+	"database/sql"
+	"encoding/json"
 	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/nickemp1996/chirpy/internal/billing"
 	"github.com/nickemp1996/chirpy/internal/database"
+	"github.com/nickemp1996/chirpy/internal/entitlements"
+	"github.com/nickemp1996/chirpy/internal/jobs"
+	"github.com/nickemp1996/chirpy/internal/migrate"
+	"github.com/nickemp1996/chirpy/internal/oidc"
+	"github.com/nickemp1996/chirpy/internal/ratelimit"
+	"github.com/nickemp1996/chirpy/internal/storage"
+	"github.com/nickemp1996/chirpy/internal/tracing"
+	"github.com/nickemp1996/chirpy/internal/webauthn"
+	"github.com/nickemp1996/chirpy/internal/webhook"
 )
 
 type User struct {
@@ -16,21 +28,235 @@ type User struct {
 	Token        string    `json:"token"`
 	RefreshToken string    `json:"refresh_token"`
 	IsChirpyRed  bool      `json:"is_chirpy_red"`
+	Handle       string    `json:"handle"`
+	DisplayName  string    `json:"display_name"`
+	Bio          string    `json:"bio"`
+	AvatarURL    string    `json:"avatar_url"`
+	HasPassword  bool      `json:"has_password"`
+}
+
+// Profile is the public view of a user; it must never carry the email or tokens.
+type Profile struct {
+	ID             uuid.UUID `json:"id"`
+	CreatedAt      time.Time `json:"created_at"`
+	Handle         string    `json:"handle"`
+	DisplayName    string    `json:"display_name"`
+	Bio            string    `json:"bio"`
+	AvatarURL      string    `json:"avatar_url"`
+	IsChirpyRed    bool      `json:"is_chirpy_red"`
+	Badge          string    `json:"badge,omitempty"`
+	ChirpCount     int64     `json:"chirp_count"`
+	FollowerCount  int64     `json:"follower_count"`
+	FollowingCount int64     `json:"following_count"`
 }
 
 type Chirp struct {
 	// the key will be the name of struct field unless you give it an explicit JSON tag
-	ID        uuid.UUID `json:"id"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
-	Body      string    `json:"body"`
-	UserID    uuid.UUID `json:"user_id"`
+	ID          uuid.UUID    `json:"id"`
+	CreatedAt   time.Time    `json:"created_at"`
+	UpdatedAt   time.Time    `json:"updated_at"`
+	Body        string       `json:"body"`
+	UserID      uuid.UUID    `json:"user_id"`
+	Attachments []Attachment `json:"attachments"`
+}
+
+type Attachment struct {
+	ID          uuid.UUID `json:"id"`
+	URL         string    `json:"url"`
+	ContentType string    `json:"content_type"`
+	Size        int64     `json:"size"`
+}
+
+// WebhookDelivery is an inbound webhook as admins see it. Headers and Body
+// are only filled in when a single delivery is requested.
+type WebhookDelivery struct {
+	ID             uuid.UUID       `json:"id"`
+	ReceivedAt     time.Time       `json:"received_at"`
+	Provider       string          `json:"provider"`
+	EventID        string          `json:"event_id,omitempty"`
+	EventType      string          `json:"event_type,omitempty"`
+	Status         string          `json:"status"`
+	ResponseStatus int             `json:"response_status,omitempty"`
+	Error          string          `json:"error,omitempty"`
+	Attempts       int32           `json:"attempts"`
+	ProcessedAt    *time.Time      `json:"processed_at,omitempty"`
+	Headers        json.RawMessage `json:"headers,omitempty"`
+	Body           json.RawMessage `json:"body,omitempty"`
+}
+
+// APIKey is a personal API key as its owner sees it. Key is only set in the
+// response that creates it.
+type APIKey struct {
+	ID         uuid.UUID  `json:"id"`
+	CreatedAt  time.Time  `json:"created_at"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	RateLimit  int        `json:"rate_limit,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	Key        string     `json:"key,omitempty"`
+}
+
+// WebhookEndpoint is a url registered for outbound events. Secret is only
+// set in the response that creates it.
+type WebhookEndpoint struct {
+	ID                  uuid.UUID  `json:"id"`
+	CreatedAt           time.Time  `json:"created_at"`
+	UpdatedAt           time.Time  `json:"updated_at"`
+	URL                 string     `json:"url"`
+	Events              []string   `json:"events"`
+	Enabled             bool       `json:"enabled"`
+	ConsecutiveFailures int32      `json:"consecutive_failures"`
+	DisabledAt          *time.Time `json:"disabled_at,omitempty"`
+	DisabledReason      string     `json:"disabled_reason,omitempty"`
+	Secret              string     `json:"secret,omitempty"`
+}
+
+// EndpointDelivery is one event sent, or being sent, to a WebhookEndpoint.
+type EndpointDelivery struct {
+	ID             uuid.UUID       `json:"id"`
+	CreatedAt      time.Time       `json:"created_at"`
+	EventType      string          `json:"event_type"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         string          `json:"status"`
+	Attempts       int32           `json:"attempts"`
+	ResponseStatus int             `json:"response_status,omitempty"`
+	ResponseBody   string          `json:"response_body,omitempty"`
+	Error          string          `json:"error,omitempty"`
+	DurationMs     int             `json:"duration_ms,omitempty"`
+	DeliveredAt    *time.Time      `json:"delivered_at,omitempty"`
+}
+
+// OAuthClient is a third-party app as its developer sees it. ClientSecret is
+// only set in the response that registers a confidential client.
+type OAuthClient struct {
+	ID           uuid.UUID `json:"id"`
+	CreatedAt    time.Time `json:"created_at"`
+	ClientID     string    `json:"client_id"`
+	Name         string    `json:"name"`
+	RedirectURIs []string  `json:"redirect_uris"`
+	Scopes       []string  `json:"scopes"`
+	Public       bool      `json:"public"`
+	ClientSecret string    `json:"client_secret,omitempty"`
+}
+
+// OAuthToken is the token endpoint's response, in RFC 6749's format.
+type OAuthToken struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"`
+	Scope        string `json:"scope"`
+}
+
+// OAuthIntrospection is RFC 7662's response. An inactive token only has
+// Active set.
+type OAuthIntrospection struct {
+	Active    bool   `json:"active"`
+	Scope     string `json:"scope,omitempty"`
+	ClientID  string `json:"client_id,omitempty"`
+	Subject   string `json:"sub,omitempty"`
+	TokenType string `json:"token_type,omitempty"`
+	ExpiresAt int64  `json:"exp,omitempty"`
+	IssuedAt  int64  `json:"iat,omitempty"`
+}
+
+// Identity is an account at an external OpenID Connect provider that can
+// sign in as the user.
+type Identity struct {
+	ID          uuid.UUID  `json:"id"`
+	CreatedAt   time.Time  `json:"created_at"`
+	Provider    string     `json:"provider"`
+	Email       string     `json:"email"`
+	LastLoginAt *time.Time `json:"last_login_at,omitempty"`
+}
+
+// IdentityLink is where to send the user to link an identity.
+type IdentityLink struct {
+	URL string `json:"url"`
+}
+
+// Passkey is a WebAuthn credential as its owner sees it.
+type Passkey struct {
+	ID         uuid.UUID  `json:"id"`
+	CreatedAt  time.Time  `json:"created_at"`
+	Name       string     `json:"name"`
+	Transports []string   `json:"transports"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+}
+
+// PasskeyOptions wraps the options a page passes straight to
+// navigator.credentials.create() or get(). Field names follow the WebAuthn
+// spec rather than the rest of the API, so browsers' parseCreationOptionsFromJSON
+// and parseRequestOptionsFromJSON accept them as they are.
+type PasskeyOptions struct {
+	PublicKey any `json:"publicKey"`
+}
+
+type PasskeyCreationOptions struct {
+	Challenge              string                        `json:"challenge"`
+	RelyingParty           PasskeyRelyingParty           `json:"rp"`
+	User                   PasskeyUser                   `json:"user"`
+	PubKeyCredParams       []PasskeyCredentialParameter  `json:"pubKeyCredParams"`
+	Timeout                int64                         `json:"timeout"`
+	Attestation            string                        `json:"attestation"`
+	AuthenticatorSelection PasskeyAuthenticatorSelection `json:"authenticatorSelection"`
+	ExcludeCredentials     []PasskeyDescriptor           `json:"excludeCredentials"`
+}
+
+type PasskeyRequestOptions struct {
+	Challenge        string              `json:"challenge"`
+	RelyingPartyID   string              `json:"rpId"`
+	Timeout          int64               `json:"timeout"`
+	UserVerification string              `json:"userVerification"`
+	AllowCredentials []PasskeyDescriptor `json:"allowCredentials"`
+}
+
+type PasskeyRelyingParty struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type PasskeyUser struct {
+	ID          webauthn.Base64URL `json:"id"`
+	Name        string             `json:"name"`
+	DisplayName string             `json:"displayName"`
+}
+
+type PasskeyCredentialParameter struct {
+	Type string `json:"type"`
+	Alg  int    `json:"alg"`
+}
+
+type PasskeyAuthenticatorSelection struct {
+	ResidentKey      string `json:"residentKey"`
+	UserVerification string `json:"userVerification"`
+}
+
+type PasskeyDescriptor struct {
+	Type       string             `json:"type"`
+	ID         webauthn.Base64URL `json:"id"`
+	Transports []string           `json:"transports,omitempty"`
 }
 
 type apiConfig struct {
-	fileserverHits atomic.Int32
-	queries        *database.Queries
-	platform       string
-	secret         string
-	polkaKey       string
+	db               *sql.DB
+	metrics          *appMetrics
+	queries          *database.Queries
+	blobs            storage.BlobStore
+	jobs             *jobs.Queue
+	tracer           *tracing.Tracer
+	migrator         *migrate.Migrator
+	plans            entitlements.Plans
+	limiter          *ratelimit.Limiter
+	webhookSender    *webhook.Sender
+	shuttingDown     atomic.Bool
+	dev              bool
+	secret           string
+	billingProviders map[string]billing.Provider
+	oidcProviders    map[string]*oidc.Provider
+	relyingParty     webauthn.RelyingParty
+	accessTokenTTL   time.Duration
+	refreshTokenTTL  time.Duration
 }
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nickemp1996/chirpy/internal/database"
+	"github.com/nickemp1996/chirpy/internal/jobs"
+	"github.com/nickemp1996/chirpy/internal/logging"
+)
+
+// A subscription grants Chirpy Red while it isn't expired and its period
+// hasn't ended. Canceled and past due subscriptions keep it until then.
+const (
+	subscriptionActive   = "active"
+	subscriptionPastDue  = "past_due"
+	subscriptionCanceled = "canceled"
+	subscriptionExpired  = "expired"
+)
+
+// manualProvider marks subscriptions granted by an operator rather than paid for.
+const manualProvider = "manual"
+
+const jobExpireSubscription = "subscriptions.expire"
+
+type expireSubscriptionJob struct {
+	SubscriptionID uuid.UUID `json:"subscription_id"`
+}
+
+// subscriptionChange is what one billing event does to a user's
+// subscription with a provider.
+type subscriptionChange struct {
+	UserID     uuid.UUID
+	Provider   string
+	ExternalID string
+	EventType  string
+	Status     string
+	PeriodEnd  sql.NullTime
+}
+
+// applySubscriptionChange stores the new state, appends it to the history and
+// recomputes the user's cached is_chirpy_red. Run it inside the transaction
+// that records the webhook event.
+func applySubscriptionChange(ctx context.Context, q *database.Queries, change subscriptionChange) (database.Subscription, error) {
+	sub, err := q.UpsertSubscription(ctx, database.UpsertSubscriptionParams{
+		UserID:           change.UserID,
+		Provider:         change.Provider,
+		ExternalID:       sql.NullString{String: change.ExternalID, Valid: change.ExternalID != ""},
+		Status:           change.Status,
+		CurrentPeriodEnd: change.PeriodEnd,
+	})
+	if err != nil {
+		return database.Subscription{}, err
+	}
+
+	err = q.AddSubscriptionEvent(ctx, database.AddSubscriptionEventParams{
+		SubscriptionID:   sub.ID,
+		EventType:        change.EventType,
+		Status:           sub.Status,
+		CurrentPeriodEnd: sub.CurrentPeriodEnd,
+	})
+	if err != nil {
+		return database.Subscription{}, err
+	}
+
+	_, err = q.RefreshUserChirpyRed(ctx, change.UserID)
+	if err != nil {
+		return database.Subscription{}, err
+	}
+
+	return sub, nil
+}
+
+// scheduleExpiry queues a check for when sub's period ends. A renewal moves
+// the period end, so the earlier check then finds nothing to do.
+func (cfg *apiConfig) scheduleExpiry(ctx context.Context, sub database.Subscription) {
+	if !sub.CurrentPeriodEnd.Valid || sub.Status == subscriptionExpired {
+		return
+	}
+
+	_, err := cfg.jobs.Enqueue(ctx, jobExpireSubscription, expireSubscriptionJob{SubscriptionID: sub.ID}, jobs.RunAt(sub.CurrentPeriodEnd.Time))
+	if err != nil {
+		logging.FromContext(ctx).Error("error scheduling subscription expiry", "subscription_id", sub.ID, "err", err)
+	}
+}
+
+func (cfg *apiConfig) expireSubscription(ctx context.Context, job expireSubscriptionJob) error {
+	tx, err := cfg.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	qtx := cfg.withTx(tx)
+
+	sub, err := qtx.ExpireLapsedSubscription(ctx, job.SubscriptionID)
+	if errors.Is(err, sql.ErrNoRows) {
+		// renewed, already expired or deleted
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	err = qtx.AddSubscriptionEvent(ctx, database.AddSubscriptionEventParams{
+		SubscriptionID:   sub.ID,
+		EventType:        "period.ended",
+		Status:           sub.Status,
+		CurrentPeriodEnd: sub.CurrentPeriodEnd,
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = qtx.RefreshUserChirpyRed(ctx, sub.UserID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// periodEnd keeps the existing period unless the event carries a new one.
+func periodEnd(existing sql.NullTime, next *time.Time) sql.NullTime {
+	if next != nil {
+		return sql.NullTime{Time: *next, Valid: true}
+	}
+	return existing
+}
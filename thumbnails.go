@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+
+	"github.com/google/uuid"
+	"github.com/nickemp1996/chirpy/internal/database"
+	"github.com/nickemp1996/chirpy/internal/jobs"
+	"github.com/nickemp1996/chirpy/internal/media"
+)
+
+const jobMediaVariants = "media.variants"
+
+type mediaVariantsJob struct {
+	MediaID uuid.UUID `json:"media_id"`
+}
+
+// generateMediaVariants stores resized copies of an upload. It runs on the job
+// queue so uploads return as soon as the original is stored.
+func (cfg *apiConfig) generateMediaVariants(ctx context.Context, job mediaVariantsJob) error {
+	dbMedia, err := cfg.queries.GetMediaFile(ctx, job.MediaID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return jobs.Permanent(err)
+		}
+		return err
+	}
+
+	// resizing would drop every frame but the first
+	if dbMedia.ContentType == "image/gif" {
+		return nil
+	}
+
+	rc, _, err := cfg.blobs.Get(ctx, dbMedia.StorageKey)
+	if err != nil {
+		return err
+	}
+	data, err := io.ReadAll(rc)
+	rc.Close()
+	if err != nil {
+		return err
+	}
+
+	variants, err := media.GenerateVariants(data, media.VariantWidths, media.VariantFormats)
+	if err != nil {
+		// the upload was sniffed but can't be decoded, retrying won't help
+		return jobs.Permanent(err)
+	}
+
+	for _, v := range variants {
+		key := fmt.Sprintf("variants/%s/%d%s", dbMedia.ID, v.Width, v.Format.Ext)
+		obj, err := cfg.blobs.Put(ctx, key, bytes.NewReader(v.Data), v.Format.ContentType)
+		if err != nil {
+			return err
+		}
+
+		variantParams := database.AddMediaVariantParams{
+			MediaID:     dbMedia.ID,
+			Width:       int32(v.Width),
+			Format:      v.Format.Name,
+			Height:      int32(v.Height),
+			StorageKey:  key,
+			ContentType: v.Format.ContentType,
+			SizeBytes:   obj.Size,
+		}
+
+		err = cfg.queries.AddMediaVariant(ctx, variantParams)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// pickVariant returns the narrowest variant at least width wide in the
+// requested format, or false if the original should be served instead.
+func pickVariant(variants []database.MediaVariant, width int, format string) (database.MediaVariant, bool) {
+	for _, v := range variants {
+		if v.Format == format && int(v.Width) >= width {
+			return v, true
+		}
+	}
+
+	return database.MediaVariant{}, false
+}
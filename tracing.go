@@ -0,0 +1,35 @@
+package main
+
+import (
+	"database/sql"
+	"os"
+
+	"github.com/nickemp1996/chirpy/internal/config"
+	"github.com/nickemp1996/chirpy/internal/database"
+	"github.com/nickemp1996/chirpy/internal/tracing"
+)
+
+// newTracer builds the tracer for the configured exporter. It returns nil when
+// tracing is off, which every tracing method treats as a no-op.
+func newTracer(cfg *config.Config) (*tracing.Tracer, error) {
+	switch cfg.TraceExporter {
+	case "stdout":
+		return tracing.NewTracer(tracing.NewWriterExporter(os.Stdout)), nil
+	case "file":
+		exporter, err := tracing.NewFileExporter(cfg.TraceFile)
+		if err != nil {
+			return nil, err
+		}
+		return tracing.NewTracer(exporter), nil
+	case "otlp":
+		return tracing.NewTracer(tracing.NewOTLPExporter(cfg.OTLPEndpoint, cfg.ServiceName, nil)), nil
+	default:
+		return nil, nil
+	}
+}
+
+// withTx is Queries.WithTx for the traced connection; the generated WithTx
+// would hand the raw transaction over and lose the query spans.
+func (cfg *apiConfig) withTx(tx *sql.Tx) *database.Queries {
+	return database.New(cfg.tracer.WrapDB(tx))
+}
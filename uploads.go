@@ -0,0 +1,313 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/nickemp1996/chirpy/internal/apierror"
+	"github.com/nickemp1996/chirpy/internal/auth"
+	"github.com/nickemp1996/chirpy/internal/database"
+	"github.com/nickemp1996/chirpy/internal/logging"
+	"github.com/nickemp1996/chirpy/internal/media"
+	"github.com/nickemp1996/chirpy/internal/storage"
+)
+
+const (
+	mediaKindAvatar = "avatar"
+	mediaKindChirp  = "chirp"
+
+	maxAvatarSize       = 2 << 20
+	maxChirpImageSize   = 5 << 20
+	maxChirpAttachments = 4
+
+	// room for the multipart boundaries and part headers on top of the file itself
+	multipartOverhead = 64 << 10
+)
+
+func mediaURL(key string) string {
+	return "/media/" + key
+}
+
+func attachmentFromDB(dbMedia database.MediaFile) Attachment {
+	return Attachment{
+		ID:          dbMedia.ID,
+		URL:         mediaURL(dbMedia.StorageKey),
+		ContentType: dbMedia.ContentType,
+		Size:        dbMedia.SizeBytes,
+	}
+}
+
+// readUpload pulls a single image out of a multipart form field, enforcing the
+// size limit, sniffing the real content type and stripping metadata. It writes
+// the error response itself and reports whether the caller should continue.
+func readUpload(w http.ResponseWriter, r *http.Request, field string, limit int64) ([]byte, string, string, bool) {
+	r.Body = http.MaxBytesReader(w, r.Body, limit+multipartOverhead)
+	err := r.ParseMultipartForm(limit)
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			respondWithError(w, r, apierror.PayloadTooLarge(fmt.Sprintf("file must be at most %d bytes", limit), err))
+			return nil, "", "", false
+		}
+		respondWithError(w, r, apierror.BadRequest("expected a multipart/form-data body", err))
+		return nil, "", "", false
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	file, _, err := r.FormFile(field)
+	if err != nil {
+		respondWithError(w, r, apierror.BadRequest(fmt.Sprintf("missing %q file field", field), err))
+		return nil, "", "", false
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, limit+1))
+	if err != nil {
+		respondWithError(w, r, err)
+		return nil, "", "", false
+	}
+
+	if int64(len(data)) > limit {
+		respondWithError(w, r, apierror.PayloadTooLarge(fmt.Sprintf("file must be at most %d bytes", limit), nil))
+		return nil, "", "", false
+	}
+
+	contentType, ext, err := media.Sniff(data)
+	if err != nil {
+		respondWithError(w, r, apierror.UnsupportedMediaType("only jpeg, png, gif and webp images are allowed", err))
+		return nil, "", "", false
+	}
+
+	data, err = media.StripMetadata(contentType, data)
+	if err != nil {
+		respondWithError(w, r, apierror.BadRequest("image could not be read", err))
+		return nil, "", "", false
+	}
+
+	return data, contentType, ext, true
+}
+
+// saveUpload writes the blob and records it, removing the blob again if the
+// database insert fails so the store doesn't fill up with orphans.
+func (cfg *apiConfig) saveUpload(ctx context.Context, userID uuid.UUID, kind string, data []byte, contentType, ext string) (database.MediaFile, error) {
+	id := uuid.New()
+	key := fmt.Sprintf("%ss/%s%s", kind, id, ext)
+
+	obj, err := cfg.blobs.Put(ctx, key, bytes.NewReader(data), contentType)
+	if err != nil {
+		return database.MediaFile{}, err
+	}
+
+	mediaParams := database.CreateMediaFileParams{
+		ID:          id,
+		UserID:      userID,
+		Kind:        kind,
+		StorageKey:  key,
+		ContentType: contentType,
+		SizeBytes:   obj.Size,
+	}
+
+	dbMedia, err := cfg.queries.CreateMediaFile(ctx, mediaParams)
+	if err != nil {
+		cfg.blobs.Delete(ctx, key)
+		return database.MediaFile{}, err
+	}
+
+	// the original is usable without variants, so a failed enqueue isn't fatal
+	_, err = cfg.jobs.Enqueue(ctx, jobMediaVariants, mediaVariantsJob{MediaID: dbMedia.ID})
+	if err != nil {
+		logging.FromContext(ctx).Error("error enqueueing media variants", "media_id", dbMedia.ID, "err", err)
+	}
+
+	return dbMedia, nil
+}
+
+func (cfg *apiConfig) uploadAvatar(w http.ResponseWriter, r *http.Request) {
+	tokenString, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, r, apierror.Unauthorized("token missing", err))
+		return
+	}
+
+	validUser, err := auth.ValidateJWT(tokenString, cfg.secret)
+	if err != nil {
+		respondWithError(w, r, apierror.Unauthorized("invalid or expired token", err))
+		return
+	}
+
+	logging.SetUserID(r.Context(), validUser)
+
+	data, contentType, ext, ok := readUpload(w, r, "avatar", maxAvatarSize)
+	if !ok {
+		return
+	}
+
+	dbUser, err := cfg.queries.GetUser(r.Context(), validUser)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, r, apierror.NotFound("user not found", err))
+			return
+		} else {
+			respondWithError(w, r, err)
+			return
+		}
+	}
+
+	dbMedia, err := cfg.saveUpload(r.Context(), dbUser.ID, mediaKindAvatar, data, contentType, ext)
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	profileParams := database.UpdateUserProfileParams{
+		ID:          dbUser.ID,
+		Handle:      dbUser.Handle,
+		DisplayName: dbUser.DisplayName,
+		Bio:         dbUser.Bio,
+		AvatarUrl:   mediaURL(dbMedia.StorageKey),
+	}
+
+	dbUser, err = cfg.queries.UpdateUserProfile(r.Context(), profileParams)
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	cfg.respondWithProfile(w, r, dbUser)
+}
+
+func (cfg *apiConfig) uploadChirpMedia(w http.ResponseWriter, r *http.Request) {
+	caller, err := cfg.authenticate(r, scopeMediaWrite)
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+	validUser := caller.UserID
+
+	dbUser, err := cfg.queries.GetUser(r.Context(), validUser)
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	err = cfg.rateLimit(dbUser, caller)
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	data, contentType, ext, ok := readUpload(w, r, "file", maxChirpImageSize)
+	if !ok {
+		return
+	}
+
+	dbMedia, err := cfg.saveUpload(r.Context(), validUser, mediaKindChirp, data, contentType, ext)
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	respondWithJSON(w, 201, attachmentFromDB(dbMedia))
+}
+
+func (cfg *apiConfig) serveMedia(w http.ResponseWriter, r *http.Request) {
+	key := r.PathValue("key")
+	// keys are made from a fresh uuid, so the blob behind one never changes
+	cacheControl := "public, max-age=31536000, immutable"
+
+	if s := r.URL.Query().Get("w"); s != "" {
+		width, err := strconv.Atoi(s)
+		if err != nil || width <= 0 {
+			respondWithError(w, r, apierror.Field("w", "must be a positive integer"))
+			return
+		}
+
+		dbMedia, err := cfg.queries.GetMediaFileByKey(r.Context(), key)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				respondWithError(w, r, apierror.NotFound("media not found", err))
+				return
+			}
+			respondWithError(w, r, err)
+			return
+		}
+
+		variants, err := cfg.queries.GetMediaVariants(r.Context(), dbMedia.ID)
+		if err != nil {
+			respondWithError(w, r, err)
+			return
+		}
+
+		format := media.FormatJPEG.Name
+		if strings.Contains(r.Header.Get("Accept"), media.FormatWebP.ContentType) {
+			format = media.FormatWebP.Name
+		}
+
+		variant, ok := pickVariant(variants, width, format)
+		if ok {
+			key = variant.StorageKey
+		} else if len(variants) == 0 {
+			// variants may still be processing, don't pin the original to this url
+			cacheControl = "public, max-age=60"
+		}
+		w.Header().Set("Vary", "Accept")
+	}
+
+	rc, obj, err := cfg.blobs.Get(r.Context(), key)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) || errors.Is(err, storage.ErrInvalidKey) {
+			respondWithError(w, r, apierror.NotFound("media not found", err))
+			return
+		}
+		respondWithError(w, r, err)
+		return
+	}
+	defer rc.Close()
+
+	w.Header().Set("Content-Type", obj.ContentType)
+	w.Header().Set("Content-Length", strconv.FormatInt(obj.Size, 10))
+	w.Header().Set("Cache-Control", cacheControl)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(200)
+	io.Copy(w, rc)
+}
+
+// loadAttachments fills in the attachments of every chirp with a single query.
+func (cfg *apiConfig) loadAttachments(ctx context.Context, chirps []Chirp) error {
+	ids := make([]uuid.UUID, len(chirps))
+	index := make(map[uuid.UUID]int, len(chirps))
+	for i := range chirps {
+		ids[i] = chirps[i].ID
+		index[chirps[i].ID] = i
+		chirps[i].Attachments = []Attachment{}
+	}
+
+	if len(ids) == 0 {
+		return nil
+	}
+
+	rows, err := cfg.queries.GetChirpAttachments(ctx, ids)
+	if err != nil {
+		return err
+	}
+
+	for _, row := range rows {
+		i := index[row.ChirpID]
+		chirps[i].Attachments = append(chirps[i].Attachments, Attachment{
+			ID:          row.ID,
+			URL:         mediaURL(row.StorageKey),
+			ContentType: row.ContentType,
+			Size:        row.SizeBytes,
+		})
+	}
+
+	return nil
+}
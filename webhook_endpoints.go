@@ -0,0 +1,541 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nickemp1996/chirpy/internal/apierror"
+	"github.com/nickemp1996/chirpy/internal/auth"
+	"github.com/nickemp1996/chirpy/internal/database"
+	"github.com/nickemp1996/chirpy/internal/httpjson"
+	"github.com/nickemp1996/chirpy/internal/jobs"
+	"github.com/nickemp1996/chirpy/internal/logging"
+	"github.com/nickemp1996/chirpy/internal/webhook"
+)
+
+// Events third parties can subscribe to. They only carry what the public API
+// already shows, since anyone can register an endpoint.
+const (
+	eventChirpCreated = "chirp.created"
+	eventChirpDeleted = "chirp.deleted"
+	eventUserCreated  = "user.created"
+)
+
+var webhookEventTypes = []string{eventChirpCreated, eventChirpDeleted, eventUserCreated}
+
+const (
+	jobDeliverWebhook = "webhooks.deliver"
+
+	maxWebhookEndpoints = 10
+	// maxWebhookAttempts with the queue's backoff spreads retries over
+	// roughly an hour and a half
+	maxWebhookAttempts = 10
+	// webhookFailureLimit is how many deliveries in a row may exhaust their
+	// retries before the endpoint is disabled
+	webhookFailureLimit = 5
+
+	webhookDeliveryPageSize = 50
+)
+
+// Endpoint delivery statuses. Retrying means an attempt failed and another
+// is scheduled.
+const (
+	endpointDeliveryPending   = "pending"
+	endpointDeliveryRetrying  = webhook.StatusRetrying
+	endpointDeliverySucceeded = webhook.StatusSucceeded
+	endpointDeliveryFailed    = webhook.StatusFailed
+)
+
+type deliverWebhookJob struct {
+	DeliveryID uuid.UUID `json:"delivery_id"`
+}
+
+// outboundEvent is the body of every delivery. ID is shared by the deliveries
+// of one event to different endpoints.
+type outboundEvent struct {
+	ID        uuid.UUID `json:"id"`
+	Type      string    `json:"type"`
+	CreatedAt time.Time `json:"created_at"`
+	Data      any       `json:"data"`
+}
+
+func webhookEndpointFromDB(dbEndpoint database.WebhookEndpoint) WebhookEndpoint {
+	endpoint := WebhookEndpoint{
+		ID:                  dbEndpoint.ID,
+		CreatedAt:           dbEndpoint.CreatedAt,
+		UpdatedAt:           dbEndpoint.UpdatedAt,
+		URL:                 dbEndpoint.Url,
+		Events:              dbEndpoint.EventTypes,
+		Enabled:             dbEndpoint.Enabled,
+		ConsecutiveFailures: dbEndpoint.ConsecutiveFailures,
+		DisabledReason:      dbEndpoint.DisabledReason.String,
+	}
+	if dbEndpoint.DisabledAt.Valid {
+		endpoint.DisabledAt = &dbEndpoint.DisabledAt.Time
+	}
+	return endpoint
+}
+
+func endpointDeliveryFromDB(dbDelivery database.EndpointDelivery) EndpointDelivery {
+	delivery := EndpointDelivery{
+		ID:             dbDelivery.ID,
+		CreatedAt:      dbDelivery.CreatedAt,
+		EventType:      dbDelivery.EventType,
+		Payload:        dbDelivery.Payload,
+		Status:         dbDelivery.Status,
+		Attempts:       dbDelivery.Attempts,
+		ResponseStatus: int(dbDelivery.ResponseStatus.Int32),
+		ResponseBody:   dbDelivery.ResponseBody.String,
+		Error:          dbDelivery.Error.String,
+		DurationMs:     int(dbDelivery.DurationMs.Int32),
+	}
+	if dbDelivery.DeliveredAt.Valid {
+		delivery.DeliveredAt = &dbDelivery.DeliveredAt.Time
+	}
+	return delivery
+}
+
+func newWebhookSecret() (string, error) {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(b), nil
+}
+
+// checkWebhookEvents validates a subscription list and drops duplicates.
+func checkWebhookEvents(events []string) ([]string, error) {
+	if len(events) == 0 {
+		return nil, apierror.Field("events", "must list at least one event")
+	}
+
+	var unique []string
+	for _, event := range events {
+		if !slices.Contains(webhookEventTypes, event) {
+			return nil, apierror.Field("events", fmt.Sprintf("unknown event %q, must be one of chirp.created, chirp.deleted or user.created", event))
+		}
+		if !slices.Contains(unique, event) {
+			unique = append(unique, event)
+		}
+	}
+
+	return unique, nil
+}
+
+func (cfg *apiConfig) checkWebhookURL(raw string) error {
+	err := webhook.ValidateURL(raw, cfg.dev)
+	if err != nil {
+		return apierror.Field("url", "must be an absolute https url")
+	}
+	return nil
+}
+
+// userWebhookEndpoint loads an endpoint owned by userID. Someone else's
+// endpoint is reported as missing rather than forbidden.
+func (cfg *apiConfig) userWebhookEndpoint(r *http.Request, userID uuid.UUID) (database.WebhookEndpoint, error) {
+	endpointID, err := uuid.Parse(r.PathValue("endpointID"))
+	if err != nil {
+		return database.WebhookEndpoint{}, apierror.InvalidID("endpointID must be a UUID", err)
+	}
+
+	dbEndpoint, err := cfg.queries.GetWebhookEndpoint(r.Context(), endpointID)
+	if err == sql.ErrNoRows || (err == nil && dbEndpoint.UserID != userID) {
+		return database.WebhookEndpoint{}, apierror.NotFound("webhook endpoint not found", err)
+	}
+
+	return dbEndpoint, err
+}
+
+func (cfg *apiConfig) createWebhookEndpoint(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		URL    string   `json:"url"`
+		Events []string `json:"events"`
+	}
+
+	params := parameters{}
+	err := httpjson.Decode(w, r, &params, maxUserBodySize)
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	tokenString, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, r, apierror.Unauthorized("token missing", err))
+		return
+	}
+
+	validUser, err := auth.ValidateJWT(tokenString, cfg.secret)
+	if err != nil {
+		respondWithError(w, r, apierror.Unauthorized("invalid or expired token", err))
+		return
+	}
+
+	logging.SetUserID(r.Context(), validUser)
+
+	err = cfg.checkWebhookURL(params.URL)
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	events, err := checkWebhookEvents(params.Events)
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	count, err := cfg.queries.CountUserWebhookEndpoints(r.Context(), validUser)
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+	if count >= maxWebhookEndpoints {
+		respondWithError(w, r, apierror.Conflict(fmt.Sprintf("an account can register at most %d webhook endpoints", maxWebhookEndpoints), nil))
+		return
+	}
+
+	secret, err := newWebhookSecret()
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	dbEndpoint, err := cfg.queries.CreateWebhookEndpoint(r.Context(), database.CreateWebhookEndpointParams{
+		UserID:     validUser,
+		Url:        params.URL,
+		Secret:     secret,
+		EventTypes: events,
+	})
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	// the secret is only ever shown here
+	endpoint := webhookEndpointFromDB(dbEndpoint)
+	endpoint.Secret = dbEndpoint.Secret
+
+	respondWithJSON(w, 201, endpoint)
+}
+
+func (cfg *apiConfig) getWebhookEndpoints(w http.ResponseWriter, r *http.Request) {
+	tokenString, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, r, apierror.Unauthorized("token missing", err))
+		return
+	}
+
+	validUser, err := auth.ValidateJWT(tokenString, cfg.secret)
+	if err != nil {
+		respondWithError(w, r, apierror.Unauthorized("invalid or expired token", err))
+		return
+	}
+
+	logging.SetUserID(r.Context(), validUser)
+
+	dbEndpoints, err := cfg.queries.GetUserWebhookEndpoints(r.Context(), validUser)
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	endpoints := make([]WebhookEndpoint, len(dbEndpoints))
+	for i, dbEndpoint := range dbEndpoints {
+		endpoints[i] = webhookEndpointFromDB(dbEndpoint)
+	}
+
+	respondWithJSON(w, 200, endpoints)
+}
+
+// updateWebhookEndpoint changes the url or events, and enables or disables
+// the endpoint. Enabling one that was disabled for failing resets its count.
+func (cfg *apiConfig) updateWebhookEndpoint(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		URL     *string   `json:"url"`
+		Events  *[]string `json:"events"`
+		Enabled *bool     `json:"enabled"`
+	}
+
+	params := parameters{}
+	err := httpjson.Decode(w, r, &params, maxUserBodySize)
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	tokenString, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, r, apierror.Unauthorized("token missing", err))
+		return
+	}
+
+	validUser, err := auth.ValidateJWT(tokenString, cfg.secret)
+	if err != nil {
+		respondWithError(w, r, apierror.Unauthorized("invalid or expired token", err))
+		return
+	}
+
+	logging.SetUserID(r.Context(), validUser)
+
+	dbEndpoint, err := cfg.userWebhookEndpoint(r, validUser)
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	updateParams := database.UpdateWebhookEndpointParams{
+		ID:         dbEndpoint.ID,
+		Url:        dbEndpoint.Url,
+		EventTypes: dbEndpoint.EventTypes,
+		Enabled:    dbEndpoint.Enabled,
+	}
+
+	if params.URL != nil {
+		err = cfg.checkWebhookURL(*params.URL)
+		if err != nil {
+			respondWithError(w, r, err)
+			return
+		}
+		updateParams.Url = *params.URL
+	}
+
+	if params.Events != nil {
+		updateParams.EventTypes, err = checkWebhookEvents(*params.Events)
+		if err != nil {
+			respondWithError(w, r, err)
+			return
+		}
+	}
+
+	if params.Enabled != nil {
+		updateParams.Enabled = *params.Enabled
+	}
+
+	dbEndpoint, err = cfg.queries.UpdateWebhookEndpoint(r.Context(), updateParams)
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	respondWithJSON(w, 200, webhookEndpointFromDB(dbEndpoint))
+}
+
+func (cfg *apiConfig) deleteWebhookEndpoint(w http.ResponseWriter, r *http.Request) {
+	endpointID, err := uuid.Parse(r.PathValue("endpointID"))
+	if err != nil {
+		respondWithError(w, r, apierror.InvalidID("endpointID must be a UUID", err))
+		return
+	}
+
+	tokenString, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, r, apierror.Unauthorized("token missing", err))
+		return
+	}
+
+	validUser, err := auth.ValidateJWT(tokenString, cfg.secret)
+	if err != nil {
+		respondWithError(w, r, apierror.Unauthorized("invalid or expired token", err))
+		return
+	}
+
+	logging.SetUserID(r.Context(), validUser)
+
+	deleted, err := cfg.queries.DeleteWebhookEndpoint(r.Context(), database.DeleteWebhookEndpointParams{
+		ID:     endpointID,
+		UserID: validUser,
+	})
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+	if deleted == 0 {
+		respondWithError(w, r, apierror.NotFound("webhook endpoint not found", nil))
+		return
+	}
+
+	w.WriteHeader(204)
+}
+
+func (cfg *apiConfig) getWebhookEndpointDeliveries(w http.ResponseWriter, r *http.Request) {
+	tokenString, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, r, apierror.Unauthorized("token missing", err))
+		return
+	}
+
+	validUser, err := auth.ValidateJWT(tokenString, cfg.secret)
+	if err != nil {
+		respondWithError(w, r, apierror.Unauthorized("invalid or expired token", err))
+		return
+	}
+
+	logging.SetUserID(r.Context(), validUser)
+
+	dbEndpoint, err := cfg.userWebhookEndpoint(r, validUser)
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	dbDeliveries, err := cfg.queries.GetEndpointDeliveries(r.Context(), database.GetEndpointDeliveriesParams{
+		EndpointID: dbEndpoint.ID,
+		Limit:      webhookDeliveryPageSize,
+	})
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	deliveries := make([]EndpointDelivery, len(dbDeliveries))
+	for i, dbDelivery := range dbDeliveries {
+		deliveries[i] = endpointDeliveryFromDB(dbDelivery)
+	}
+
+	respondWithJSON(w, 200, deliveries)
+}
+
+// publishEvent queues a delivery to every endpoint subscribed to eventType.
+// It runs after the change is committed and only logs failures: the change
+// has happened either way, and a missed notification beats a failed request.
+func (cfg *apiConfig) publishEvent(ctx context.Context, eventType string, data any) {
+	logger := logging.FromContext(ctx).With("event_type", eventType)
+
+	dbEndpoints, err := cfg.queries.GetWebhookEndpointsForEvent(ctx, eventType)
+	if err != nil {
+		logger.Error("error finding webhook endpoints", "err", err)
+		return
+	}
+	if len(dbEndpoints) == 0 {
+		return
+	}
+
+	payload, err := json.Marshal(outboundEvent{
+		ID:        uuid.New(),
+		Type:      eventType,
+		CreatedAt: time.Now().UTC(),
+		Data:      data,
+	})
+	if err != nil {
+		logger.Error("error encoding webhook event", "err", err)
+		return
+	}
+
+	for _, dbEndpoint := range dbEndpoints {
+		dbDelivery, err := cfg.queries.CreateEndpointDelivery(ctx, database.CreateEndpointDeliveryParams{
+			EndpointID: dbEndpoint.ID,
+			EventType:  eventType,
+			Payload:    payload,
+		})
+		if err != nil {
+			logger.Error("error recording webhook delivery", "endpoint_id", dbEndpoint.ID, "err", err)
+			continue
+		}
+
+		_, err = cfg.jobs.Enqueue(ctx, jobDeliverWebhook, deliverWebhookJob{DeliveryID: dbDelivery.ID}, jobs.MaxAttempts(maxWebhookAttempts))
+		if err != nil {
+			logger.Error("error scheduling webhook delivery", "delivery_id", dbDelivery.ID, "err", err)
+		}
+	}
+}
+
+// deliverWebhook makes one delivery attempt and logs it. Errors go back to
+// the queue, which retries with backoff; the last attempt counts against the
+// endpoint instead.
+func (cfg *apiConfig) deliverWebhook(ctx context.Context, job deliverWebhookJob) error {
+	dbDelivery, err := cfg.queries.GetEndpointDelivery(ctx, job.DeliveryID)
+	if errors.Is(err, sql.ErrNoRows) {
+		// the endpoint was deleted along with its deliveries
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	dbEndpoint, err := cfg.queries.GetWebhookEndpoint(ctx, dbDelivery.EndpointID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	attempt := database.RecordEndpointDeliveryAttemptParams{
+		ID:     dbDelivery.ID,
+		Status: endpointDeliverySucceeded,
+	}
+
+	if !dbEndpoint.Enabled {
+		attempt.Status = endpointDeliveryFailed
+		attempt.Error = sql.NullString{String: "endpoint is disabled", Valid: true}
+		_, err = cfg.queries.RecordEndpointDeliveryAttempt(ctx, attempt)
+		return err
+	}
+
+	result, sendErr := cfg.webhookSender.Send(ctx, dbEndpoint.Url, dbEndpoint.Secret, dbDelivery.EventType, dbDelivery.ID.String(), dbDelivery.Payload)
+
+	attempt.ResponseStatus = sql.NullInt32{Int32: int32(result.StatusCode), Valid: result.StatusCode != 0}
+	attempt.ResponseBody = sql.NullString{String: result.Body, Valid: result.StatusCode != 0}
+	attempt.DurationMs = sql.NullInt32{Int32: int32(result.Duration.Milliseconds()), Valid: true}
+
+	outcome := webhook.Decide(sendErr, int(dbDelivery.Attempts)+1, maxWebhookAttempts)
+	attempt.Status = outcome.Status
+	if sendErr != nil {
+		attempt.Error = sql.NullString{String: sendErr.Error(), Valid: true}
+	}
+
+	_, err = cfg.queries.RecordEndpointDeliveryAttempt(ctx, attempt)
+	if err != nil {
+		return err
+	}
+
+	if outcome.ResetFailures {
+		return cfg.queries.RecordWebhookEndpointSuccess(ctx, dbEndpoint.ID)
+	}
+
+	if !outcome.Final {
+		return sendErr
+	}
+
+	err = cfg.recordWebhookEndpointFailure(ctx, dbEndpoint, outcome)
+	if err != nil {
+		return err
+	}
+
+	return jobs.Permanent(sendErr)
+}
+
+// recordWebhookEndpointFailure counts a delivery that ran out of retries and
+// disables the endpoint once too many fail in a row, or straight away when
+// the outcome says so.
+func (cfg *apiConfig) recordWebhookEndpointFailure(ctx context.Context, dbEndpoint database.WebhookEndpoint, outcome webhook.Outcome) error {
+	reason := outcome.DisableReason
+	if outcome.CountFailure {
+		failures, err := cfg.queries.RecordWebhookEndpointFailure(ctx, dbEndpoint.ID)
+		if err != nil {
+			return err
+		}
+		if reason == "" {
+			reason = webhook.FailureDisableReason(int(failures), webhookFailureLimit)
+		}
+	}
+	if reason == "" {
+		return nil
+	}
+
+	logging.FromContext(ctx).Warn("disabling webhook endpoint", "endpoint_id", dbEndpoint.ID, "reason", reason)
+
+	return cfg.queries.DisableWebhookEndpoint(ctx, database.DisableWebhookEndpointParams{
+		ID:             dbEndpoint.ID,
+		DisabledReason: sql.NullString{String: reason, Valid: true},
+	})
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nickemp1996/chirpy/internal/apierror"
+	"github.com/nickemp1996/chirpy/internal/database"
+	"github.com/nickemp1996/chirpy/internal/logging"
+)
+
+// Delivery statuses. Received means processing never finished, which after a
+// crash is the only trace of the event.
+const (
+	deliveryReceived  = "received"
+	deliveryProcessed = "processed"
+	deliveryIgnored   = "ignored"
+	deliveryDuplicate = "duplicate"
+	deliveryFailed    = "failed"
+)
+
+var deliveryStatuses = []string{deliveryReceived, deliveryProcessed, deliveryIgnored, deliveryDuplicate, deliveryFailed}
+
+const (
+	defaultDeliveryPageSize = 50
+	maxDeliveryPageSize     = 200
+)
+
+// redactedWebhookHeaders carry credentials and are never stored.
+var redactedWebhookHeaders = []string{"Authorization", "Cookie"}
+
+// webhookResult is what processing made of a delivery. EventID and EventType
+// are filled in as soon as the body parses, even if processing then fails.
+type webhookResult struct {
+	EventID   string
+	EventType string
+	Status    string
+}
+
+// processWebhook runs a stored body through its provider's handler.
+func (cfg *apiConfig) processWebhook(ctx context.Context, provider string, body []byte) (webhookResult, error) {
+	billingProvider, ok := cfg.billingProviders[provider]
+	if !ok {
+		return webhookResult{}, apierror.BadRequest("unknown webhook provider "+provider, nil)
+	}
+	return cfg.processBillingEvent(ctx, billingProvider, body)
+}
+
+// receiveWebhook stores an authenticated delivery before processing it, so an
+// event that fails can be inspected and replayed instead of being lost.
+func (cfg *apiConfig) receiveWebhook(w http.ResponseWriter, r *http.Request, provider string, body []byte) {
+	headers := r.Header.Clone()
+	for _, name := range redactedWebhookHeaders {
+		headers.Del(name)
+	}
+	headersJSON, err := json.Marshal(headers)
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	delivery, err := cfg.queries.CreateWebhookDelivery(r.Context(), database.CreateWebhookDeliveryParams{
+		Provider: provider,
+		Headers:  headersJSON,
+		Body:     body,
+	})
+	if err != nil {
+		// without a stored copy the provider's retry is the only one left
+		respondWithError(w, r, err)
+		return
+	}
+
+	result, err := cfg.processWebhook(r.Context(), provider, body)
+	cfg.finishDelivery(r.Context(), delivery.ID, result, err)
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(204)
+}
+
+// finishDelivery records the outcome of processing. Failing to record it is
+// only logged: the event itself was handled either way.
+func (cfg *apiConfig) finishDelivery(ctx context.Context, id uuid.UUID, result webhookResult, procErr error) (database.WebhookDelivery, error) {
+	params := database.FinishWebhookDeliveryParams{
+		ID:             id,
+		EventID:        sql.NullString{String: result.EventID, Valid: result.EventID != ""},
+		EventType:      sql.NullString{String: result.EventType, Valid: result.EventType != ""},
+		Status:         result.Status,
+		ResponseStatus: sql.NullInt32{Int32: 204, Valid: true},
+	}
+	if procErr != nil {
+		params.Status = deliveryFailed
+		params.ResponseStatus.Int32 = int32(apierror.From(procErr).Status)
+		params.Error = sql.NullString{String: procErr.Error(), Valid: true}
+	}
+
+	delivery, err := cfg.queries.FinishWebhookDelivery(ctx, params)
+	if err != nil {
+		logging.FromContext(ctx).Error("error recording webhook outcome", "delivery_id", id, "err", err)
+		return database.WebhookDelivery{}, err
+	}
+
+	return delivery, nil
+}
+
+func webhookDeliveryFromDB(row database.ListWebhookDeliveriesRow) WebhookDelivery {
+	delivery := WebhookDelivery{
+		ID:             row.ID,
+		ReceivedAt:     row.ReceivedAt,
+		Provider:       row.Provider,
+		EventID:        row.EventID.String,
+		EventType:      row.EventType.String,
+		Status:         row.Status,
+		ResponseStatus: int(row.ResponseStatus.Int32),
+		Error:          row.Error.String,
+		Attempts:       row.Attempts,
+	}
+	if row.ProcessedAt.Valid {
+		delivery.ProcessedAt = &row.ProcessedAt.Time
+	}
+	return delivery
+}
+
+func webhookDeliveryDetail(dbDelivery database.WebhookDelivery) WebhookDelivery {
+	delivery := webhookDeliveryFromDB(database.ListWebhookDeliveriesRow{
+		ID:             dbDelivery.ID,
+		ReceivedAt:     dbDelivery.ReceivedAt,
+		Provider:       dbDelivery.Provider,
+		EventID:        dbDelivery.EventID,
+		EventType:      dbDelivery.EventType,
+		Status:         dbDelivery.Status,
+		ResponseStatus: dbDelivery.ResponseStatus,
+		Error:          dbDelivery.Error,
+		Attempts:       dbDelivery.Attempts,
+		ProcessedAt:    dbDelivery.ProcessedAt,
+	})
+
+	delivery.Headers = dbDelivery.Headers
+	if json.Valid(dbDelivery.Body) {
+		delivery.Body = dbDelivery.Body
+	} else {
+		// bodies that failed to parse are still shown, as a JSON string
+		delivery.Body, _ = json.Marshal(string(dbDelivery.Body))
+	}
+
+	return delivery
+}
+
+func (cfg *apiConfig) listWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	_, err := cfg.requireAdmin(r)
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	query := r.URL.Query()
+	params := database.ListWebhookDeliveriesParams{
+		Provider: sql.NullString{String: query.Get("provider"), Valid: query.Get("provider") != ""},
+		Status:   sql.NullString{String: query.Get("status"), Valid: query.Get("status") != ""},
+		MaxRows:  defaultDeliveryPageSize,
+	}
+
+	if params.Status.Valid && !slices.Contains(deliveryStatuses, params.Status.String) {
+		respondWithError(w, r, apierror.Field("status", "must be one of received, processed, ignored, duplicate or failed"))
+		return
+	}
+
+	if s := query.Get("before"); s != "" {
+		before, err := time.Parse(time.RFC3339Nano, s)
+		if err != nil {
+			respondWithError(w, r, apierror.Field("before", "must be an RFC 3339 timestamp"))
+			return
+		}
+		params.Before = sql.NullTime{Time: before, Valid: true}
+	}
+
+	if s := query.Get("limit"); s != "" {
+		limit, err := strconv.Atoi(s)
+		if err != nil || limit < 1 || limit > maxDeliveryPageSize {
+			respondWithError(w, r, apierror.Field("limit", "must be between 1 and "+strconv.Itoa(maxDeliveryPageSize)))
+			return
+		}
+		params.MaxRows = int32(limit)
+	}
+
+	rows, err := cfg.queries.ListWebhookDeliveries(r.Context(), params)
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	deliveries := make([]WebhookDelivery, len(rows))
+	for i, row := range rows {
+		deliveries[i] = webhookDeliveryFromDB(row)
+	}
+
+	respondWithJSON(w, 200, deliveries)
+}
+
+func (cfg *apiConfig) getWebhookDelivery(w http.ResponseWriter, r *http.Request) {
+	_, err := cfg.requireAdmin(r)
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	deliveryID, err := uuid.Parse(r.PathValue("deliveryID"))
+	if err != nil {
+		respondWithError(w, r, apierror.InvalidID("deliveryID must be a UUID", err))
+		return
+	}
+
+	dbDelivery, err := cfg.queries.GetWebhookDelivery(r.Context(), deliveryID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, r, apierror.NotFound("webhook delivery not found", err))
+			return
+		}
+		respondWithError(w, r, err)
+		return
+	}
+
+	respondWithJSON(w, 200, webhookDeliveryDetail(dbDelivery))
+}
+
+// replayWebhookDelivery processes a stored delivery again, through the same
+// code as a live one. Events that already took effect come back as
+// duplicates, so replaying is always safe.
+func (cfg *apiConfig) replayWebhookDelivery(w http.ResponseWriter, r *http.Request) {
+	admin, err := cfg.requireAdmin(r)
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	deliveryID, err := uuid.Parse(r.PathValue("deliveryID"))
+	if err != nil {
+		respondWithError(w, r, apierror.InvalidID("deliveryID must be a UUID", err))
+		return
+	}
+
+	dbDelivery, err := cfg.queries.GetWebhookDelivery(r.Context(), deliveryID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, r, apierror.NotFound("webhook delivery not found", err))
+			return
+		}
+		respondWithError(w, r, err)
+		return
+	}
+
+	result, procErr := cfg.processWebhook(r.Context(), dbDelivery.Provider, dbDelivery.Body)
+	logging.FromContext(r.Context()).Info("replayed webhook delivery",
+		"delivery_id", deliveryID, "admin_id", admin.ID, "status", result.Status, "err", procErr)
+
+	dbDelivery, err = cfg.finishDelivery(r.Context(), deliveryID, result, procErr)
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	// the replay itself succeeded even if processing failed again; the
+	// delivery's status and error say how it went
+	respondWithJSON(w, 200, webhookDeliveryDetail(dbDelivery))
+}
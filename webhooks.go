@@ -1,59 +1,157 @@
 package main
 
 import (
+	"context"
 	"database/sql"
-	"encoding/json"
-	"fmt"
+	"errors"
 	"net/http"
+	"time"
 
-	"github.com/google/uuid"
-	"github.com/nickemp1996/chirpy/internal/auth"
+	"github.com/nickemp1996/chirpy/internal/apierror"
+	"github.com/nickemp1996/chirpy/internal/billing"
+	"github.com/nickemp1996/chirpy/internal/database"
+	"github.com/nickemp1996/chirpy/internal/httpjson"
+	"github.com/nickemp1996/chirpy/internal/logging"
 )
 
-func (cfg *apiConfig) upgradeUser(w http.ResponseWriter, r *http.Request) {
-	polkaKey, err := auth.GetAPIKey(r.Header)
-	if err != nil || polkaKey != cfg.polkaKey {
-		respondWithError(w, 401, "incorrect api key", err)
+// billingWebhook receives payment provider webhooks at
+// /api/billing/{provider}/webhooks.
+func (cfg *apiConfig) billingWebhook(w http.ResponseWriter, r *http.Request) {
+	cfg.handleBillingWebhook(w, r, r.PathValue("provider"))
+}
+
+// polkaWebhook keeps the url Polka was first set up with working.
+func (cfg *apiConfig) polkaWebhook(w http.ResponseWriter, r *http.Request) {
+	cfg.handleBillingWebhook(w, r, billing.PolkaName)
+}
+
+func (cfg *apiConfig) handleBillingWebhook(w http.ResponseWriter, r *http.Request, name string) {
+	provider, ok := cfg.billingProviders[name]
+	if !ok {
+		respondWithError(w, r, apierror.NotFound("unknown billing provider", nil))
 		return
 	}
 
-	type parameters struct {
-		Event string `json:"event"`
-		Data  struct {
-			UserID string `json:"user_id"`
-		} `json:"data"`
+	body, err := httpjson.ReadBody(w, r, maxWebhookBodySize)
+	if err != nil {
+		respondWithError(w, r, err)
+		return
 	}
 
-	decoder := json.NewDecoder(r.Body)
-	params := parameters{}
-	err = decoder.Decode(&params)
+	err = provider.Verify(r.Header, body)
 	if err != nil {
-		respondWithError(w, 500, "internal error", err)
+		respondWithError(w, r, apierror.Unauthorized("webhook could not be authenticated", err))
 		return
 	}
 
-	if params.Event != "user.upgraded" {
-		fmt.Println("wrong event")
-		w.WriteHeader(204)
-		return
+	cfg.receiveWebhook(w, r, provider.Name(), body)
+}
+
+// processBillingEvent applies one provider event to the user's subscription.
+// It is shared by live deliveries and admin replays, so it only sees the
+// stored body, never the request.
+func (cfg *apiConfig) processBillingEvent(ctx context.Context, provider billing.Provider, body []byte) (webhookResult, error) {
+	event, err := provider.Parse(body)
+	result := webhookResult{
+		EventID:   event.ID,
+		EventType: event.Type,
+	}
+	if err != nil {
+		return result, err
+	}
+
+	logger := logging.FromContext(ctx).With("provider", provider.Name(), "event", event.Type)
+
+	if event.Kind == billing.KindIgnored {
+		logger.Info("ignoring billing event")
+		result.Status = deliveryIgnored
+		return result, nil
 	}
 
-	id, err := uuid.Parse(params.Data.UserID)
+	tx, err := cfg.db.BeginTx(ctx, nil)
 	if err != nil {
-		respondWithError(w, 500, "internal error", err)
-		return
+		return result, err
+	}
+	defer tx.Rollback()
+	qtx := cfg.withTx(tx)
+
+	// the event row commits with its effects, so a failed delivery is
+	// retried in full and a repeated one does nothing
+	_, err = qtx.RecordWebhookEvent(ctx, database.RecordWebhookEventParams{
+		Provider:  provider.Name(),
+		EventID:   event.ID,
+		EventType: event.Type,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		logger.Info("ignoring duplicate billing event", "event_id", event.ID)
+		result.Status = deliveryDuplicate
+		return result, nil
+	} else if err != nil {
+		return result, err
 	}
 
-	_, err = cfg.queries.UpgradeUser(r.Context(), id)
+	_, err = qtx.GetUser(ctx, event.UserID)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			respondWithError(w, 404, "user not found", err)
-			return
-		} else {
-			respondWithError(w, 500, "internal error", err)
-			return
+			return result, apierror.NotFound("user not found", err)
 		}
+		return result, err
 	}
 
-	w.WriteHeader(204)
+	existing, err := qtx.GetSubscription(ctx, database.GetSubscriptionParams{
+		UserID:   event.UserID,
+		Provider: provider.Name(),
+	})
+	hasExisting := err == nil
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return result, err
+	}
+
+	change := subscriptionChange{
+		UserID:     event.UserID,
+		Provider:   provider.Name(),
+		ExternalID: event.SubscriptionID,
+		EventType:  event.Type,
+		PeriodEnd:  periodEnd(existing.CurrentPeriodEnd, event.PeriodEnd),
+	}
+
+	switch event.Kind {
+	case billing.KindActivated:
+		change.Status = subscriptionActive
+		// no period end means open ended, which is how Polka sold Red at first
+		change.PeriodEnd = periodEnd(sql.NullTime{}, event.PeriodEnd)
+	case billing.KindPaymentFailed:
+		change.Status = subscriptionPastDue
+	case billing.KindCanceled:
+		// canceled subscriptions run to the end of the paid period
+		change.Status = subscriptionCanceled
+		if !change.PeriodEnd.Valid || !change.PeriodEnd.Time.After(time.Now()) {
+			change.Status = subscriptionExpired
+		}
+	case billing.KindExpired:
+		change.Status = subscriptionExpired
+	default:
+		return result, errors.New("unhandled billing event kind " + string(event.Kind))
+	}
+
+	if !hasExisting && change.Status != subscriptionActive {
+		logger.Info("ignoring billing event for user without a subscription", "user_id", event.UserID)
+		result.Status = deliveryIgnored
+		return result, tx.Commit()
+	}
+
+	sub, err := applySubscriptionChange(ctx, qtx, change)
+	if err != nil {
+		return result, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return result, err
+	}
+
+	cfg.scheduleExpiry(ctx, sub)
+
+	result.Status = deliveryProcessed
+	return result, nil
 }